@@ -13,6 +13,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	_ "modernc.org/sqlite" // Registers the embedded "sqlite" driver of the sql storage
 
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/handlers"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/metrics"
@@ -36,33 +37,88 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Initialize metrics
+	metricsCollector := metrics.NewCollector()
+	metricsCollector.Register()
+
 	// Initialize storage
 	var storageInstance storage.Storage
-	switch cfg.Storage.Type {
-	case "memory":
-		storageInstance = storage.NewMemoryStorage(logger)
-	case "redis":
+	var memoryStorage *storage.MemoryStorage
+	var clusterStorage *storage.ClusterStorage
+	switch {
+	case cfg.Storage.Type == "memory" && storage.ClusterEnabled(cfg.Storage):
+		// Replicas share their keys over the internal endpoint instead of a storage server
+		clusterStorage, err = storage.NewClusterStorage(cfg.Storage, metricsCollector, nil, logger)
+		if err != nil {
+			logger.Error("Failed to initialize cluster storage", "error", err)
+			os.Exit(1)
+		}
+		if cfg.Storage.MemorySnapshotPath != "" {
+			logger.Warn("Memory snapshots are not supported by cluster storage, keys are handed over on shutdown instead")
+		}
+		storageInstance = clusterStorage
+	case cfg.Storage.Type == "memory":
+		memoryStorage, err = storage.NewMemoryStorageWithConfig(cfg.Storage, metricsCollector, nil, logger)
+		if err != nil {
+			logger.Error("Failed to initialize memory storage", "error", err)
+			os.Exit(1)
+		}
+		if path := cfg.Storage.MemorySnapshotPath; path != "" {
+			// A broken snapshot must not keep the service down, it starts empty instead
+			if _, err := memoryStorage.LoadSnapshot(path); err != nil {
+				logger.Error("Failed to restore memory snapshot", "path", path, "error", err)
+			}
+			memoryStorage.StartSnapshots(path, cfg.Storage.MemorySnapshotInterval)
+		}
+		storageInstance = memoryStorage
+	case cfg.Storage.Type == "sharded_memory":
+		storageInstance, err = storage.NewShardedMemoryStorageWithConfig(cfg.Storage, metricsCollector, nil, logger)
+		if err != nil {
+			logger.Error("Failed to initialize sharded memory storage", "error", err)
+			os.Exit(1)
+		}
+	case cfg.Storage.Type == "redis":
 		storageInstance, err = storage.NewRedisStorage(cfg.Storage, logger)
 		if err != nil {
 			logger.Error("Failed to initialize Redis storage", "error", err)
 			os.Exit(1)
 		}
+	case cfg.Storage.Type == "hybrid":
+		storageInstance, err = storage.NewHybridStorage(cfg.Storage, nil, logger)
+		if err != nil {
+			logger.Error("Failed to initialize hybrid storage", "error", err)
+			os.Exit(1)
+		}
+	case cfg.Storage.Type == "sql":
+		storageInstance, err = storage.NewSQLStorage(cfg.Storage, nil, logger)
+		if err != nil {
+			logger.Error("Failed to initialize SQL storage", "error", err)
+			os.Exit(1)
+		}
 	default:
 		logger.Error("Unsupported storage type", "type", cfg.Storage.Type)
 		os.Exit(1)
 	}
 	defer storageInstance.Close()
 
-	// Initialize metrics
-	metricsCollector := metrics.NewCollector()
-	metricsCollector.Register()
+	// Report the latency, errors and payload sizes of every storage operation
+	if cfg.Storage.Instrumentation {
+		storageInstance = storage.NewInstrumentedStorage(storageInstance, cfg.Storage.Type, metricsCollector, logger)
+	}
 
 	// Initialize service
-	rateLimiterService := service.NewRateLimiterService(storageInstance, cfg, metricsCollector, logger)
+	rateLimiterService, err := service.NewRateLimiterService(storageInstance, cfg, metricsCollector, nil, logger)
+	if err != nil {
+		logger.Error("Failed to initialize rate limiter service", "error", err)
+		os.Exit(1)
+	}
+	defer rateLimiterService.Close()
 
 	// Initialize handlers
 	limitHandler := handlers.NewLimitHandler(rateLimiterService, logger)
-	healthHandler := handlers.NewHealthHandler()
+	concurrencyHandler := handlers.NewConcurrencyHandler(rateLimiterService, logger)
+	healthHandler := handlers.NewHealthHandler(rateLimiterService)
+	policyHandler := handlers.NewPolicyHandler(rateLimiterService)
 	metricsHandler := handlers.NewMetricsHandler(metricsCollector)
 
 	// Setup router
@@ -95,7 +151,13 @@ func main() {
 	router.Get("/metrics", metricsHandler.Serve)
 	router.Route("/api/v1", func(r chi.Router) {
 		r.Post("/limit-check", limitHandler.CheckLimit)
+		r.Get("/policies", policyHandler.List)
+		r.Post("/concurrency/acquire", concurrencyHandler.Acquire)
+		r.Post("/concurrency/release", concurrencyHandler.Release)
 	})
+	if clusterStorage != nil {
+		router.Handle(storage.ClusterPathPrefix+"*", clusterStorage.Handler())
+	}
 
 	// Start server
 	readTimeout := cfg.Server.ReadTimeout
@@ -143,5 +205,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Persist the final state once no request can change it anymore
+	if memoryStorage != nil && cfg.Storage.MemorySnapshotPath != "" {
+		if keys, err := memoryStorage.SaveSnapshot(cfg.Storage.MemorySnapshotPath); err != nil {
+			logger.Error("Failed to save memory snapshot", "path", cfg.Storage.MemorySnapshotPath, "error", err)
+		} else {
+			logger.Info("Memory snapshot saved", "path", cfg.Storage.MemorySnapshotPath, "keys", keys)
+		}
+	}
+
 	logger.Info("Server exited")
 }
@@ -7,8 +7,7 @@ import (
 	"os"
 	"time"
 
-	"github.com/tsvetkovpa93tech/rate-limiter-service/internal"
-	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/ratelimit"
 )
 
 func main() {
@@ -18,11 +17,11 @@ func main() {
 	}))
 
 	// Create in-memory storage
-	memStorage := storage.NewMemoryStorage(logger)
+	memStorage := ratelimit.NewMemoryStorage(nil, logger)
 
 	// Create Token Bucket limiter using factory
-	tokenBucketLimiter, err := internal.NewRateLimiter(internal.LimiterConfig{
-		Algorithm: internal.AlgorithmTokenBucket,
+	tokenBucketLimiter, err := ratelimit.New(ratelimit.Config{
+		Algorithm: ratelimit.TokenBucket,
 		Limit:     5,
 		Window:    time.Second,
 		Storage:   memStorage,
@@ -52,8 +51,8 @@ func main() {
 	}
 
 	// Create Sliding Window limiter
-	slidingWindowLimiter, err := internal.NewRateLimiter(internal.LimiterConfig{
-		Algorithm: internal.AlgorithmSlidingWindow,
+	slidingWindowLimiter, err := ratelimit.New(ratelimit.Config{
+		Algorithm: ratelimit.SlidingWindow,
 		Limit:     3,
 		Window:    2 * time.Second,
 		Storage:   memStorage,
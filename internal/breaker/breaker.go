@@ -0,0 +1,159 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+)
+
+// State is the state of a circuit breaker
+type State int
+
+const (
+	// StateClosed lets every call through
+	StateClosed State = iota
+	// StateHalfOpen lets a single probe through to test whether the dependency recovered
+	StateHalfOpen
+	// StateOpen rejects calls until the cooldown has passed
+	StateOpen
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half_open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker stops calls to a failing dependency.
+// It opens after threshold consecutive failures, rejects calls for the cooldown,
+// then lets a single probe through: a success closes it again, a failure reopens it.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	state     State
+	failures  int       // Consecutive failures while closed
+	openedAt  time.Time // When the breaker last opened
+	probeAt   time.Time // When the half-open probe was let through, zero if none is running
+	threshold int
+	cooldown  time.Duration
+	onChange  func(from, to State)
+	now       func() time.Time
+}
+
+// New creates a closed circuit breaker timing its cooldown by clk, the system clock if nil.
+// A threshold <= 0 disables the breaker.
+// onChange is called on every state change while the breaker is locked and may be nil.
+func New(threshold int, cooldown time.Duration, clk clock.Clock, onChange func(from, to State)) *CircuitBreaker {
+	if clk == nil {
+		clk = clock.System()
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		onChange:  onChange,
+		now:       clk.Now,
+	}
+}
+
+// Allow reports whether a call may proceed. Every allowed call must be
+// followed by Success or Failure, a probe that never reports is retried after the cooldown.
+func (b *CircuitBreaker) Allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(StateHalfOpen)
+		b.probeAt = now
+		return true
+	case StateHalfOpen:
+		if !b.probeAt.IsZero() && now.Sub(b.probeAt) < b.cooldown {
+			return false
+		}
+		b.probeAt = now
+		return true
+	default:
+		return true
+	}
+}
+
+// Success records a successful call and closes the breaker
+func (b *CircuitBreaker) Success() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probeAt = time.Time{}
+	if b.state != StateClosed {
+		b.setState(StateClosed)
+	}
+}
+
+// Failure records a failed call and opens the breaker once the threshold is reached
+// or when the half-open probe failed
+func (b *CircuitBreaker) Failure() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == StateHalfOpen || (b.state == StateClosed && b.failures >= b.threshold) {
+		b.failures = 0
+		b.probeAt = time.Time{}
+		b.openedAt = b.now()
+		b.setState(StateOpen)
+	}
+}
+
+// State returns the current state of the breaker
+func (b *CircuitBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// RetryAfter returns how long an open breaker keeps rejecting calls, 0 if it is not open
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateOpen {
+		return 0
+	}
+	if remaining := b.cooldown - b.now().Sub(b.openedAt); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// setState switches to state and reports the change, b.mu must be held
+func (b *CircuitBreaker) setState(state State) {
+	from := b.state
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(from, state)
+	}
+}
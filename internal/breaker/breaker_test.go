@@ -0,0 +1,103 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	now := time.Unix(1_000, 0)
+	var changes []string
+	b := New(3, 10*time.Second, nil, func(from, to State) {
+		changes = append(changes, from.String()+"->"+to.String())
+	})
+	b.now = func() time.Time { return now }
+
+	// Failures below the threshold keep the breaker closed, a success resets them
+	b.Failure()
+	b.Failure()
+	b.Success()
+	b.Failure()
+	b.Failure()
+	if b.State() != StateClosed || !b.Allow() {
+		t.Fatalf("Expected breaker to stay closed, got %s", b.State())
+	}
+
+	// The threshold opens it
+	b.Failure()
+	if b.State() != StateOpen {
+		t.Fatalf("Expected breaker to open, got %s", b.State())
+	}
+	if b.Allow() {
+		t.Error("Open breaker should reject calls")
+	}
+	if retryAfter := b.RetryAfter(); retryAfter != 10*time.Second {
+		t.Errorf("Expected retry after 10s, got %v", retryAfter)
+	}
+
+	// After the cooldown a single probe is let through
+	now = now.Add(10 * time.Second)
+	if !b.Allow() {
+		t.Fatal("Expected probe after cooldown")
+	}
+	if b.State() != StateHalfOpen {
+		t.Fatalf("Expected half-open breaker, got %s", b.State())
+	}
+	if b.Allow() {
+		t.Error("Only one probe should run at a time")
+	}
+
+	// A failed probe reopens it
+	b.Failure()
+	if b.State() != StateOpen {
+		t.Fatalf("Expected failed probe to reopen the breaker, got %s", b.State())
+	}
+
+	// A successful probe closes it
+	now = now.Add(10 * time.Second)
+	if !b.Allow() {
+		t.Fatal("Expected probe after cooldown")
+	}
+	b.Success()
+	if b.State() != StateClosed || !b.Allow() {
+		t.Fatalf("Expected successful probe to close the breaker, got %s", b.State())
+	}
+
+	expected := []string{"closed->open", "open->half_open", "half_open->open", "open->half_open", "half_open->closed"}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected changes %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected change %d to be %s, got %s", i, expected[i], changes[i])
+		}
+	}
+}
+
+func TestCircuitBreaker_AbandonedProbe(t *testing.T) {
+	now := time.Unix(1_000, 0)
+	b := New(1, time.Second, nil, nil)
+	b.now = func() time.Time { return now }
+
+	b.Failure()
+	now = now.Add(time.Second)
+	if !b.Allow() {
+		t.Fatal("Expected probe after cooldown")
+	}
+
+	// A probe that never reports back does not block the breaker forever
+	now = now.Add(time.Second)
+	if !b.Allow() {
+		t.Error("Expected another probe once the previous one timed out")
+	}
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	b := New(0, time.Second, nil, nil)
+	for i := 0; i < 10; i++ {
+		b.Failure()
+	}
+	if b.State() != StateClosed || !b.Allow() {
+		t.Errorf("Disabled breaker should never open, got %s", b.State())
+	}
+}
@@ -3,6 +3,8 @@ package cache
 import (
 	"sync"
 	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
 )
 
 // Cache provides in-memory caching for rate limit results
@@ -10,6 +12,7 @@ type Cache struct {
 	data            sync.Map
 	ttl             time.Duration
 	cleanupInterval time.Duration
+	clock           clock.Clock
 	stop            chan struct{}
 }
 
@@ -19,11 +22,15 @@ type cacheItem struct {
 	expiresAt time.Time
 }
 
-// NewCache creates a new cache instance
-func NewCache(ttl time.Duration, cleanupInterval time.Duration) *Cache {
+// NewCache creates a new cache instance expiring items by clk, the system clock if nil
+func NewCache(ttl time.Duration, cleanupInterval time.Duration, clk clock.Clock) *Cache {
+	if clk == nil {
+		clk = clock.System()
+	}
 	c := &Cache{
 		ttl:             ttl,
 		cleanupInterval: cleanupInterval,
+		clock:           clk,
 		stop:            make(chan struct{}),
 	}
 
@@ -41,7 +48,7 @@ func (c *Cache) Get(key string) (interface{}, bool) {
 	}
 
 	cachedItem := item.(*cacheItem)
-	if time.Now().After(cachedItem.expiresAt) {
+	if c.clock.Now().After(cachedItem.expiresAt) {
 		c.data.Delete(key)
 		return nil, false
 	}
@@ -53,7 +60,7 @@ func (c *Cache) Get(key string) (interface{}, bool) {
 func (c *Cache) Set(key string, value interface{}) {
 	c.data.Store(key, &cacheItem{
 		value:     value,
-		expiresAt: time.Now().Add(c.ttl),
+		expiresAt: c.clock.Now().Add(c.ttl),
 	})
 }
 
@@ -70,7 +77,7 @@ func (c *Cache) cleanup() {
 	for {
 		select {
 		case <-ticker.C:
-			now := time.Now()
+			now := c.clock.Now()
 			c.data.Range(func(key, value interface{}) bool {
 				item := value.(*cacheItem)
 				if now.After(item.expiresAt) {
@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+)
+
+func TestCache_Expiration(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	c := NewCache(time.Minute, time.Hour, clk)
+	defer c.Close()
+
+	c.Set("key", "value")
+	clk.Advance(59 * time.Second)
+	if value, ok := c.Get("key"); !ok || value != "value" {
+		t.Errorf("Expected cached value before the TTL, got %v (%v)", value, ok)
+	}
+
+	clk.Advance(2 * time.Second)
+	if value, ok := c.Get("key"); ok {
+		t.Errorf("Expected value to expire after the TTL, got %v", value)
+	}
+}
@@ -0,0 +1,58 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time to limiters, storages and caches,
+// so that tests can control it instead of sleeping.
+// Background work such as cleanup still runs on wall-clock tickers.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+}
+
+// System returns the clock reading the system time
+func System() Clock {
+	return systemClock{}
+}
+
+// systemClock reads time.Now
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Fake is a clock that only moves when told to. It is safe for concurrent use.
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake returns a fake clock stopped at now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the time the clock is stopped at
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the clock forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Set moves the clock to now, which may be in the past
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
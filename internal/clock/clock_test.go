@@ -0,0 +1,33 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := NewFake(start)
+
+	if now := clk.Now(); !now.Equal(start) {
+		t.Errorf("Expected %v, got %v", start, now)
+	}
+
+	clk.Advance(90 * time.Minute)
+	if now := clk.Now(); !now.Equal(start.Add(90 * time.Minute)) {
+		t.Errorf("Expected the clock to advance by 90m, got %v", now)
+	}
+
+	clk.Set(start)
+	if now := clk.Now(); !now.Equal(start) {
+		t.Errorf("Expected the clock to be set back to %v, got %v", start, now)
+	}
+}
+
+func TestSystem(t *testing.T) {
+	before := time.Now()
+	now := System().Now()
+	if now.Before(before) || now.After(time.Now()) {
+		t.Errorf("Expected the system time, got %v", now)
+	}
+}
@@ -1,10 +1,12 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/services"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
@@ -18,15 +20,30 @@ const (
 	AlgorithmTokenBucket AlgorithmType = "token_bucket"
 	// AlgorithmSlidingWindow represents the Sliding Window Log algorithm
 	AlgorithmSlidingWindow AlgorithmType = "sliding_window"
+	// AlgorithmFixedWindow represents the Fixed Window Counter algorithm
+	AlgorithmFixedWindow AlgorithmType = "fixed_window"
+	// AlgorithmSlidingWindowCounter represents the Sliding Window Counter (two-window approximation) algorithm
+	AlgorithmSlidingWindowCounter AlgorithmType = "sliding_window_counter"
+	// AlgorithmGCRA represents the Generic Cell Rate Algorithm
+	AlgorithmGCRA AlgorithmType = "gcra"
+	// AlgorithmLeakyBucket represents the Leaky Bucket (queue-based smoothing) algorithm
+	AlgorithmLeakyBucket AlgorithmType = "leaky_bucket"
 )
 
+// ErrInvalidConfig is returned when the limit, window, burst, queue capacity or lease TTL cannot build a limiter
+var ErrInvalidConfig = errors.New("invalid limiter configuration")
+
 // LimiterConfig holds configuration for creating a rate limiter
 type LimiterConfig struct {
-	Algorithm AlgorithmType
-	Limit     int
-	Window    time.Duration
-	Storage   storage.Storage
-	Logger    *slog.Logger
+	Algorithm     AlgorithmType
+	Limit         int
+	Window        time.Duration
+	Burst         int  // Requests allowed at once, 0 means Limit (token_bucket and gcra)
+	QueueCapacity int  // Requests allowed to wait, 0 means Limit (leaky_bucket only)
+	WindowJitter  bool // Per-key window offset (fixed_window only)
+	Storage       storage.Storage
+	Clock         clock.Clock // Time source of the limiter, nil means the system clock
+	Logger        *slog.Logger
 }
 
 // NewRateLimiter creates a new rate limiter based on the algorithm type
@@ -36,11 +53,24 @@ func NewRateLimiter(config LimiterConfig) (interfaces.RateLimiter, error) {
 	}
 
 	if config.Limit <= 0 {
-		return nil, fmt.Errorf("limit must be greater than 0, got %d", config.Limit)
+		return nil, fmt.Errorf("%w: limit must be greater than 0, got %d", ErrInvalidConfig, config.Limit)
 	}
 
 	if config.Window <= 0 {
-		return nil, fmt.Errorf("window must be greater than 0, got %v", config.Window)
+		return nil, fmt.Errorf("%w: window must be greater than 0, got %v", ErrInvalidConfig, config.Window)
+	}
+
+	if config.Burst < 0 {
+		return nil, fmt.Errorf("%w: burst must not be negative, got %d", ErrInvalidConfig, config.Burst)
+	}
+
+	if config.QueueCapacity < 0 {
+		return nil, fmt.Errorf("%w: queue capacity must not be negative, got %d", ErrInvalidConfig, config.QueueCapacity)
+	}
+
+	// GCRA spaces requests and the leaky bucket drains them by window / limit, which must not round down to zero
+	if (config.Algorithm == AlgorithmGCRA || config.Algorithm == AlgorithmLeakyBucket) && config.Window/time.Duration(config.Limit) == 0 {
+		return nil, fmt.Errorf("%w: window %v is shorter than 1ns per request for limit %d", ErrInvalidConfig, config.Window, config.Limit)
 	}
 
 	switch config.Algorithm {
@@ -49,6 +79,8 @@ func NewRateLimiter(config LimiterConfig) (interfaces.RateLimiter, error) {
 			config.Storage,
 			config.Limit,
 			config.Window,
+			config.Burst,
+			config.Clock,
 			config.Logger,
 		), nil
 	case AlgorithmSlidingWindow:
@@ -56,9 +88,77 @@ func NewRateLimiter(config LimiterConfig) (interfaces.RateLimiter, error) {
 			config.Storage,
 			config.Limit,
 			config.Window,
+			config.Clock,
+			config.Logger,
+		), nil
+	case AlgorithmFixedWindow:
+		return services.NewFixedWindowLimiter(
+			config.Storage,
+			config.Limit,
+			config.Window,
+			config.WindowJitter,
+			config.Clock,
+			config.Logger,
+		), nil
+	case AlgorithmSlidingWindowCounter:
+		return services.NewSlidingWindowCounterLimiter(
+			config.Storage,
+			config.Limit,
+			config.Window,
+			config.Clock,
+			config.Logger,
+		), nil
+	case AlgorithmGCRA:
+		return services.NewGCRALimiter(
+			config.Storage,
+			config.Limit,
+			config.Window,
+			config.Burst,
+			config.Clock,
+			config.Logger,
+		), nil
+	case AlgorithmLeakyBucket:
+		return services.NewLeakyBucketLimiter(
+			config.Storage,
+			config.Limit,
+			config.Window,
+			config.QueueCapacity,
+			config.Clock,
 			config.Logger,
 		), nil
 	default:
 		return nil, fmt.Errorf("unsupported algorithm: %s", config.Algorithm)
 	}
 }
+
+// ConcurrencyConfig holds configuration for creating a concurrency limiter
+type ConcurrencyConfig struct {
+	Limit    int           // Leases held at once per key
+	LeaseTTL time.Duration // Time after which an unreleased lease frees its slot
+	Storage  storage.Storage
+	Clock    clock.Clock // Time source of the limiter, nil means the system clock
+	Logger   *slog.Logger
+}
+
+// NewConcurrencyLimiter creates a new concurrency limiter
+func NewConcurrencyLimiter(config ConcurrencyConfig) (interfaces.ConcurrencyLimiter, error) {
+	if config.Storage == nil {
+		return nil, fmt.Errorf("storage is required")
+	}
+
+	if config.Limit <= 0 {
+		return nil, fmt.Errorf("%w: limit must be greater than 0, got %d", ErrInvalidConfig, config.Limit)
+	}
+
+	if config.LeaseTTL <= 0 {
+		return nil, fmt.Errorf("%w: lease TTL must be greater than 0, got %v", ErrInvalidConfig, config.LeaseTTL)
+	}
+
+	return services.NewConcurrencyLimiter(
+		config.Storage,
+		config.Limit,
+		config.LeaseTTL,
+		config.Clock,
+		config.Logger,
+	), nil
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"testing"
@@ -12,7 +13,7 @@ import (
 
 func TestNewRateLimiter_TokenBucket(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
+	memStorage := storage.NewMemoryStorage(nil, logger)
 
 	limiter, err := NewRateLimiter(LimiterConfig{
 		Algorithm: AlgorithmTokenBucket,
@@ -43,7 +44,7 @@ func TestNewRateLimiter_TokenBucket(t *testing.T) {
 
 func TestNewRateLimiter_SlidingWindow(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
+	memStorage := storage.NewMemoryStorage(nil, logger)
 
 	limiter, err := NewRateLimiter(LimiterConfig{
 		Algorithm: AlgorithmSlidingWindow,
@@ -72,9 +73,135 @@ func TestNewRateLimiter_SlidingWindow(t *testing.T) {
 	}
 }
 
+func TestNewRateLimiter_FixedWindow(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+
+	limiter, err := NewRateLimiter(LimiterConfig{
+		Algorithm:    AlgorithmFixedWindow,
+		Limit:        5,
+		Window:       time.Second,
+		WindowJitter: true,
+		Storage:      memStorage,
+		Logger:       logger,
+	})
+
+	if err != nil {
+		t.Fatalf("NewRateLimiter failed: %v", err)
+	}
+
+	if limiter == nil {
+		t.Fatal("Limiter should not be nil")
+	}
+
+	// Test that it works
+	ctx := context.Background()
+	allowed, err := limiter.Allow(ctx, "test-key")
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if !allowed {
+		t.Error("First request should be allowed")
+	}
+}
+
+func TestNewRateLimiter_SlidingWindowCounter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+
+	limiter, err := NewRateLimiter(LimiterConfig{
+		Algorithm: AlgorithmSlidingWindowCounter,
+		Limit:     5,
+		Window:    time.Second,
+		Storage:   memStorage,
+		Logger:    logger,
+	})
+
+	if err != nil {
+		t.Fatalf("NewRateLimiter failed: %v", err)
+	}
+
+	if limiter == nil {
+		t.Fatal("Limiter should not be nil")
+	}
+
+	// Test that it works
+	ctx := context.Background()
+	allowed, err := limiter.Allow(ctx, "test-key")
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if !allowed {
+		t.Error("First request should be allowed")
+	}
+}
+
+func TestNewRateLimiter_GCRA(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+
+	limiter, err := NewRateLimiter(LimiterConfig{
+		Algorithm: AlgorithmGCRA,
+		Limit:     5,
+		Window:    time.Second,
+		Burst:     2,
+		Storage:   memStorage,
+		Logger:    logger,
+	})
+
+	if err != nil {
+		t.Fatalf("NewRateLimiter failed: %v", err)
+	}
+
+	if limiter == nil {
+		t.Fatal("Limiter should not be nil")
+	}
+
+	// Test that it works
+	ctx := context.Background()
+	allowed, err := limiter.Allow(ctx, "test-key")
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if !allowed {
+		t.Error("First request should be allowed")
+	}
+}
+
+func TestNewRateLimiter_LeakyBucket(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+
+	limiter, err := NewRateLimiter(LimiterConfig{
+		Algorithm:     AlgorithmLeakyBucket,
+		Limit:         5,
+		Window:        time.Second,
+		QueueCapacity: 2,
+		Storage:       memStorage,
+		Logger:        logger,
+	})
+
+	if err != nil {
+		t.Fatalf("NewRateLimiter failed: %v", err)
+	}
+
+	// Test that it works and reports the queue state
+	ctx := context.Background()
+	decision, err := limiter.Decide(ctx, "test-key", 1)
+	if err != nil {
+		t.Fatalf("Decide failed: %v", err)
+	}
+	if !decision.Allowed {
+		t.Error("First request should be allowed")
+	}
+	if decision.Limit != 2 {
+		t.Errorf("Expected limit to report the queue capacity 2, got %d", decision.Limit)
+	}
+}
+
 func TestNewRateLimiter_InvalidAlgorithm(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
+	memStorage := storage.NewMemoryStorage(nil, logger)
 
 	_, err := NewRateLimiter(LimiterConfig{
 		Algorithm: AlgorithmType("invalid"),
@@ -91,7 +218,7 @@ func TestNewRateLimiter_InvalidAlgorithm(t *testing.T) {
 
 func TestNewRateLimiter_InvalidLimit(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
+	memStorage := storage.NewMemoryStorage(nil, logger)
 
 	_, err := NewRateLimiter(LimiterConfig{
 		Algorithm: AlgorithmTokenBucket,
@@ -108,7 +235,7 @@ func TestNewRateLimiter_InvalidLimit(t *testing.T) {
 
 func TestNewRateLimiter_InvalidWindow(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
+	memStorage := storage.NewMemoryStorage(nil, logger)
 
 	_, err := NewRateLimiter(LimiterConfig{
 		Algorithm: AlgorithmTokenBucket,
@@ -138,3 +265,124 @@ func TestNewRateLimiter_NilStorage(t *testing.T) {
 		t.Error("Expected error for nil storage")
 	}
 }
+
+func TestNewRateLimiter_NegativeBurst(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+
+	_, err := NewRateLimiter(LimiterConfig{
+		Algorithm: AlgorithmGCRA,
+		Limit:     5,
+		Window:    time.Second,
+		Burst:     -1,
+		Storage:   memStorage,
+		Logger:    logger,
+	})
+
+	if err == nil {
+		t.Error("Expected error for negative burst")
+	}
+}
+
+func TestNewRateLimiter_NegativeQueueCapacity(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+
+	_, err := NewRateLimiter(LimiterConfig{
+		Algorithm:     AlgorithmLeakyBucket,
+		Limit:         5,
+		Window:        time.Second,
+		QueueCapacity: -1,
+		Storage:       memStorage,
+		Logger:        logger,
+	})
+
+	if err == nil {
+		t.Error("Expected error for negative queue capacity")
+	}
+}
+
+func TestNewRateLimiter_GCRAZeroEmissionInterval(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+
+	// 1ms for 2,000,000 requests rounds the emission interval down to 0
+	_, err := NewRateLimiter(LimiterConfig{
+		Algorithm: AlgorithmGCRA,
+		Limit:     2000000,
+		Window:    time.Millisecond,
+		Storage:   memStorage,
+		Logger:    logger,
+	})
+
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a zero emission interval, got %v", err)
+	}
+}
+
+func TestNewRateLimiter_LeakyBucketZeroDrainInterval(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+
+	// 1ms for 2,000,000 requests rounds the drain interval down to 0
+	_, err := NewRateLimiter(LimiterConfig{
+		Algorithm: AlgorithmLeakyBucket,
+		Limit:     2000000,
+		Window:    time.Millisecond,
+		Storage:   memStorage,
+		Logger:    logger,
+	})
+
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a zero drain interval, got %v", err)
+	}
+}
+
+func TestNewConcurrencyLimiter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+
+	limiter, err := NewConcurrencyLimiter(ConcurrencyConfig{
+		Limit:    1,
+		LeaseTTL: time.Minute,
+		Storage:  memStorage,
+		Logger:   logger,
+	})
+
+	if err != nil {
+		t.Fatalf("NewConcurrencyLimiter failed: %v", err)
+	}
+
+	// Test that it works
+	ctx := context.Background()
+	lease, acquired, err := limiter.Acquire(ctx, "test-key")
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if !acquired {
+		t.Fatal("First lease should be acquired")
+	}
+	released, err := limiter.Release(ctx, "test-key", lease.ID)
+	if err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if !released {
+		t.Error("Lease should be released")
+	}
+}
+
+func TestNewConcurrencyLimiter_InvalidLeaseTTL(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+
+	_, err := NewConcurrencyLimiter(ConcurrencyConfig{
+		Limit:    1,
+		LeaseTTL: 0,
+		Storage:  memStorage,
+		Logger:   logger,
+	})
+
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for zero lease TTL, got %v", err)
+	}
+}
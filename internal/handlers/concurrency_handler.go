@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/service"
+)
+
+// ConcurrencyHandler handles concurrency lease requests
+type ConcurrencyHandler struct {
+	service *service.RateLimiterService
+	logger  *slog.Logger
+}
+
+// NewConcurrencyHandler creates a new concurrency handler
+func NewConcurrencyHandler(svc *service.RateLimiterService, logger *slog.Logger) *ConcurrencyHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &ConcurrencyHandler{
+		service: svc,
+		logger:  logger,
+	}
+}
+
+// Acquire handles POST /api/v1/concurrency/acquire
+func (h *ConcurrencyHandler) Acquire(w http.ResponseWriter, r *http.Request) {
+	var req service.AcquireLeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("Invalid request body", "error", err, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if req.Key == "" {
+		h.logger.Warn("Missing key in request", "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "Key is required"})
+		return
+	}
+
+	response, err := h.service.AcquireLease(r.Context(), &req)
+	if errors.Is(err, service.ErrInvalidLimiterConfig) {
+		h.logger.Warn("Invalid lease configuration in request", "error", err, "key", req.Key, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrOverridesForbidden) {
+		h.logger.Warn("Lease overrides in request", "error", err, "key", req.Key, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to acquire lease", "error", err, "key", req.Key)
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	statusCode := http.StatusOK
+	if !response.Acquired {
+		statusCode = http.StatusTooManyRequests
+		h.logger.Info("Concurrency limit reached", "key", req.Key)
+	}
+
+	render.Status(r, statusCode)
+	render.JSON(w, r, response)
+}
+
+// Release handles POST /api/v1/concurrency/release
+func (h *ConcurrencyHandler) Release(w http.ResponseWriter, r *http.Request) {
+	var req service.ReleaseLeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("Invalid request body", "error", err, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if req.Key == "" || req.LeaseID == "" {
+		h.logger.Warn("Missing key or lease ID in request", "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "Key and lease_id are required"})
+		return
+	}
+
+	response, err := h.service.ReleaseLease(r.Context(), &req)
+	if err != nil {
+		h.logger.Error("Failed to release lease", "error", err, "key", req.Key)
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	statusCode := http.StatusOK
+	if !response.Released {
+		statusCode = http.StatusNotFound
+	}
+
+	render.Status(r, statusCode)
+	render.JSON(w, r, response)
+}
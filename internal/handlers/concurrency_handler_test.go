@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/metrics"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/service"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+func TestConcurrencyHandler_AcquireStatus(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.Config{
+		Limiter: config.LimiterConfig{
+			DefaultAlgorithm:   "token_bucket",
+			DefaultLimit:       2,
+			DefaultWindow:      time.Minute,
+			DefaultConcurrency: 1,
+			LeaseTTL:           time.Minute,
+		},
+	}
+	svc, err := service.NewRateLimiterService(storage.NewMemoryStorage(nil, logger), cfg, metrics.NewCollector(), nil, logger)
+	if err != nil {
+		t.Fatalf("NewRateLimiterService failed: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+	handler := NewConcurrencyHandler(svc, logger)
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{"unparsable ttl", `{"key":"job","ttl":"abc"}`, http.StatusBadRequest},
+		{"negative ttl", `{"key":"job","ttl":"-1m"}`, http.StatusBadRequest},
+		{"negative limit", `{"key":"job","limit":-1}`, http.StatusBadRequest},
+		{"acquired", `{"key":"job"}`, http.StatusOK},
+		{"limit reached", `{"key":"job"}`, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/concurrency/acquire", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.Acquire(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -4,22 +4,52 @@ import (
 	"net/http"
 
 	"github.com/go-chi/render"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/breaker"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/service"
 )
 
 // HealthHandler handles health check requests
-type HealthHandler struct{}
+type HealthHandler struct {
+	service *service.RateLimiterService
+}
 
 // NewHealthHandler creates a new health handler
-func NewHealthHandler() *HealthHandler {
-	return &HealthHandler{}
+func NewHealthHandler(svc *service.RateLimiterService) *HealthHandler {
+	return &HealthHandler{service: svc}
 }
 
-// Check handles GET /health
+// Check handles GET /health.
+// The service reports "degraded" while the storage circuit breaker is not closed,
+// checks are then answered by the failure policy.
+// Storages connecting to a server also report the TLS state negotiated with it.
 func (h *HealthHandler) Check(w http.ResponseWriter, r *http.Request) {
+	state := h.service.BreakerState()
+	status := "ok"
+	if state != breaker.StateClosed {
+		status = "degraded"
+	}
+
+	storageHealth := map[string]interface{}{
+		"circuit_breaker": state.String(),
+	}
+	if tlsState, ok := h.service.StorageTLSState(); ok {
+		tlsHealth := map[string]interface{}{
+			"enabled": tlsState.Enabled,
+		}
+		if tlsState.Enabled {
+			tlsHealth["version"] = tlsState.Version
+			tlsHealth["cipher_suite"] = tlsState.CipherSuite
+			tlsHealth["server_name"] = tlsState.ServerName
+			tlsHealth["client_certificate"] = tlsState.ClientCert
+		}
+		storageHealth["tls"] = tlsHealth
+	}
+
 	render.JSON(w, r, map[string]interface{}{
-		"status":  "ok",
+		"status":  status,
 		"service": "rate-limiter-service",
 		"version": "1.0.0",
+		"storage": storageHealth,
 	})
 }
-
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"log/slog"
@@ -49,9 +51,72 @@ func (h *LimitHandler) CheckLimit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Burst < 0 {
+		h.logger.Warn("Negative burst in request", "burst", req.Burst, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "Burst must not be negative"})
+		return
+	}
+
+	if req.QueueCapacity < 0 {
+		h.logger.Warn("Negative queue capacity in request", "queue_capacity", req.QueueCapacity, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "Queue capacity must not be negative"})
+		return
+	}
+
+	if req.Cost < 0 {
+		h.logger.Warn("Negative cost in request", "cost", req.Cost, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "Cost must not be negative"})
+		return
+	}
+
 	response, err := h.service.CheckLimit(ctx, &req)
 	duration := time.Since(start)
 
+	if errors.Is(err, service.ErrInvalidLimiterConfig) {
+		h.logger.Warn("Invalid limiter configuration in request", "error", err, "key", req.Key, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, service.ErrCostExceedsLimit) {
+		h.logger.Warn("Cost exceeds limit", "error", err, "key", req.Key, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, service.ErrReservedKey) {
+		h.logger.Warn("Reserved key in request", "key", req.Key, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, service.ErrUnknownPolicy) {
+		h.logger.Warn("Unknown policy in request", "policy", req.Policy, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, service.ErrOverridesForbidden) {
+		h.logger.Warn("Limit overrides in request", "error", err, "key", req.Key, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, service.ErrStorageUnavailable) {
+		h.logger.Warn("Storage unavailable", "key", req.Key, "remote_addr", r.RemoteAddr)
+		render.Status(r, http.StatusServiceUnavailable)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
 	if err != nil {
 		h.logger.Error("Failed to check limit",
 			"error", err,
@@ -66,14 +131,20 @@ func (h *LimitHandler) CheckLimit(w http.ResponseWriter, r *http.Request) {
 	statusCode := http.StatusOK
 	if !response.Allowed {
 		statusCode = http.StatusTooManyRequests
+		if response.RetryAfterMs > 0 {
+			// Retry-After is in whole seconds, round up so clients never retry too early
+			w.Header().Set("Retry-After", strconv.FormatInt((response.RetryAfterMs+999)/1000, 10))
+		}
 		h.logger.Info("Rate limit exceeded",
 			"key", req.Key,
+			"policy", req.Policy,
 			"algorithm", req.Algorithm,
 			"duration_ms", duration.Milliseconds(),
 		)
 	} else {
 		h.logger.Debug("Request allowed",
 			"key", req.Key,
+			"policy", req.Policy,
 			"algorithm", req.Algorithm,
 			"duration_ms", duration.Milliseconds(),
 		)
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/service"
+)
+
+// PolicyHandler handles policy catalog requests
+type PolicyHandler struct {
+	service *service.RateLimiterService
+}
+
+// NewPolicyHandler creates a new policy handler
+func NewPolicyHandler(svc *service.RateLimiterService) *PolicyHandler {
+	return &PolicyHandler{service: svc}
+}
+
+// List handles GET /api/v1/policies.
+// It reports the named policies limit checks may reference, and whether they may override them.
+func (h *PolicyHandler) List(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, map[string]interface{}{
+		"policies":         h.service.Policies(),
+		"forbid_overrides": h.service.OverridesForbidden(),
+	})
+}
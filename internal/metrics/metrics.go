@@ -16,6 +16,17 @@ type Collector struct {
 	deniedRequests   *prometheus.CounterVec
 	limitCheckErrors *prometheus.CounterVec
 	requestDuration  *prometheus.HistogramVec
+	leasesAcquired   prometheus.Counter
+	leasesRejected   prometheus.Counter
+	leasesReleased   prometheus.Counter
+	leasesNotFound   prometheus.Counter
+	memoryEvictions  *prometheus.CounterVec
+	memoryKeys       prometheus.Gauge
+	breakerState     *prometheus.GaugeVec
+	degradedChecks   *prometheus.CounterVec
+	storageDuration  *prometheus.HistogramVec
+	storageErrors    *prometheus.CounterVec
+	storagePayload   *prometheus.HistogramVec
 }
 
 // NewCollector creates a new metrics collector
@@ -64,6 +75,80 @@ func NewCollector() *Collector {
 			},
 			[]string{"method", "endpoint", "status"},
 		),
+		leasesAcquired: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "rate_limiter_leases_acquired_total",
+				Help: "Total number of acquired concurrency leases",
+			},
+		),
+		leasesRejected: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "rate_limiter_leases_rejected_total",
+				Help: "Total number of lease requests rejected (concurrency limit reached)",
+			},
+		),
+		leasesReleased: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "rate_limiter_leases_released_total",
+				Help: "Total number of released concurrency leases",
+			},
+		),
+		leasesNotFound: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "rate_limiter_leases_not_found_total",
+				Help: "Total number of releases of unknown or expired leases",
+			},
+		),
+		memoryEvictions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "rate_limiter_memory_evictions_total",
+				Help: "Total number of keys removed by the memory storage (expired or over capacity)",
+			},
+			[]string{"reason"},
+		),
+		memoryKeys: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "rate_limiter_memory_keys",
+				Help: "Number of keys held by the memory storage",
+			},
+		),
+		breakerState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "rate_limiter_storage_breaker_state",
+				Help: "Storage circuit breaker state, 1 for the current state (closed, half_open or open)",
+			},
+			[]string{"state"},
+		),
+		degradedChecks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "rate_limiter_degraded_checks_total",
+				Help: "Total number of limit checks answered by the failure policy instead of the storage",
+			},
+			[]string{"policy"},
+		),
+		storageDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "rate_limiter_storage_operation_duration_seconds",
+				Help:    "Storage operation duration in seconds",
+				Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+			},
+			[]string{"backend", "operation"},
+		),
+		storageErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "rate_limiter_storage_errors_total",
+				Help: "Total number of failed storage operations",
+			},
+			[]string{"backend", "operation"},
+		),
+		storagePayload: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "rate_limiter_storage_payload_bytes",
+				Help:    "Approximate size in bytes of the values read from and written to the storage",
+				Buckets: prometheus.ExponentialBuckets(16, 4, 7),
+			},
+			[]string{"backend", "operation"},
+		),
 	}
 }
 
@@ -75,6 +160,17 @@ func (c *Collector) Register() {
 	prometheus.MustRegister(c.deniedRequests)
 	prometheus.MustRegister(c.limitCheckErrors)
 	prometheus.MustRegister(c.requestDuration)
+	prometheus.MustRegister(c.leasesAcquired)
+	prometheus.MustRegister(c.leasesRejected)
+	prometheus.MustRegister(c.leasesReleased)
+	prometheus.MustRegister(c.leasesNotFound)
+	prometheus.MustRegister(c.memoryEvictions)
+	prometheus.MustRegister(c.memoryKeys)
+	prometheus.MustRegister(c.breakerState)
+	prometheus.MustRegister(c.degradedChecks)
+	prometheus.MustRegister(c.storageDuration)
+	prometheus.MustRegister(c.storageErrors)
+	prometheus.MustRegister(c.storagePayload)
 }
 
 // IncTotalRequests increments the total requests counter
@@ -107,6 +203,62 @@ func (c *Collector) ObserveRequestDuration(duration time.Duration, method, endpo
 	c.requestDuration.WithLabelValues(method, endpoint, status).Observe(duration.Seconds())
 }
 
+// IncLeasesAcquired increments the acquired leases counter
+func (c *Collector) IncLeasesAcquired() {
+	c.leasesAcquired.Inc()
+}
+
+// IncLeasesRejected increments the rejected leases counter
+func (c *Collector) IncLeasesRejected() {
+	c.leasesRejected.Inc()
+}
+
+// IncLeasesReleased increments the released leases counter
+func (c *Collector) IncLeasesReleased() {
+	c.leasesReleased.Inc()
+}
+
+// IncLeasesNotFound increments the counter of releases of unknown or expired leases
+func (c *Collector) IncLeasesNotFound() {
+	c.leasesNotFound.Inc()
+}
+
+// IncMemoryEvictions increments the memory storage evictions counter
+func (c *Collector) IncMemoryEvictions(reason string) {
+	c.memoryEvictions.WithLabelValues(reason).Inc()
+}
+
+// SetMemoryKeys sets the number of keys held by the memory storage
+func (c *Collector) SetMemoryKeys(count int) {
+	c.memoryKeys.Set(float64(count))
+}
+
+// SetBreakerState marks state as the current storage circuit breaker state
+func (c *Collector) SetBreakerState(state string) {
+	c.breakerState.Reset()
+	c.breakerState.WithLabelValues(state).Set(1)
+}
+
+// IncDegradedChecks increments the counter of checks answered by the failure policy
+func (c *Collector) IncDegradedChecks(policy string) {
+	c.degradedChecks.WithLabelValues(policy).Inc()
+}
+
+// ObserveStorageOperation records the duration of a storage operation
+func (c *Collector) ObserveStorageOperation(backend, operation string, duration time.Duration) {
+	c.storageDuration.WithLabelValues(backend, operation).Observe(duration.Seconds())
+}
+
+// IncStorageErrors increments the failed storage operations counter
+func (c *Collector) IncStorageErrors(backend, operation string) {
+	c.storageErrors.WithLabelValues(backend, operation).Inc()
+}
+
+// ObserveStoragePayload records the size of a value read from or written to the storage
+func (c *Collector) ObserveStoragePayload(backend, operation string, bytes int64) {
+	c.storagePayload.WithLabelValues(backend, operation).Observe(float64(bytes))
+}
+
 // Handler returns the HTTP handler for metrics endpoint
 func (c *Collector) Handler() http.Handler {
 	return promhttp.Handler()
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
+)
+
+// concurrencyMetricsLabel identifies concurrency limiter errors in the check error metrics
+const concurrencyMetricsLabel = "concurrency"
+
+// AcquireLeaseRequest represents a request to take a concurrency slot
+type AcquireLeaseRequest struct {
+	Key   string `json:"key"`
+	Limit int    `json:"limit,omitempty"` // Optional: overrides default concurrency
+	TTL   string `json:"ttl,omitempty"`   // Optional: overrides default lease TTL (e.g., "30s", "5m")
+}
+
+// AcquireLeaseResponse represents the response from acquiring a concurrency slot
+type AcquireLeaseResponse struct {
+	Acquired  bool   `json:"acquired"`
+	LeaseID   string `json:"lease_id,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// ReleaseLeaseRequest represents a request to free a concurrency slot
+type ReleaseLeaseRequest struct {
+	Key     string `json:"key"`
+	LeaseID string `json:"lease_id"`
+}
+
+// ReleaseLeaseResponse represents the response from releasing a concurrency slot
+type ReleaseLeaseResponse struct {
+	Released bool   `json:"released"`
+	Message  string `json:"message,omitempty"`
+}
+
+// AcquireLease takes a concurrency slot for the key if one is free
+func (s *RateLimiterService) AcquireLease(ctx context.Context, req *AcquireLeaseRequest) (*AcquireLeaseResponse, error) {
+	if s.config.Limiter.ForbidOverrides {
+		if overrides := leaseOverrides(req); len(overrides) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrOverridesForbidden, strings.Join(overrides, ", "))
+		}
+	}
+
+	// Determine limit
+	limit := req.Limit
+	if limit == 0 {
+		limit = s.config.Limiter.DefaultConcurrency
+	}
+
+	// Determine lease TTL
+	ttl := s.config.Limiter.LeaseTTL
+	if req.TTL != "" {
+		parsedTTL, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid lease TTL %q: %v", ErrInvalidLimiterConfig, req.TTL, err)
+		}
+		ttl = parsedTTL
+	}
+
+	limiterInstance, err := s.concurrencyLimiter(limit, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	lease, acquired, err := limiterInstance.Acquire(ctx, req.Key)
+	if err != nil {
+		s.metricsCollector.IncLimitCheckErrors(concurrencyMetricsLabel)
+		s.logger.Error("Failed to acquire lease", "error", err, "key", req.Key)
+		return nil, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+
+	if !acquired {
+		s.metricsCollector.IncLeasesRejected()
+		return &AcquireLeaseResponse{
+			Acquired: false,
+			Message:  "Concurrency limit reached",
+		}, nil
+	}
+
+	s.metricsCollector.IncLeasesAcquired()
+	return &AcquireLeaseResponse{
+		Acquired:  true,
+		LeaseID:   lease.ID,
+		ExpiresAt: lease.ExpiresAt.Unix(),
+	}, nil
+}
+
+// leaseOverrides lists the JSON fields of req overriding the concurrency defaults
+func leaseOverrides(req *AcquireLeaseRequest) []string {
+	var overrides []string
+	if req.Limit != 0 {
+		overrides = append(overrides, "limit")
+	}
+	if req.TTL != "" {
+		overrides = append(overrides, "ttl")
+	}
+	return overrides
+}
+
+// ReleaseLease frees the concurrency slot held by a lease
+func (s *RateLimiterService) ReleaseLease(ctx context.Context, req *ReleaseLeaseRequest) (*ReleaseLeaseResponse, error) {
+	// The limit and TTL only matter when acquiring, any valid values do for releasing
+	limiterInstance, err := s.concurrencyLimiter(1, time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	released, err := limiterInstance.Release(ctx, req.Key, req.LeaseID)
+	if err != nil {
+		s.metricsCollector.IncLimitCheckErrors(concurrencyMetricsLabel)
+		s.logger.Error("Failed to release lease", "error", err, "key", req.Key)
+		return nil, fmt.Errorf("failed to release lease: %w", err)
+	}
+
+	if !released {
+		s.metricsCollector.IncLeasesNotFound()
+		return &ReleaseLeaseResponse{
+			Released: false,
+			Message:  "Lease not found or expired",
+		}, nil
+	}
+
+	s.metricsCollector.IncLeasesReleased()
+	return &ReleaseLeaseResponse{Released: true}, nil
+}
+
+// concurrencyLimiter creates a concurrency limiter using the factory
+func (s *RateLimiterService) concurrencyLimiter(limit int, ttl time.Duration) (interfaces.ConcurrencyLimiter, error) {
+	limiterInstance, err := internal.NewConcurrencyLimiter(internal.ConcurrencyConfig{
+		Limit:    limit,
+		LeaseTTL: ttl,
+		Storage:  s.storage,
+		Clock:    s.clock,
+		Logger:   s.logger,
+	})
+	if errors.Is(err, ErrInvalidLimiterConfig) {
+		return nil, err
+	}
+	if err != nil {
+		s.logger.Error("Failed to create concurrency limiter", "error", err)
+		return nil, fmt.Errorf("failed to create concurrency limiter: %w", err)
+	}
+	return limiterInstance, nil
+}
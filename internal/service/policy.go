@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// ErrUnknownPolicy is returned when a limit check references a policy missing from the catalog
+var ErrUnknownPolicy = errors.New("unknown policy")
+
+// ErrOverridesForbidden is returned when a limit check sets its own limits while overrides are disabled
+var ErrOverridesForbidden = errors.New("limit overrides are not allowed")
+
+// Policy represents a named policy of the catalog, with the limiter defaults applied
+type Policy struct {
+	Name          string `json:"name"`
+	Algorithm     string `json:"algorithm"`
+	Limit         int    `json:"limit"`
+	Window        string `json:"window"`
+	Burst         int    `json:"burst,omitempty"`
+	QueueCapacity int    `json:"queue_capacity,omitempty"`
+}
+
+// newPolicyCatalog resolves the configured policies against the limiter defaults.
+// Policy names are case-insensitive, as the configuration loader lowercases map keys.
+// An invalid policy fails the whole catalog, so that a typo cannot silently disable a limit.
+func newPolicyCatalog(cfg config.LimiterConfig) (map[string]config.PolicyConfig, error) {
+	catalog := make(map[string]config.PolicyConfig, len(cfg.Policies))
+	for name, policy := range cfg.Policies {
+		if policy.Algorithm == "" {
+			policy.Algorithm = cfg.DefaultAlgorithm
+		}
+		if policy.Limit == 0 {
+			policy.Limit = cfg.DefaultLimit
+		}
+		if policy.Window == 0 {
+			policy.Window = cfg.DefaultWindow
+		}
+
+		if err := validatePolicy(policy); err != nil {
+			return nil, fmt.Errorf("invalid rate limit policy %q: %w", name, err)
+		}
+		catalog[strings.ToLower(name)] = policy
+	}
+	return catalog, nil
+}
+
+// validatePolicy checks a policy resolved against the limiter defaults, applying the rules of the limiter factory
+func validatePolicy(policy config.PolicyConfig) error {
+	algorithm, err := parseAlgorithm(policy.Algorithm)
+	if err != nil {
+		return err
+	}
+	if policy.Limit <= 0 {
+		return fmt.Errorf("limit must be positive, got %d", policy.Limit)
+	}
+	if policy.Window <= 0 {
+		return fmt.Errorf("window must be positive, got %s", policy.Window)
+	}
+	if policy.Burst < 0 {
+		return fmt.Errorf("burst must not be negative, got %d", policy.Burst)
+	}
+	if policy.QueueCapacity < 0 {
+		return fmt.Errorf("queue capacity must not be negative, got %d", policy.QueueCapacity)
+	}
+	if (algorithm == internal.AlgorithmGCRA || algorithm == internal.AlgorithmLeakyBucket) && policy.Window/time.Duration(policy.Limit) == 0 {
+		return fmt.Errorf("window %s is shorter than 1ns per request for limit %d", policy.Window, policy.Limit)
+	}
+	return nil
+}
+
+// parseAlgorithm converts an algorithm name of the API or configuration to its AlgorithmType
+func parseAlgorithm(name string) (internal.AlgorithmType, error) {
+	switch name {
+	case "token_bucket":
+		return internal.AlgorithmTokenBucket, nil
+	case "sliding_window":
+		return internal.AlgorithmSlidingWindow, nil
+	case "fixed_window":
+		return internal.AlgorithmFixedWindow, nil
+	case "sliding_window_counter":
+		return internal.AlgorithmSlidingWindowCounter, nil
+	case "gcra":
+		return internal.AlgorithmGCRA, nil
+	case "leaky_bucket":
+		return internal.AlgorithmLeakyBucket, nil
+	default:
+		return "", fmt.Errorf("unsupported algorithm: %s", name)
+	}
+}
+
+// Policies returns the policy catalog sorted by name
+func (s *RateLimiterService) Policies() []Policy {
+	policies := make([]Policy, 0, len(s.policies))
+	for name, policy := range s.policies {
+		policies = append(policies, Policy{
+			Name:          name,
+			Algorithm:     policy.Algorithm,
+			Limit:         policy.Limit,
+			Window:        policy.Window.String(),
+			Burst:         policy.Burst,
+			QueueCapacity: policy.QueueCapacity,
+		})
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies
+}
+
+// OverridesForbidden reports whether limit checks setting their own algorithm, limit, window, burst or queue capacity are rejected
+func (s *RateLimiterService) OverridesForbidden() bool {
+	return s.config.Limiter.ForbidOverrides
+}
+
+// resolvePolicy determines the settings of a limit check: the limiter defaults,
+// replaced by the referenced policy, replaced by the fields set in the request unless overrides are forbidden
+func (s *RateLimiterService) resolvePolicy(req *CheckLimitRequest) (config.PolicyConfig, error) {
+	if s.config.Limiter.ForbidOverrides {
+		if overrides := requestOverrides(req); len(overrides) > 0 {
+			return config.PolicyConfig{}, fmt.Errorf("%w: %s", ErrOverridesForbidden, strings.Join(overrides, ", "))
+		}
+	}
+
+	settings := config.PolicyConfig{
+		Algorithm: s.config.Limiter.DefaultAlgorithm,
+		Limit:     s.config.Limiter.DefaultLimit,
+		Window:    s.config.Limiter.DefaultWindow,
+	}
+	if req.Policy != "" {
+		policy, ok := s.policies[strings.ToLower(req.Policy)]
+		if !ok {
+			return config.PolicyConfig{}, fmt.Errorf("%w: %s", ErrUnknownPolicy, req.Policy)
+		}
+		settings = policy
+	}
+
+	if req.Algorithm != "" {
+		settings.Algorithm = req.Algorithm
+	}
+	if req.Limit != 0 {
+		settings.Limit = req.Limit
+	}
+	if req.Window != "" {
+		window, err := time.ParseDuration(req.Window)
+		if err != nil {
+			return config.PolicyConfig{}, fmt.Errorf("invalid window duration: %w", err)
+		}
+		settings.Window = window
+	}
+	if req.Burst != 0 {
+		settings.Burst = req.Burst
+	}
+	if req.QueueCapacity != 0 {
+		settings.QueueCapacity = req.QueueCapacity
+	}
+	return settings, nil
+}
+
+// requestOverrides lists the JSON fields of req overriding the policy
+func requestOverrides(req *CheckLimitRequest) []string {
+	var overrides []string
+	if req.Algorithm != "" {
+		overrides = append(overrides, "algorithm")
+	}
+	if req.Limit != 0 {
+		overrides = append(overrides, "limit")
+	}
+	if req.Window != "" {
+		overrides = append(overrides, "window")
+	}
+	if req.Burst != 0 {
+		overrides = append(overrides, "burst")
+	}
+	if req.QueueCapacity != 0 {
+		overrides = append(overrides, "queue_capacity")
+	}
+	return overrides
+}
@@ -2,133 +2,329 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/breaker"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/metrics"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
 )
 
+// Failure policies applied to limit checks when the storage fails or the circuit breaker is open
+const (
+	// FailurePolicyError returns the error to the caller
+	FailurePolicyError = "error"
+	// FailurePolicyOpen allows the request
+	FailurePolicyOpen = "open"
+	// FailurePolicyClosed denies the request
+	FailurePolicyClosed = "closed"
+	// FailurePolicyLocal checks the limit against in-memory storage local to the instance
+	FailurePolicyLocal = "local"
+)
+
+// ErrCostExceedsLimit is returned when a request costs more units than the limit can ever grant
+var ErrCostExceedsLimit = errors.New("cost exceeds limit")
+
+// ErrInvalidLimiterConfig is returned when the limit, window, burst or queue capacity of a check,
+// or the limit or TTL of a lease, cannot build a limiter
+var ErrInvalidLimiterConfig = internal.ErrInvalidConfig
+
+// ErrReservedKey is returned when a limit check uses a key of the keyspace reserved for internal state
+var ErrReservedKey = errors.New("key uses a reserved prefix")
+
+// ErrStorageUnavailable is returned when the circuit breaker is open and the failure policy is "error"
+var ErrStorageUnavailable = errors.New("storage unavailable")
+
 // RateLimiterService handles rate limiting logic
 type RateLimiterService struct {
 	storage          storage.Storage
+	fallback         storage.Storage // Local storage of the "local" failure policy
+	policies         map[string]config.PolicyConfig
+	breaker          *breaker.CircuitBreaker
 	config           *config.Config
 	metricsCollector *metrics.Collector
+	clock            clock.Clock
 	logger           *slog.Logger
 }
 
-// NewRateLimiterService creates a new rate limiter service
+// NewRateLimiterService creates a new rate limiter service.
+// Limiters, the circuit breaker and degraded decisions read the time from clk, the system clock if nil.
 func NewRateLimiterService(
 	storage storage.Storage,
 	cfg *config.Config,
 	metricsCollector *metrics.Collector,
+	clk clock.Clock,
 	logger *slog.Logger,
-) *RateLimiterService {
+) (*RateLimiterService, error) {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	return &RateLimiterService{
+	if clk == nil {
+		clk = clock.System()
+	}
+	switch cfg.Storage.FailurePolicy {
+	case "", FailurePolicyError, FailurePolicyOpen, FailurePolicyClosed, FailurePolicyLocal:
+	default:
+		return nil, fmt.Errorf("unsupported failure policy: %q", cfg.Storage.FailurePolicy)
+	}
+
+	policies, err := newPolicyCatalog(cfg.Limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &RateLimiterService{
 		storage:          storage,
 		config:           cfg,
+		policies:         policies,
 		metricsCollector: metricsCollector,
+		clock:            clk,
 		logger:           logger,
 	}
+
+	s.breaker = breaker.New(cfg.Storage.BreakerThreshold, cfg.Storage.BreakerCooldown, clk, func(from, to breaker.State) {
+		logger.Warn("Storage circuit breaker state changed", "from", from.String(), "to", to.String())
+		metricsCollector.SetBreakerState(to.String())
+	})
+	metricsCollector.SetBreakerState(breaker.StateClosed.String())
+
+	if cfg.Storage.FailurePolicy == FailurePolicyLocal {
+		s.fallback = s.newFallbackStorage()
+	}
+	return s, nil
+}
+
+// newFallbackStorage creates the local storage of the "local" failure policy,
+// bounded like the memory storage
+func (s *RateLimiterService) newFallbackStorage() storage.Storage {
+	fallback, err := storage.NewMemoryStorageWithConfig(s.config.Storage, nil, s.clock, s.logger)
+	if err != nil {
+		s.logger.Error("Invalid memory storage configuration, using unbounded fallback storage", "error", err)
+		return storage.NewMemoryStorage(s.clock, s.logger)
+	}
+	return fallback
+}
+
+// BreakerState returns the state of the storage circuit breaker
+func (s *RateLimiterService) BreakerState() breaker.State {
+	return s.breaker.State()
+}
+
+// StorageTLSState returns the TLS state of the storage connections,
+// false if the storage does not connect to a server
+func (s *RateLimiterService) StorageTLSState() (storage.TLSState, bool) {
+	return storage.ReportedTLSState(s.storage)
+}
+
+// Close releases the local fallback storage
+func (s *RateLimiterService) Close() error {
+	if s.fallback != nil {
+		return s.fallback.Close()
+	}
+	return nil
 }
 
 // CheckLimitRequest represents a request to check rate limit
 type CheckLimitRequest struct {
-	Key       string `json:"key"`
-	Algorithm string `json:"algorithm,omitempty"` // Optional: overrides default
-	Limit     int    `json:"limit,omitempty"`     // Optional: overrides default
-	Window    string `json:"window,omitempty"`    // Optional: overrides default (e.g., "1m", "30s")
+	Key           string `json:"key"`
+	Policy        string `json:"policy,omitempty"`         // Optional: named policy of the catalog, instead of the defaults
+	Algorithm     string `json:"algorithm,omitempty"`      // Optional: overrides default
+	Limit         int    `json:"limit,omitempty"`          // Optional: overrides default
+	Window        string `json:"window,omitempty"`         // Optional: overrides default (e.g., "1m", "30s")
+	Burst         int    `json:"burst,omitempty"`          // Optional: requests allowed at once (token_bucket, gcra)
+	QueueCapacity int    `json:"queue_capacity,omitempty"` // Optional: requests allowed to wait (leaky_bucket)
+	Cost          int    `json:"cost,omitempty"`           // Optional: units consumed by the request, defaults to 1
 }
 
-// CheckLimitResponse represents the response from rate limit check
+// CheckLimitResponse represents the response from rate limit check.
+// It mirrors the limiter decision field by field.
 type CheckLimitResponse struct {
-	Allowed   bool   `json:"allowed"`
-	Remaining int    `json:"remaining,omitempty"`
-	ResetAt   int64  `json:"reset_at,omitempty"`
-	Message   string `json:"message,omitempty"`
+	Allowed      bool   `json:"allowed"`
+	Limit        int    `json:"limit"`
+	Remaining    int    `json:"remaining"`
+	ResetAt      int64  `json:"reset_at"`                 // Unix time when the full limit is available again
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"` // Wait before a denied request may succeed
+	DelayMs      int64  `json:"delay_ms,omitempty"`       // Wait before proceeding (leaky_bucket)
+	Degraded     bool   `json:"degraded,omitempty"`       // Answered by the failure policy instead of the storage
+	Message      string `json:"message,omitempty"`
 }
 
 // CheckLimit checks if a request should be allowed based on rate limiting rules
 func (s *RateLimiterService) CheckLimit(ctx context.Context, req *CheckLimitRequest) (*CheckLimitResponse, error) {
-	// Determine algorithm
-	algorithmStr := req.Algorithm
-	if algorithmStr == "" {
-		algorithmStr = s.config.Limiter.DefaultAlgorithm
-	}
-
-	// Convert string to AlgorithmType
-	var algorithm internal.AlgorithmType
-	switch algorithmStr {
-	case "token_bucket":
-		algorithm = internal.AlgorithmTokenBucket
-	case "sliding_window":
-		algorithm = internal.AlgorithmSlidingWindow
-	default:
-		return nil, fmt.Errorf("unsupported algorithm: %s", algorithmStr)
+	// Leases and other internal state live under the reserved prefix
+	if strings.HasPrefix(req.Key, storage.ReservedKeyPrefix) {
+		return nil, fmt.Errorf("%w %q: %s", ErrReservedKey, storage.ReservedKeyPrefix, req.Key)
 	}
 
-	// Determine limit
-	limit := req.Limit
-	if limit == 0 {
-		limit = s.config.Limiter.DefaultLimit
+	// Determine algorithm, limit, window and burst
+	settings, err := s.resolvePolicy(req)
+	if err != nil {
+		return nil, err
+	}
+	algorithmStr := settings.Algorithm
+	algorithm, err := parseAlgorithm(algorithmStr)
+	if err != nil {
+		return nil, err
 	}
+	limit := settings.Limit
 
-	// Determine window
-	window := s.config.Limiter.DefaultWindow
-	if req.Window != "" {
-		parsedWindow, err := time.ParseDuration(req.Window)
-		if err != nil {
-			return nil, fmt.Errorf("invalid window duration: %w", err)
-		}
-		window = parsedWindow
+	// Determine cost
+	cost := req.Cost
+	if cost == 0 {
+		cost = 1
+	}
+	// A burst lets a single request spend more than the sustained limit, a leaky bucket holds its queue capacity
+	capacity := limit
+	if settings.Burst > 0 && (algorithm == internal.AlgorithmTokenBucket || algorithm == internal.AlgorithmGCRA) {
+		capacity = settings.Burst
+	}
+	if settings.QueueCapacity > 0 && algorithm == internal.AlgorithmLeakyBucket {
+		capacity = settings.QueueCapacity
+	}
+	if cost > capacity {
+		return nil, fmt.Errorf("%w: cost %d, limit %d", ErrCostExceedsLimit, cost, capacity)
 	}
 
 	// Create limiter using factory
-	limiterInstance, err := internal.NewRateLimiter(internal.LimiterConfig{
-		Algorithm: algorithm,
-		Limit:     limit,
-		Window:    window,
-		Storage:   s.storage,
-		Logger:    s.logger,
-	})
+	limiterConfig := internal.LimiterConfig{
+		Algorithm:     algorithm,
+		Limit:         limit,
+		Window:        settings.Window,
+		Burst:         settings.Burst,
+		QueueCapacity: settings.QueueCapacity,
+		WindowJitter:  s.config.Limiter.FixedWindowJitter,
+		Storage:       s.storage,
+		Clock:         s.clock,
+		Logger:        s.logger,
+	}
+	limiterInstance, err := internal.NewRateLimiter(limiterConfig)
+	if errors.Is(err, ErrInvalidLimiterConfig) {
+		return nil, err
+	}
 	if err != nil {
 		s.logger.Error("Failed to create limiter", "error", err, "algorithm", algorithm)
 		return nil, fmt.Errorf("failed to create limiter: %w", err)
 	}
 
-	// Check limit
-	allowed, err := limiterInstance.Allow(ctx, req.Key)
+	// Check limit, unless the storage is known to be down
+	var decision interfaces.Decision
+	degraded := true
+	if !s.breaker.Allow() {
+		decision, err = s.degrade(ctx, limiterConfig, req.Key, cost, capacity, ErrStorageUnavailable)
+	} else {
+		decision, err = s.decide(ctx, limiterInstance, req.Key, cost)
+		switch {
+		case err == nil:
+			s.breaker.Success()
+			degraded = false
+		case ctx.Err() != nil:
+			// The caller went away, which says nothing about the storage
+			return nil, fmt.Errorf("failed to check limit: %w", err)
+		default:
+			s.breaker.Failure()
+			s.metricsCollector.IncLimitCheckErrors(algorithmStr)
+			s.logger.Error("Failed to check limit", "error", err, "key", req.Key)
+			decision, err = s.degrade(ctx, limiterConfig, req.Key, cost, capacity, fmt.Errorf("failed to check limit: %w", err))
+		}
+	}
 	if err != nil {
-		s.metricsCollector.IncLimitCheckErrors(algorithmStr)
-		s.logger.Error("Failed to check limit", "error", err, "key", req.Key)
-		return nil, fmt.Errorf("failed to check limit: %w", err)
+		return nil, err
 	}
 
 	// Update metrics
-	if allowed {
+	if decision.Allowed {
 		s.metricsCollector.IncAllowedRequests(algorithmStr)
 	} else {
 		s.metricsCollector.IncDeniedRequests(algorithmStr)
 		s.metricsCollector.IncBlockedRequests(algorithmStr, req.Key)
 	}
 
-	// Calculate reset time
-	resetAt := time.Now().Add(window).Unix()
-
 	response := &CheckLimitResponse{
-		Allowed: allowed,
-		ResetAt: resetAt,
+		Allowed:      decision.Allowed,
+		Limit:        decision.Limit,
+		Remaining:    decision.Remaining,
+		ResetAt:      ceilUnix(decision.ResetAt),
+		RetryAfterMs: ceilMilliseconds(decision.RetryAfter),
+		DelayMs:      ceilMilliseconds(decision.Delay),
+		Degraded:     degraded,
 	}
 
-	if !allowed {
+	if !decision.Allowed {
 		response.Message = "Rate limit exceeded"
+		if degraded {
+			response.Message = "Rate limit storage unavailable"
+		}
 	}
 
 	return response, nil
 }
+
+// decide checks the limit against the storage within the configured storage timeout
+func (s *RateLimiterService) decide(ctx context.Context, limiter interfaces.RateLimiter, key string, cost int) (interfaces.Decision, error) {
+	if timeout := s.config.Storage.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return limiter.Decide(ctx, key, cost)
+}
+
+// degrade answers a check the storage could not, according to the failure policy.
+// The "error" policy returns err.
+func (s *RateLimiterService) degrade(
+	ctx context.Context,
+	limiterConfig internal.LimiterConfig,
+	key string,
+	cost int,
+	capacity int,
+	err error,
+) (interfaces.Decision, error) {
+	now := s.clock.Now()
+	policy := s.config.Storage.FailurePolicy
+
+	switch policy {
+	case FailurePolicyOpen:
+		s.metricsCollector.IncDegradedChecks(policy)
+		// Nothing is known to be consumed
+		return interfaces.Decision{Allowed: true, Limit: capacity, Remaining: capacity, ResetAt: now}, nil
+	case FailurePolicyClosed:
+		s.metricsCollector.IncDegradedChecks(policy)
+		retryAfter := s.breaker.RetryAfter()
+		return interfaces.Decision{Limit: capacity, ResetAt: now.Add(retryAfter), RetryAfter: retryAfter}, nil
+	case FailurePolicyLocal:
+		s.metricsCollector.IncDegradedChecks(policy)
+		limiterConfig.Storage = s.fallback
+		limiterInstance, err := internal.NewRateLimiter(limiterConfig)
+		if err != nil {
+			return interfaces.Decision{}, fmt.Errorf("failed to create local limiter: %w", err)
+		}
+		decision, err := limiterInstance.Decide(ctx, key, cost)
+		if err != nil {
+			return interfaces.Decision{}, fmt.Errorf("failed to check local limit: %w", err)
+		}
+		return decision, nil
+	default:
+		return interfaces.Decision{}, err
+	}
+}
+
+// ceilUnix converts t to Unix seconds, rounding up so clients never retry too early
+func ceilUnix(t time.Time) int64 {
+	seconds := t.Unix()
+	if t.Nanosecond() > 0 {
+		seconds++
+	}
+	return seconds
+}
+
+// ceilMilliseconds converts d to milliseconds, rounding up so clients never wait too little
+func ceilMilliseconds(d time.Duration) int64 {
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
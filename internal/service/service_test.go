@@ -0,0 +1,450 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/breaker"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/metrics"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// failingStorage fails every call, or blocks until the context is done when slow is set
+type failingStorage struct {
+	calls atomic.Int64
+	slow  bool
+}
+
+func (f *failingStorage) fail(ctx context.Context) error {
+	f.calls.Add(1)
+	if f.slow {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return errors.New("connection refused")
+}
+
+func (f *failingStorage) Get(ctx context.Context, key string) (interface{}, error) {
+	return nil, f.fail(ctx)
+}
+
+func (f *failingStorage) Set(ctx context.Context, key string, value interface{}, expiration int64) error {
+	return f.fail(ctx)
+}
+
+func (f *failingStorage) Delete(ctx context.Context, key string) error {
+	return f.fail(ctx)
+}
+
+func (f *failingStorage) Update(ctx context.Context, key string, fn storage.UpdateFunc) error {
+	return f.fail(ctx)
+}
+
+func (f *failingStorage) Close() error {
+	return nil
+}
+
+func newTestService(t *testing.T, s storage.Storage, storageConfig config.StorageConfig, clk clock.Clock) *RateLimiterService {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.Config{
+		Storage: storageConfig,
+		Limiter: config.LimiterConfig{
+			DefaultAlgorithm: "token_bucket",
+			DefaultLimit:     2,
+			DefaultWindow:    time.Minute,
+		},
+	}
+	svc, err := NewRateLimiterService(s, cfg, metrics.NewCollector(), clk, logger)
+	if err != nil {
+		t.Fatalf("NewRateLimiterService failed: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+	return svc
+}
+
+func TestRateLimiterService_FailurePolicies(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("error", func(t *testing.T) {
+		svc := newTestService(t, &failingStorage{}, config.StorageConfig{FailurePolicy: FailurePolicyError}, nil)
+		if _, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: "key"}); err == nil {
+			t.Error("Expected storage error to be returned")
+		}
+	})
+
+	t.Run("open", func(t *testing.T) {
+		svc := newTestService(t, &failingStorage{}, config.StorageConfig{FailurePolicy: FailurePolicyOpen}, nil)
+		response, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: "key"})
+		if err != nil {
+			t.Fatalf("CheckLimit failed: %v", err)
+		}
+		if !response.Allowed || !response.Degraded {
+			t.Errorf("Expected degraded allowed response, got %+v", response)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		svc := newTestService(t, &failingStorage{}, config.StorageConfig{FailurePolicy: FailurePolicyClosed}, nil)
+		response, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: "key"})
+		if err != nil {
+			t.Fatalf("CheckLimit failed: %v", err)
+		}
+		if response.Allowed || !response.Degraded {
+			t.Errorf("Expected degraded denied response, got %+v", response)
+		}
+	})
+
+	t.Run("local", func(t *testing.T) {
+		svc := newTestService(t, &failingStorage{}, config.StorageConfig{FailurePolicy: FailurePolicyLocal}, nil)
+		for i, expected := range []bool{true, true, false} {
+			response, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: "key"})
+			if err != nil {
+				t.Fatalf("CheckLimit failed: %v", err)
+			}
+			if response.Allowed != expected || !response.Degraded {
+				t.Errorf("Check %d: expected degraded allowed=%v, got %+v", i+1, expected, response)
+			}
+		}
+	})
+}
+
+func TestRateLimiterService_DegradedDecisionsUseClock(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Unix(1_000, 0))
+	svc := newTestService(t, &failingStorage{}, config.StorageConfig{
+		FailurePolicy:    FailurePolicyClosed,
+		BreakerThreshold: 1,
+		BreakerCooldown:  10 * time.Second,
+	}, clk)
+
+	// The failing check opens the breaker, which is retried after the cooldown
+	response, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: "key"})
+	if err != nil {
+		t.Fatalf("CheckLimit failed: %v", err)
+	}
+	if response.ResetAt != 1_010 || response.RetryAfterMs != 10_000 {
+		t.Errorf("Expected reset at 1010 after 10s, got %+v", response)
+	}
+
+	clk.Advance(4 * time.Second)
+	response, err = svc.CheckLimit(ctx, &CheckLimitRequest{Key: "key"})
+	if err != nil {
+		t.Fatalf("CheckLimit failed: %v", err)
+	}
+	if response.ResetAt != 1_010 || response.RetryAfterMs != 6_000 || !response.Degraded {
+		t.Errorf("Expected degraded reset at 1010 after 6s, got %+v", response)
+	}
+}
+
+func TestNewRateLimiterService_UnsupportedFailurePolicy(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.Config{Storage: config.StorageConfig{FailurePolicy: "fail-open"}}
+
+	if _, err := NewRateLimiterService(storage.NewMemoryStorage(nil, logger), cfg, metrics.NewCollector(), nil, logger); err == nil {
+		t.Error("Expected an unsupported failure policy to be rejected")
+	}
+}
+
+func TestNewRateLimiterService_InvalidPolicy(t *testing.T) {
+	tests := map[string]config.PolicyConfig{
+		"unknown algorithm":    {Algorithm: "unknown"},
+		"negative limit":       {Limit: -1},
+		"negative burst":       {Burst: -1},
+		"negative queue":       {Algorithm: "leaky_bucket", QueueCapacity: -1},
+		"gcra sub-nanosecond":  {Algorithm: "gcra", Limit: 2000000, Window: time.Millisecond},
+		"leaky sub-nanosecond": {Algorithm: "leaky_bucket", Limit: 2000000, Window: time.Millisecond},
+	}
+	for name, policy := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := &config.Config{
+				Limiter: config.LimiterConfig{
+					DefaultAlgorithm: "token_bucket",
+					DefaultLimit:     2,
+					DefaultWindow:    time.Minute,
+					Policies:         map[string]config.PolicyConfig{"broken": policy},
+				},
+			}
+			if _, err := NewRateLimiterService(storage.NewMemoryStorage(nil, nil), cfg, metrics.NewCollector(), nil, nil); err == nil {
+				t.Errorf("Expected an error for policy %+v", policy)
+			}
+		})
+	}
+}
+
+func TestRateLimiterService_InvalidLimiterConfig(t *testing.T) {
+	svc := newTestService(t, storage.NewMemoryStorage(nil, nil), config.StorageConfig{}, nil)
+
+	_, err := svc.CheckLimit(context.Background(), &CheckLimitRequest{Key: "key", Algorithm: "gcra", Limit: 2000000, Window: "1ms"})
+	if !errors.Is(err, ErrInvalidLimiterConfig) {
+		t.Errorf("Expected ErrInvalidLimiterConfig, got %v", err)
+	}
+}
+
+func TestRateLimiterService_CostExceedsCapacity(t *testing.T) {
+	svc := newTestService(t, storage.NewMemoryStorage(nil, nil), config.StorageConfig{}, nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		req     *CheckLimitRequest
+		exceeds bool
+	}{
+		{"limit", &CheckLimitRequest{Key: "limit", Limit: 10, Cost: 11}, true},
+		{"burst", &CheckLimitRequest{Key: "burst", Algorithm: "gcra", Limit: 10, Window: "1s", Burst: 20, Cost: 15}, false},
+		{"queue capacity", &CheckLimitRequest{Key: "queue", Algorithm: "leaky_bucket", Limit: 10, QueueCapacity: 2, Cost: 5}, true},
+		{"queue capacity fits", &CheckLimitRequest{Key: "queue-fits", Algorithm: "leaky_bucket", Limit: 10, QueueCapacity: 2, Cost: 2}, false},
+		{"default queue capacity", &CheckLimitRequest{Key: "queue-default", Algorithm: "leaky_bucket", Limit: 10, Cost: 10}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CheckLimit(ctx, tt.req)
+			if exceeds := errors.Is(err, ErrCostExceedsLimit); exceeds != tt.exceeds {
+				t.Errorf("Expected ErrCostExceedsLimit=%v, got %v", tt.exceeds, err)
+			}
+			if !tt.exceeds && err != nil {
+				t.Errorf("CheckLimit failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestRateLimiterService_CircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	failing := &failingStorage{}
+	svc := newTestService(t, failing, config.StorageConfig{
+		FailurePolicy:    FailurePolicyError,
+		BreakerThreshold: 3,
+		BreakerCooldown:  time.Minute,
+	}, nil)
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: "key"}); err == nil || errors.Is(err, ErrStorageUnavailable) {
+			t.Fatalf("Check %d: expected storage error, got %v", i+1, err)
+		}
+	}
+	if svc.BreakerState() != breaker.StateOpen {
+		t.Fatalf("Expected breaker to open, got %s", svc.BreakerState())
+	}
+
+	// The open breaker answers without calling the storage
+	if _, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: "key"}); !errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("Expected ErrStorageUnavailable, got %v", err)
+	}
+	if calls := failing.calls.Load(); calls != 3 {
+		t.Errorf("Expected 3 storage calls, got %d", calls)
+	}
+}
+
+func TestRateLimiterService_StorageTimeout(t *testing.T) {
+	slow := &failingStorage{slow: true}
+	svc := newTestService(t, slow, config.StorageConfig{
+		Timeout:          20 * time.Millisecond,
+		FailurePolicy:    FailurePolicyOpen,
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Minute,
+	}, nil)
+
+	start := time.Now()
+	response, err := svc.CheckLimit(context.Background(), &CheckLimitRequest{Key: "key"})
+	if err != nil {
+		t.Fatalf("CheckLimit failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected check to time out quickly, took %v", elapsed)
+	}
+	if !response.Allowed || !response.Degraded {
+		t.Errorf("Expected degraded allowed response, got %+v", response)
+	}
+	if svc.BreakerState() != breaker.StateOpen {
+		t.Errorf("Expected timeout to count as a failure, got %s", svc.BreakerState())
+	}
+
+	// A caller that gives up is not a storage failure
+	canceled := newTestService(t, slow, config.StorageConfig{BreakerThreshold: 1, BreakerCooldown: time.Minute}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := canceled.CheckLimit(ctx, &CheckLimitRequest{Key: "key"}); err == nil {
+		t.Error("Expected error for canceled check")
+	}
+	if canceled.BreakerState() != breaker.StateClosed {
+		t.Errorf("Expected breaker to stay closed, got %s", canceled.BreakerState())
+	}
+}
+
+func TestRateLimiterService_Policies(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	newService := func(forbidOverrides bool) *RateLimiterService {
+		cfg := &config.Config{
+			Limiter: config.LimiterConfig{
+				DefaultAlgorithm:   "token_bucket",
+				DefaultLimit:       2,
+				DefaultWindow:      time.Minute,
+				DefaultConcurrency: 1,
+				LeaseTTL:           time.Minute,
+				Policies: map[string]config.PolicyConfig{
+					"free":    {Limit: 3},
+					"premium": {Algorithm: "gcra", Limit: 10, Window: time.Second, Burst: 5},
+				},
+				ForbidOverrides: forbidOverrides,
+			},
+		}
+		svc, err := NewRateLimiterService(storage.NewMemoryStorage(nil, logger), cfg, metrics.NewCollector(), nil, logger)
+		if err != nil {
+			t.Fatalf("NewRateLimiterService failed: %v", err)
+		}
+		t.Cleanup(func() { svc.Close() })
+		return svc
+	}
+	ctx := context.Background()
+
+	svc := newService(false)
+	policies := svc.Policies()
+	if len(policies) != 2 || policies[0].Name != "free" || policies[1].Name != "premium" {
+		t.Fatalf("Expected the policies sorted by name, got %+v", policies)
+	}
+	if free := policies[0]; free.Algorithm != "token_bucket" || free.Limit != 3 || free.Window != "1m0s" {
+		t.Errorf("Expected free to default to the limiter algorithm and window, got %+v", free)
+	}
+
+	// Checks referencing a policy use its limit
+	for i, expected := range []bool{true, true, true, false} {
+		response, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: "free-user", Policy: "Free"})
+		if err != nil {
+			t.Fatalf("CheckLimit failed: %v", err)
+		}
+		if response.Allowed != expected || response.Limit != 3 {
+			t.Errorf("Check %d: expected allowed=%v with limit 3, got %+v", i+1, expected, response)
+		}
+	}
+	if _, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: "key", Policy: "missing"}); !errors.Is(err, ErrUnknownPolicy) {
+		t.Errorf("Expected ErrUnknownPolicy for a missing policy, got %v", err)
+	}
+
+	// Overrides apply on top of the policy unless forbidden
+	response, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: "override", Policy: "free", Limit: 50})
+	if err != nil {
+		t.Fatalf("CheckLimit failed: %v", err)
+	}
+	if response.Limit != 50 {
+		t.Errorf("Expected the limit override to apply, got %+v", response)
+	}
+
+	locked := newService(true)
+	for _, req := range []*CheckLimitRequest{
+		{Key: "key", Limit: 1000000},
+		{Key: "key", Policy: "free", Window: "1h"},
+		{Key: "key", Policy: "premium", Algorithm: "fixed_window"},
+		{Key: "key", Policy: "premium", Burst: 1000},
+	} {
+		if _, err := locked.CheckLimit(ctx, req); !errors.Is(err, ErrOverridesForbidden) {
+			t.Errorf("Expected ErrOverridesForbidden for %+v, got %v", req, err)
+		}
+	}
+	for _, req := range []*AcquireLeaseRequest{
+		{Key: "job", Limit: 100},
+		{Key: "job", TTL: "24h"},
+	} {
+		if _, err := locked.AcquireLease(ctx, req); !errors.Is(err, ErrOverridesForbidden) {
+			t.Errorf("Expected ErrOverridesForbidden for %+v, got %v", req, err)
+		}
+	}
+	lease, err := locked.AcquireLease(ctx, &AcquireLeaseRequest{Key: "job"})
+	if err != nil {
+		t.Fatalf("AcquireLease failed: %v", err)
+	}
+	if !lease.Acquired {
+		t.Errorf("Expected a lease with the default concurrency, got %+v", lease)
+	}
+
+	response, err = locked.CheckLimit(ctx, &CheckLimitRequest{Key: "premium-user", Policy: "premium", Cost: 5})
+	if err != nil {
+		t.Fatalf("CheckLimit failed: %v", err)
+	}
+	if !response.Allowed {
+		t.Errorf("Expected the policy burst to admit a cost of 5, got %+v", response)
+	}
+}
+
+func TestRateLimiterService_LeasesApartFromLimitKeys(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	mr := miniredis.RunT(t)
+	redisStorage, err := storage.NewRedisStorage(config.StorageConfig{RedisAddress: mr.Addr()}, logger)
+	if err != nil {
+		t.Fatalf("NewRedisStorage failed: %v", err)
+	}
+	storages := map[string]storage.Storage{
+		"memory": storage.NewMemoryStorage(nil, logger),
+		"redis":  redisStorage,
+	}
+	ctx := context.Background()
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			cfg := &config.Config{
+				Limiter: config.LimiterConfig{
+					DefaultAlgorithm:   "token_bucket",
+					DefaultLimit:       2,
+					DefaultWindow:      time.Minute,
+					DefaultConcurrency: 1,
+					LeaseTTL:           time.Minute,
+				},
+			}
+			svc, err := NewRateLimiterService(s, cfg, metrics.NewCollector(), nil, logger)
+			if err != nil {
+				t.Fatalf("NewRateLimiterService failed: %v", err)
+			}
+			t.Cleanup(func() { svc.Close() })
+
+			lease, err := svc.AcquireLease(ctx, &AcquireLeaseRequest{Key: "victim"})
+			if err != nil {
+				t.Fatalf("AcquireLease failed: %v", err)
+			}
+			if !lease.Acquired {
+				t.Fatalf("Expected the first lease to be acquired, got %+v", lease)
+			}
+
+			// Limit checks cannot address the lease set, under the old layout or the reserved one
+			if _, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: "concurrency:{victim}"}); err != nil {
+				t.Fatalf("CheckLimit failed: %v", err)
+			}
+			for _, key := range []string{storage.ReservedKeyPrefix + "concurrency:{victim}", storage.ReservedKeyPrefix} {
+				if _, err := svc.CheckLimit(ctx, &CheckLimitRequest{Key: key}); !errors.Is(err, ErrReservedKey) {
+					t.Errorf("Expected ErrReservedKey for %q, got %v", key, err)
+				}
+			}
+
+			second, err := svc.AcquireLease(ctx, &AcquireLeaseRequest{Key: "victim"})
+			if err != nil {
+				t.Fatalf("AcquireLease failed: %v", err)
+			}
+			if second.Acquired {
+				t.Errorf("Expected the lease to survive the limit check and deny a second one, got %+v", second)
+			}
+		})
+	}
+}
+
+func TestRateLimiterService_InvalidLease(t *testing.T) {
+	svc := newTestService(t, storage.NewMemoryStorage(nil, nil), config.StorageConfig{}, nil)
+	ctx := context.Background()
+
+	for _, req := range []*AcquireLeaseRequest{
+		{Key: "job", TTL: "abc"},
+		{Key: "job", TTL: "-1m"},
+		{Key: "job", TTL: "0s"},
+		{Key: "job", Limit: -1},
+	} {
+		if _, err := svc.AcquireLease(ctx, req); !errors.Is(err, ErrInvalidLimiterConfig) {
+			t.Errorf("Expected ErrInvalidLimiterConfig for %+v, got %v", req, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
+)
+
+// allowNTestLimiters creates limiters of every algorithm allowing 10 units
+func allowNTestLimiters(clk clock.Clock, logger *slog.Logger) map[string]func(storage.Storage) interfaces.RateLimiter {
+	return map[string]func(storage.Storage) interfaces.RateLimiter{
+		"token_bucket": func(s storage.Storage) interfaces.RateLimiter {
+			return NewTokenBucketLimiter(s, 10, time.Hour, 0, clk, logger)
+		},
+		"sliding_window": func(s storage.Storage) interfaces.RateLimiter {
+			return NewSlidingWindowLimiter(s, 10, time.Hour, clk, logger)
+		},
+		"fixed_window": func(s storage.Storage) interfaces.RateLimiter {
+			return NewFixedWindowLimiter(s, 10, 24*time.Hour, false, clk, logger)
+		},
+		"sliding_window_counter": func(s storage.Storage) interfaces.RateLimiter {
+			return NewSlidingWindowCounterLimiter(s, 10, 24*time.Hour, clk, logger)
+		},
+		"gcra": func(s storage.Storage) interfaces.RateLimiter {
+			return NewGCRALimiter(s, 10, time.Hour, 0, clk, logger)
+		},
+		"leaky_bucket": func(s storage.Storage) interfaces.RateLimiter {
+			return NewLeakyBucketLimiter(s, 10, time.Hour, 0, clk, logger)
+		},
+	}
+}
+
+func TestAllowN(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	// A stopped clock keeps refills and drains out of the measurement
+	clk := clock.NewFake(time.Now())
+	algorithms := allowNTestLimiters(clk, logger)
+
+	steps := []struct {
+		cost    int
+		allowed bool
+	}{
+		{cost: 7, allowed: true},
+		{cost: 4, allowed: false}, // 7 + 4 exceeds the limit of 10
+		{cost: 3, allowed: true},  // The denied request consumed nothing
+		{cost: 1, allowed: false},
+	}
+
+	for name, newLimiter := range algorithms {
+		for storageName, store := range counterTestStorages(t, clk, logger) {
+			t.Run(name+"/"+storageName, func(t *testing.T) {
+				limiter := newLimiter(store)
+				ctx := context.Background()
+
+				for i, step := range steps {
+					allowed, err := limiter.AllowN(ctx, "weighted", step.cost)
+					if err != nil {
+						t.Fatalf("AllowN failed: %v", err)
+					}
+					if allowed != step.allowed {
+						t.Errorf("Step %d (cost %d): expected allowed=%v, got %v", i+1, step.cost, step.allowed, allowed)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestAllowN_InvalidCost(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	clk := clock.NewFake(time.Now())
+
+	for name, newLimiter := range allowNTestLimiters(clk, logger) {
+		for storageName, store := range counterTestStorages(t, clk, logger) {
+			t.Run(name+"/"+storageName, func(t *testing.T) {
+				limiter := newLimiter(store)
+				ctx := context.Background()
+
+				// A negative cost must not create capacity
+				for _, cost := range []int{-10, 0} {
+					if _, err := limiter.Decide(ctx, "invalid", cost); !errors.Is(err, storage.ErrInvalidCost) {
+						t.Errorf("Expected ErrInvalidCost for cost %d, got %v", cost, err)
+					}
+					if _, err := limiter.AllowN(ctx, "invalid", cost); !errors.Is(err, storage.ErrInvalidCost) {
+						t.Errorf("Expected ErrInvalidCost from AllowN for cost %d, got %v", cost, err)
+					}
+				}
+
+				decision, err := limiter.Decide(ctx, "invalid", 10)
+				if err != nil {
+					t.Fatalf("Decide failed: %v", err)
+				}
+				if !decision.Allowed || decision.Remaining != 0 {
+					t.Errorf("Expected the full limit of 10 and nothing more, got %+v", decision)
+				}
+				if allowed, err := limiter.Allow(ctx, "invalid"); err != nil || allowed {
+					t.Errorf("Expected the limit to be exhausted, got allowed=%v (%v)", allowed, err)
+				}
+			})
+		}
+	}
+}
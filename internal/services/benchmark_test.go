@@ -2,18 +2,20 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
 )
 
 func BenchmarkTokenBucket_Allow(b *testing.B) {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
-	limiter := NewTokenBucketLimiter(memStorage, 1000, time.Second, logger)
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewTokenBucketLimiter(memStorage, 1000, time.Second, 0, nil, logger)
 	ctx := context.Background()
 
 	b.ResetTimer()
@@ -27,8 +29,8 @@ func BenchmarkTokenBucket_Allow(b *testing.B) {
 
 func BenchmarkSlidingWindow_Allow(b *testing.B) {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
-	limiter := NewSlidingWindowLimiter(memStorage, 1000, time.Second, logger)
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewSlidingWindowLimiter(memStorage, 1000, time.Second, nil, logger)
 	ctx := context.Background()
 
 	b.ResetTimer()
@@ -42,8 +44,8 @@ func BenchmarkSlidingWindow_Allow(b *testing.B) {
 
 func BenchmarkTokenBucket_Allow_DifferentKeys(b *testing.B) {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
-	limiter := NewTokenBucketLimiter(memStorage, 100, time.Second, logger)
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewTokenBucketLimiter(memStorage, 100, time.Second, 0, nil, logger)
 	ctx := context.Background()
 
 	b.ResetTimer()
@@ -59,8 +61,8 @@ func BenchmarkTokenBucket_Allow_DifferentKeys(b *testing.B) {
 
 func BenchmarkSlidingWindow_Allow_DifferentKeys(b *testing.B) {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
-	limiter := NewSlidingWindowLimiter(memStorage, 100, time.Second, logger)
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewSlidingWindowLimiter(memStorage, 100, time.Second, nil, logger)
 	ctx := context.Background()
 
 	b.ResetTimer()
@@ -73,3 +75,117 @@ func BenchmarkSlidingWindow_Allow_DifferentKeys(b *testing.B) {
 		}
 	})
 }
+
+// encodedStateStorage stores limiter state encoded by a state codec, as serializing backends do,
+// to measure what skipping the encoding saves and what each codec costs
+type encodedStateStorage struct {
+	storage.Storage
+	codec storage.StateCodec
+}
+
+// newEncodedStateStorage wraps memory storage with the named state codec
+func newEncodedStateStorage(b *testing.B, codec string, logger *slog.Logger) encodedStateStorage {
+	stateCodec, err := storage.NewStateCodec(codec)
+	if err != nil {
+		b.Fatalf("NewStateCodec failed: %v", err)
+	}
+	return encodedStateStorage{Storage: storage.NewMemoryStorage(nil, logger), codec: stateCodec}
+}
+
+func (e encodedStateStorage) Update(ctx context.Context, key string, fn storage.UpdateFunc) error {
+	return e.Storage.Update(ctx, key, func(current interface{}) (interface{}, int64, error) {
+		value, expiration, err := fn(current)
+		if err != nil {
+			return nil, 0, err
+		}
+		encoded, err := e.codec.Encode(value)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to encode state: %w", err)
+		}
+		return string(encoded), expiration, nil
+	})
+}
+
+// benchmarkAllow runs Allow in parallel over the given number of keys
+func benchmarkAllow(b *testing.B, limiter interfaces.RateLimiter, prefix string, keys int) {
+	ctx := context.Background()
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s:%d", prefix, i)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _ = limiter.Allow(ctx, names[i%keys])
+			i++
+		}
+	})
+}
+
+func BenchmarkTokenBucket_Allow_JSONState(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	jsonStorage := newEncodedStateStorage(b, storage.StateCodecJSON, logger)
+	benchmarkAllow(b, NewTokenBucketLimiter(jsonStorage, 1000, time.Second, 0, nil, logger), "bench:token-bucket", 1)
+}
+
+func BenchmarkTokenBucket_Allow_Sharded(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	shardedStorage := storage.NewShardedMemoryStorage(0, nil, logger)
+	benchmarkAllow(b, NewTokenBucketLimiter(shardedStorage, 1000, time.Second, 0, nil, logger), "bench:token-bucket", 1)
+}
+
+func BenchmarkSlidingWindow_Allow_JSONState(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	jsonStorage := newEncodedStateStorage(b, storage.StateCodecJSON, logger)
+	benchmarkAllow(b, NewSlidingWindowLimiter(jsonStorage, 1000, time.Second, nil, logger), "bench:sliding-window", 1)
+}
+
+func BenchmarkSlidingWindow_Allow_Sharded(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	shardedStorage := storage.NewShardedMemoryStorage(0, nil, logger)
+	benchmarkAllow(b, NewSlidingWindowLimiter(shardedStorage, 1000, time.Second, nil, logger), "bench:sliding-window", 1)
+}
+
+func BenchmarkTokenBucket_Allow_DifferentKeys_JSONState(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	jsonStorage := newEncodedStateStorage(b, storage.StateCodecJSON, logger)
+	benchmarkAllow(b, NewTokenBucketLimiter(jsonStorage, 100, time.Second, 0, nil, logger), "bench:token-bucket", 1000)
+}
+
+func BenchmarkTokenBucket_Allow_DifferentKeys_Sharded(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	shardedStorage := storage.NewShardedMemoryStorage(0, nil, logger)
+	benchmarkAllow(b, NewTokenBucketLimiter(shardedStorage, 100, time.Second, 0, nil, logger), "bench:token-bucket", 1000)
+}
+
+func BenchmarkSlidingWindow_Allow_DifferentKeys_JSONState(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	jsonStorage := newEncodedStateStorage(b, storage.StateCodecJSON, logger)
+	benchmarkAllow(b, NewSlidingWindowLimiter(jsonStorage, 100, time.Second, nil, logger), "bench:sliding-window", 1000)
+}
+
+func BenchmarkSlidingWindow_Allow_DifferentKeys_Sharded(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	shardedStorage := storage.NewShardedMemoryStorage(0, nil, logger)
+	benchmarkAllow(b, NewSlidingWindowLimiter(shardedStorage, 100, time.Second, nil, logger), "bench:sliding-window", 1000)
+}
+
+func BenchmarkTokenBucket_Allow_BinaryState(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	binaryStorage := newEncodedStateStorage(b, storage.StateCodecBinary, logger)
+	benchmarkAllow(b, NewTokenBucketLimiter(binaryStorage, 1000, time.Second, 0, nil, logger), "bench:token-bucket", 1)
+}
+
+func BenchmarkSlidingWindow_Allow_BinaryState(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	binaryStorage := newEncodedStateStorage(b, storage.StateCodecBinary, logger)
+	benchmarkAllow(b, NewSlidingWindowLimiter(binaryStorage, 1000, time.Second, nil, logger), "bench:sliding-window", 1)
+}
+
+func BenchmarkSlidingWindow_Allow_DifferentKeys_BinaryState(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	binaryStorage := newEncodedStateStorage(b, storage.StateCodecBinary, logger)
+	benchmarkAllow(b, NewSlidingWindowLimiter(binaryStorage, 100, time.Second, nil, logger), "bench:sliding-window", 1000)
+}
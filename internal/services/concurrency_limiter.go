@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
+)
+
+// concurrencyKeyPrefix keeps lease sets in the reserved keyspace, apart from rate limiter state of any key.
+// The key itself is hash tagged, so lease set and rate limiter state of a key share a Redis Cluster slot.
+const concurrencyKeyPrefix = storage.ReservedKeyPrefix + "concurrency:"
+
+// ConcurrencyLimiter caps the number of operations in flight per key
+// Every acquired slot is a lease with a TTL, so slots of crashed clients are freed automatically
+type ConcurrencyLimiter struct {
+	storage  storage.Storage
+	limit    int
+	leaseTTL time.Duration
+	clock    clock.Clock
+	logger   *slog.Logger
+}
+
+// NewConcurrencyLimiter creates a new concurrency limiter
+func NewConcurrencyLimiter(
+	storage storage.Storage,
+	limit int,
+	leaseTTL time.Duration,
+	clk clock.Clock,
+	logger *slog.Logger,
+) *ConcurrencyLimiter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if clk == nil {
+		clk = clock.System()
+	}
+	return &ConcurrencyLimiter{
+		storage:  storage,
+		limit:    limit,
+		leaseTTL: leaseTTL,
+		clock:    clk,
+		logger:   logger,
+	}
+}
+
+// concurrencyState represents the leases held for a key
+type concurrencyState struct {
+	Leases map[string]int64 `json:"leases"` // Lease ID to expiration, Unix timestamp in nanoseconds
+}
+
+// Acquire takes a slot for key if fewer than limit leases are held
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context, key string) (interfaces.Lease, bool, error) {
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		c.logger.Warn("Acquire operation cancelled", "key", key, "error", ctx.Err())
+		return interfaces.Lease{}, false, ctx.Err()
+	default:
+	}
+
+	leaseID, err := newLeaseID()
+	if err != nil {
+		c.logger.Error("Failed to generate lease ID", "key", key, "error", err)
+		return interfaces.Lease{}, false, err
+	}
+
+	lease, acquired, err := c.acquireAt(ctx, key, leaseID, c.clock.Now())
+	if err != nil {
+		return interfaces.Lease{}, false, err
+	}
+
+	if !acquired {
+		c.logger.Debug("Lease denied: concurrency limit reached", "key", key, "limit", c.limit)
+		return interfaces.Lease{}, false, nil
+	}
+
+	c.logger.Debug("Lease acquired", "key", key, "lease_id", lease.ID, "expires_at", lease.ExpiresAt)
+	return lease, true, nil
+}
+
+// Release frees the slot held by leaseID. It reports false if the lease is unknown or has expired.
+func (c *ConcurrencyLimiter) Release(ctx context.Context, key string, leaseID string) (bool, error) {
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		c.logger.Warn("Release operation cancelled", "key", key, "error", ctx.Err())
+		return false, ctx.Err()
+	default:
+	}
+
+	released, err := c.releaseAt(ctx, key, leaseID, c.clock.Now())
+	if err != nil {
+		return false, err
+	}
+
+	if !released {
+		c.logger.Debug("Lease not found", "key", key, "lease_id", leaseID)
+		return false, nil
+	}
+
+	c.logger.Debug("Lease released", "key", key, "lease_id", leaseID)
+	return true, nil
+}
+
+// acquireAt records leaseID for key at now if a slot is free
+func (c *ConcurrencyLimiter) acquireAt(
+	ctx context.Context,
+	key string,
+	leaseID string,
+	now time.Time,
+) (interfaces.Lease, bool, error) {
+	lease := interfaces.Lease{ID: leaseID, ExpiresAt: now.Add(c.leaseTTL)}
+	storageKey := concurrencyKeyPrefix + storage.HashTag(key)
+
+	// Let the storage manage the leases atomically when it supports it
+	if evaluator, ok := c.storage.(storage.LeaseEvaluator); ok {
+		acquired, err := evaluator.EvalAcquireLease(ctx, storageKey, leaseID, c.limit, lease.ExpiresAt, now)
+		if err != nil {
+			c.logger.Error("Failed to acquire lease", "key", key, "error", err)
+			return interfaces.Lease{}, false, fmt.Errorf("failed to acquire lease: %w", err)
+		}
+		return lease, acquired, nil
+	}
+
+	var acquired bool
+	err := c.storage.Update(ctx, storageKey, func(stateData interface{}) (interface{}, int64, error) {
+		state := c.loadState(key, stateData, now)
+
+		acquired = len(state.Leases) < c.limit
+		if acquired {
+			state.Leases[leaseID] = lease.ExpiresAt.UnixNano()
+		}
+		return c.encodeState(state, now)
+	})
+	if err != nil {
+		c.logger.Error("Failed to update lease state", "key", key, "error", err)
+		return interfaces.Lease{}, false, fmt.Errorf("failed to update lease state: %w", err)
+	}
+
+	return lease, acquired, nil
+}
+
+// releaseAt removes leaseID from key at now
+func (c *ConcurrencyLimiter) releaseAt(ctx context.Context, key string, leaseID string, now time.Time) (bool, error) {
+	storageKey := concurrencyKeyPrefix + storage.HashTag(key)
+
+	// Let the storage manage the leases atomically when it supports it
+	if evaluator, ok := c.storage.(storage.LeaseEvaluator); ok {
+		released, err := evaluator.EvalReleaseLease(ctx, storageKey, leaseID, now)
+		if err != nil {
+			c.logger.Error("Failed to release lease", "key", key, "error", err)
+			return false, fmt.Errorf("failed to release lease: %w", err)
+		}
+		return released, nil
+	}
+
+	var released bool
+	err := c.storage.Update(ctx, storageKey, func(stateData interface{}) (interface{}, int64, error) {
+		state := c.loadState(key, stateData, now)
+
+		_, released = state.Leases[leaseID]
+		delete(state.Leases, leaseID)
+		return c.encodeState(state, now)
+	})
+	if err != nil {
+		c.logger.Error("Failed to update lease state", "key", key, "error", err)
+		return false, fmt.Errorf("failed to update lease state: %w", err)
+	}
+
+	return released, nil
+}
+
+// loadState decodes the leases of key and drops those that expired by now
+func (c *ConcurrencyLimiter) loadState(key string, stateData interface{}, now time.Time) concurrencyState {
+	var state concurrencyState
+	if stateData != nil {
+		if err := decodeState(stateData, &state); err != nil {
+			// If unmarshal fails, start without leases
+			c.logger.Warn("Failed to unmarshal state, dropping leases", "key", key, "error", err)
+			state = concurrencyState{}
+		}
+	}
+
+	// Copy the live leases, in-process storages hand out the stored map itself
+	leases := make(map[string]int64, len(state.Leases))
+	for id, expiresAt := range state.Leases {
+		if expiresAt > now.UnixNano() {
+			leases[id] = expiresAt
+		}
+	}
+	return concurrencyState{Leases: leases}
+}
+
+// encodeState returns the leases to store, expiring the state together with the last lease
+func (c *ConcurrencyLimiter) encodeState(state concurrencyState, now time.Time) (interface{}, int64, error) {
+	lastExpiration := now.UnixNano()
+	for _, expiresAt := range state.Leases {
+		lastExpiration = max(lastExpiration, expiresAt)
+	}
+
+	return state, expirationAt(time.Unix(0, lastExpiration), 0), nil
+}
+
+// newLeaseID returns a random lease identifier
+func newLeaseID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", fmt.Errorf("failed to generate lease ID: %w", err)
+	}
+	return hex.EncodeToString(id[:]), nil
+}
+
+// Ensure ConcurrencyLimiter implements interfaces.ConcurrencyLimiter
+var _ interfaces.ConcurrencyLimiter = (*ConcurrencyLimiter)(nil)
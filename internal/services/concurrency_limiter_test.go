@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+)
+
+func TestConcurrencyLimiter_AcquireRelease(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	clk := clock.NewFake(time.Now())
+	for name, store := range counterTestStorages(t, clk, logger) {
+		t.Run(name, func(t *testing.T) {
+			limiter := NewConcurrencyLimiter(store, 2, time.Minute, clk, logger)
+			ctx := context.Background()
+
+			first, acquired, err := limiter.Acquire(ctx, "key")
+			if err != nil {
+				t.Fatalf("Acquire failed: %v", err)
+			}
+			if !acquired || first.ID == "" {
+				t.Fatalf("First lease should be acquired, got %+v", first)
+			}
+			if _, acquired, _ := limiter.Acquire(ctx, "key"); !acquired {
+				t.Fatal("Second lease should be acquired")
+			}
+
+			// Both slots are taken
+			if _, acquired, _ := limiter.Acquire(ctx, "key"); acquired {
+				t.Error("Third lease should be denied")
+			}
+
+			// Other keys have their own slots
+			if _, acquired, _ := limiter.Acquire(ctx, "other-key"); !acquired {
+				t.Error("Lease for another key should be acquired")
+			}
+
+			released, err := limiter.Release(ctx, "key", first.ID)
+			if err != nil {
+				t.Fatalf("Release failed: %v", err)
+			}
+			if !released {
+				t.Error("First lease should be released")
+			}
+
+			// Releasing twice reports the lease as gone
+			if released, _ := limiter.Release(ctx, "key", first.ID); released {
+				t.Error("Released lease should not be released again")
+			}
+
+			if _, acquired, _ := limiter.Acquire(ctx, "key"); !acquired {
+				t.Error("Lease should be acquired after a release")
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiter_LeaseExpiration(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	clk := clock.NewFake(time.Now())
+	for name, store := range counterTestStorages(t, clk, logger) {
+		t.Run(name, func(t *testing.T) {
+			limiter := NewConcurrencyLimiter(store, 1, 10*time.Second, clk, logger)
+			ctx := context.Background()
+			now := clk.Now()
+
+			crashed, acquired, err := limiter.Acquire(ctx, "key")
+			if err != nil {
+				t.Fatalf("Acquire failed: %v", err)
+			}
+			if !acquired {
+				t.Fatal("Lease should be acquired")
+			}
+			if !crashed.ExpiresAt.Equal(now.Add(10 * time.Second)) {
+				t.Errorf("Expected lease to expire at %v, got %v", now.Add(10*time.Second), crashed.ExpiresAt)
+			}
+
+			clk.Advance(5 * time.Second)
+			if _, acquired, _ := limiter.Acquire(ctx, "key"); acquired {
+				t.Error("Lease should be denied while the slot is held")
+			}
+
+			// The crashed client never releases, its slot frees up once the lease expires
+			clk.Advance(5 * time.Second)
+			if _, acquired, _ := limiter.Acquire(ctx, "key"); !acquired {
+				t.Error("Lease should be acquired after the previous one expired")
+			}
+
+			clk.Advance(time.Second)
+			if released, _ := limiter.Release(ctx, "key", crashed.ID); released {
+				t.Error("Expired lease should not be released")
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiter_ContextCancellation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewConcurrencyLimiter(memStorage, 5, time.Second, nil, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // Cancel immediately
+
+	if _, _, err := limiter.Acquire(ctx, "key"); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := limiter.Release(ctx, "key", "lease"); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
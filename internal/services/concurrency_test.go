@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
+)
+
+const (
+	concurrencyClients    = 4
+	concurrencyGoroutines = 50
+	concurrencyRequests   = 10
+	concurrencyLimit      = 100
+)
+
+// newRedisClients simulates several service replicas sharing one Redis
+func newRedisClients(t *testing.T, logger *slog.Logger) []*storage.RedisStorage {
+	t.Helper()
+	mr := miniredis.RunT(t)
+
+	clients := make([]*storage.RedisStorage, concurrencyClients)
+	for i := range clients {
+		client, err := storage.NewRedisStorage(config.StorageConfig{RedisAddress: mr.Addr()}, logger)
+		if err != nil {
+			t.Fatalf("NewRedisStorage failed: %v", err)
+		}
+		t.Cleanup(func() { client.Close() })
+		clients[i] = client
+	}
+	return clients
+}
+
+// newClusterNodes simulates several service replicas running clustered memory storage,
+// each serving the internal endpoint of its storage on localhost
+func newClusterNodes(t *testing.T, logger *slog.Logger) []*storage.ClusterStorage {
+	t.Helper()
+	servers := make([]*httptest.Server, concurrencyClients)
+	peers := make([]string, concurrencyClients)
+	for i := range servers {
+		servers[i] = httptest.NewUnstartedServer(nil)
+		peers[i] = servers[i].Listener.Addr().String()
+	}
+
+	nodes := make([]*storage.ClusterStorage, concurrencyClients)
+	for i, server := range servers {
+		node, err := storage.NewClusterStorage(config.StorageConfig{
+			ClusterAdvertiseAddress: peers[i],
+			ClusterPeers:            peers,
+			ClusterSecret:           "secret",
+		}, nil, nil, logger)
+		if err != nil {
+			t.Fatalf("NewClusterStorage failed: %v", err)
+		}
+		server.Config.Handler = node.Handler()
+		server.Start()
+		t.Cleanup(func() {
+			server.Close()
+			node.Close()
+		})
+		nodes[i] = node
+	}
+	return nodes
+}
+
+// runConcurrently hammers one key from many goroutines and returns the number of allowed requests
+func runConcurrently(t *testing.T, limiters []interfaces.RateLimiter) int64 {
+	t.Helper()
+	ctx := context.Background()
+
+	var allowedCount atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < concurrencyGoroutines; g++ {
+		wg.Add(1)
+		go func(limiter interfaces.RateLimiter) {
+			defer wg.Done()
+			for i := 0; i < concurrencyRequests; i++ {
+				allowed, err := limiter.Allow(ctx, "concurrent-key")
+				if err != nil {
+					t.Errorf("Allow failed: %v", err)
+					return
+				}
+				if allowed {
+					allowedCount.Add(1)
+				}
+			}
+		}(limiters[g%len(limiters)])
+	}
+	wg.Wait()
+
+	return allowedCount.Load()
+}
+
+func TestTokenBucketLimiter_ConcurrentRedisClients(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, client := range newRedisClients(t, logger) {
+		// A long window keeps refills out of the measurement
+		limiters = append(limiters, NewTokenBucketLimiter(client, concurrencyLimit, time.Hour, 0, nil, logger))
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestSlidingWindowLimiter_ConcurrentRedisClients(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, client := range newRedisClients(t, logger) {
+		limiters = append(limiters, NewSlidingWindowLimiter(client, concurrencyLimit, time.Hour, nil, logger))
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestSlidingWindowLimiter_ConcurrentClusterNodes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, node := range newClusterNodes(t, logger) {
+		limiters = append(limiters, NewSlidingWindowLimiter(node, concurrencyLimit, time.Hour, nil, logger))
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestTokenBucketLimiter_ConcurrentClusterNodes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, node := range newClusterNodes(t, logger) {
+		limiters = append(limiters, NewTokenBucketLimiter(node, concurrencyLimit, time.Hour, 0, nil, logger))
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestTokenBucketLimiter_ConcurrentMemory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewTokenBucketLimiter(memStorage, concurrencyLimit, time.Hour, 0, nil, logger)
+
+	if allowed := runConcurrently(t, []interfaces.RateLimiter{limiter}); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestSlidingWindowLimiter_ConcurrentMemory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewSlidingWindowLimiter(memStorage, concurrencyLimit, time.Hour, nil, logger)
+
+	if allowed := runConcurrently(t, []interfaces.RateLimiter{limiter}); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestFixedWindowLimiter_ConcurrentRedisClients(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, client := range newRedisClients(t, logger) {
+		limiters = append(limiters, NewFixedWindowLimiter(client, concurrencyLimit, 24*time.Hour, false, nil, logger))
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestFixedWindowLimiter_ConcurrentClusterNodes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, node := range newClusterNodes(t, logger) {
+		limiters = append(limiters, NewFixedWindowLimiter(node, concurrencyLimit, 24*time.Hour, false, nil, logger))
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestFixedWindowLimiter_ConcurrentMemory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewFixedWindowLimiter(memStorage, concurrencyLimit, 24*time.Hour, false, nil, logger)
+
+	if allowed := runConcurrently(t, []interfaces.RateLimiter{limiter}); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestGCRALimiter_ConcurrentRedisClients(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, client := range newRedisClients(t, logger) {
+		limiters = append(limiters, NewGCRALimiter(client, concurrencyLimit, time.Hour, 0, nil, logger))
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestGCRALimiter_ConcurrentClusterNodes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, node := range newClusterNodes(t, logger) {
+		limiters = append(limiters, NewGCRALimiter(node, concurrencyLimit, time.Hour, 0, nil, logger))
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestGCRALimiter_ConcurrentMemory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewGCRALimiter(memStorage, concurrencyLimit, time.Hour, 0, nil, logger)
+
+	if allowed := runConcurrently(t, []interfaces.RateLimiter{limiter}); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestLeakyBucketLimiter_ConcurrentRedisClients(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, client := range newRedisClients(t, logger) {
+		limiters = append(limiters, NewLeakyBucketLimiter(client, concurrencyLimit, time.Hour, 0, nil, logger))
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestLeakyBucketLimiter_ConcurrentClusterNodes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, node := range newClusterNodes(t, logger) {
+		limiters = append(limiters, NewLeakyBucketLimiter(node, concurrencyLimit, time.Hour, 0, nil, logger))
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestLeakyBucketLimiter_ConcurrentMemory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewLeakyBucketLimiter(memStorage, concurrencyLimit, time.Hour, 0, nil, logger)
+
+	if allowed := runConcurrently(t, []interfaces.RateLimiter{limiter}); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", concurrencyLimit, allowed)
+	}
+}
+
+// acquireOnly counts acquired leases as allowed requests and never releases them
+type acquireOnly struct {
+	*ConcurrencyLimiter
+}
+
+func (a acquireOnly) Allow(ctx context.Context, key string) (bool, error) {
+	_, acquired, err := a.Acquire(ctx, key)
+	return acquired, err
+}
+
+// AllowN acquires a single lease, leases always take one slot
+func (a acquireOnly) AllowN(ctx context.Context, key string, _ int) (bool, error) {
+	return a.Allow(ctx, key)
+}
+
+// Decide acquires a single lease and reports only whether it was acquired
+func (a acquireOnly) Decide(ctx context.Context, key string, _ int) (interfaces.Decision, error) {
+	allowed, err := a.Allow(ctx, key)
+	return interfaces.Decision{Allowed: allowed}, err
+}
+
+func TestConcurrencyLimiter_ConcurrentRedisClients(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, client := range newRedisClients(t, logger) {
+		limiters = append(limiters, acquireOnly{NewConcurrencyLimiter(client, concurrencyLimit, time.Hour, nil, logger)})
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d acquired leases, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestConcurrencyLimiter_ConcurrentClusterNodes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var limiters []interfaces.RateLimiter
+	for _, node := range newClusterNodes(t, logger) {
+		limiters = append(limiters, acquireOnly{NewConcurrencyLimiter(node, concurrencyLimit, time.Hour, nil, logger)})
+	}
+
+	if allowed := runConcurrently(t, limiters); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d acquired leases, got %d", concurrencyLimit, allowed)
+	}
+}
+
+func TestConcurrencyLimiter_ConcurrentMemory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := acquireOnly{NewConcurrencyLimiter(memStorage, concurrencyLimit, time.Hour, nil, logger)}
+
+	if allowed := runConcurrently(t, []interfaces.RateLimiter{limiter}); allowed != concurrencyLimit {
+		t.Errorf("Expected exactly %d acquired leases, got %d", concurrencyLimit, allowed)
+	}
+}
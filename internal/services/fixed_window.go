@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
+)
+
+// FixedWindowLimiter implements the Fixed Window Counter algorithm
+// Keeps a single counter per window, which makes it the cheapest algorithm to store
+type FixedWindowLimiter struct {
+	storage storage.Storage
+	limit   int
+	window  time.Duration
+	jitter  bool
+	clock   clock.Clock
+	logger  *slog.Logger
+}
+
+// NewFixedWindowLimiter creates a new Fixed Window Counter limiter.
+// With jitter enabled every key gets its own stable window offset, so that windows
+// of different keys do not all reset at the same instant.
+func NewFixedWindowLimiter(
+	storage storage.Storage,
+	limit int,
+	window time.Duration,
+	jitter bool,
+	clk clock.Clock,
+	logger *slog.Logger,
+) *FixedWindowLimiter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if clk == nil {
+		clk = clock.System()
+	}
+	return &FixedWindowLimiter{
+		storage: storage,
+		limit:   limit,
+		window:  window,
+		jitter:  jitter,
+		clock:   clk,
+		logger:  logger,
+	}
+}
+
+// fixedWindowState represents the state of a fixed window
+type fixedWindowState struct {
+	WindowStart int64 `json:"window_start"` // Unix timestamp in nanoseconds
+	Count       int   `json:"count"`
+}
+
+// Allow checks if a request should be allowed using Fixed Window Counter algorithm
+func (f *FixedWindowLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return allowed(f.Decide(ctx, key, 1))
+}
+
+// AllowN checks if a request counting as n requests should be allowed
+func (f *FixedWindowLimiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	return allowed(f.Decide(ctx, key, n))
+}
+
+// Decide checks if a request counting as n requests should be allowed and reports the window state
+func (f *FixedWindowLimiter) Decide(ctx context.Context, key string, n int) (interfaces.Decision, error) {
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		f.logger.Warn("Allow operation cancelled", "key", key, "error", ctx.Err())
+		return interfaces.Decision{}, ctx.Err()
+	default:
+	}
+
+	if err := validateCost(n); err != nil {
+		f.logger.Warn("Invalid cost", "key", key, "cost", n)
+		return interfaces.Decision{}, err
+	}
+
+	decision, err := f.decideAt(ctx, key, n, f.clock.Now())
+	if err != nil {
+		return interfaces.Decision{}, err
+	}
+
+	if !decision.Allowed {
+		f.logger.Debug("Request denied: limit exceeded",
+			"key", key,
+			"remaining", decision.Remaining,
+			"limit", f.limit,
+		)
+		return decision, nil
+	}
+
+	f.logger.Debug("Request allowed",
+		"key", key,
+		"remaining", decision.Remaining,
+		"limit", f.limit,
+	)
+	return decision, nil
+}
+
+// decideAt evaluates a request counting as n requests arriving at now
+func (f *FixedWindowLimiter) decideAt(ctx context.Context, key string, n int, now time.Time) (interfaces.Decision, error) {
+	windowStart := f.windowStart(key, now)
+	expiration := expirationAt(time.Unix(0, windowStart), f.window)
+
+	// Let the storage evaluate the window atomically when it supports it
+	if evaluator, ok := f.storage.(storage.FixedWindowEvaluator); ok {
+		allowed, count, err := evaluator.EvalFixedWindow(ctx, key, f.limit, n, windowStart, time.Unix(expiration, 0))
+		if err != nil {
+			f.logger.Error("Failed to evaluate fixed window", "key", key, "error", err)
+			return interfaces.Decision{}, fmt.Errorf("failed to evaluate fixed window: %w", err)
+		}
+		return f.decision(allowed, n, count, windowStart, now), nil
+	}
+
+	var allowed bool
+	var count int
+	err := f.storage.Update(ctx, key, func(stateData interface{}) (interface{}, int64, error) {
+		var state fixedWindowState
+		if stateData != nil {
+			if err := decodeState(stateData, &state); err != nil {
+				// If unmarshal fails, reset window
+				f.logger.Warn("Failed to unmarshal state, resetting window", "key", key, "error", err)
+				state = fixedWindowState{}
+			}
+		}
+
+		// Start counting from scratch once a new window begins
+		if state.WindowStart != windowStart {
+			state = fixedWindowState{WindowStart: windowStart}
+		}
+
+		allowed = state.Count+n <= f.limit
+		if allowed {
+			state.Count += n
+		}
+		count = state.Count
+
+		return state, expiration, nil
+	})
+	if err != nil {
+		f.logger.Error("Failed to update window state", "key", key, "error", err)
+		return interfaces.Decision{}, fmt.Errorf("failed to update window state: %w", err)
+	}
+
+	return f.decision(allowed, n, count, windowStart, now), nil
+}
+
+// decision derives the remaining requests, reset and retry times from the window counter
+func (f *FixedWindowLimiter) decision(allowed bool, n int, count int, windowStart int64, now time.Time) interfaces.Decision {
+	// The counter starts from scratch with the next window
+	resetAt := time.Unix(0, windowStart).Add(f.window)
+	decision := interfaces.Decision{
+		Allowed:   allowed,
+		Limit:     f.limit,
+		Remaining: max(f.limit-count, 0),
+		ResetAt:   resetAt,
+	}
+	if !allowed && n <= f.limit {
+		decision.RetryAfter = durationUntil(resetAt, now)
+	}
+	return decision
+}
+
+// windowStart returns the start of the window containing now, in Unix nanoseconds
+func (f *FixedWindowLimiter) windowStart(key string, now time.Time) int64 {
+	window := int64(f.window)
+
+	var offset int64
+	if f.jitter {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		offset = int64(h.Sum64() % uint64(window))
+	}
+
+	shifted := now.UnixNano() - offset
+	return shifted - shifted%window + offset
+}
+
+// Ensure FixedWindowLimiter implements interfaces.RateLimiter
+var _ interfaces.RateLimiter = (*FixedWindowLimiter)(nil)
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+)
+
+func TestFixedWindowLimiter_Allow(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	clk := clock.NewFake(time.Now())
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewFixedWindowLimiter(memStorage, 5, time.Hour, false, clk, logger)
+	ctx := context.Background()
+
+	key := "test-key"
+
+	// Should allow first 5 requests
+	for i := 0; i < 5; i++ {
+		allowed, err := limiter.Allow(ctx, key)
+		if err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+		if !allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+
+	// 6th request should be denied
+	allowed, err := limiter.Allow(ctx, key)
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if allowed {
+		t.Error("6th request should be denied")
+	}
+}
+
+func TestFixedWindowLimiter_WindowReset(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	// Start in the middle of a window
+	clk := clock.NewFake(time.Now().Truncate(time.Second).Add(250 * time.Millisecond))
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewFixedWindowLimiter(memStorage, 2, 500*time.Millisecond, false, clk, logger)
+	ctx := context.Background()
+
+	key := "reset-key"
+
+	// Exhaust the current window
+	for i := 0; i < 3; i++ {
+		allowed, err := limiter.Allow(ctx, key)
+		if err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+		if allowed != (i < 2) {
+			t.Errorf("Request %d: expected allowed=%v, got %v", i+1, i < 2, allowed)
+		}
+	}
+
+	// Move into the next window
+	clk.Advance(250 * time.Millisecond)
+
+	allowed, err := limiter.Allow(ctx, key)
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if !allowed {
+		t.Error("Request should be allowed in a new window")
+	}
+}
+
+func TestFixedWindowLimiter_WindowStart(t *testing.T) {
+	now := time.Unix(1700000000, 123456789)
+	window := time.Minute
+
+	aligned := NewFixedWindowLimiter(nil, 1, window, false, nil, nil)
+	start := aligned.windowStart("key", now)
+	if start%int64(window) != 0 {
+		t.Errorf("Expected window aligned to epoch, got %d", start)
+	}
+	if start > now.UnixNano() || now.UnixNano()-start >= int64(window) {
+		t.Errorf("Window start %d does not contain now", start)
+	}
+
+	jittered := NewFixedWindowLimiter(nil, 1, window, true, nil, nil)
+	starts := make(map[int64]bool)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		start := jittered.windowStart(key, now)
+		if start > now.UnixNano() || now.UnixNano()-start >= int64(window) {
+			t.Errorf("Jittered window start %d for %s does not contain now", start, key)
+		}
+		// Offset must be stable for a key
+		if again := jittered.windowStart(key, now.Add(time.Second)); again != start && again != start+int64(window) {
+			t.Errorf("Jittered window start for %s is not stable: %d vs %d", key, start, again)
+		}
+		starts[start] = true
+	}
+	if len(starts) < 2 {
+		t.Error("Expected jitter to spread window starts across keys")
+	}
+}
+
+func TestFixedWindowLimiter_Decide(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	clk := clock.NewFake(time.Now())
+	for name, store := range counterTestStorages(t, clk, logger) {
+		t.Run(name, func(t *testing.T) {
+			limiter := NewFixedWindowLimiter(store, 2, time.Minute, false, clk, logger)
+			ctx := context.Background()
+			windowStart := clk.Now().Truncate(time.Minute).Add(time.Minute)
+			clk.Set(windowStart.Add(20 * time.Second))
+
+			decision, err := limiter.Decide(ctx, "key", 1)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if !decision.Allowed || decision.Limit != 2 || decision.Remaining != 1 {
+				t.Errorf("Expected allowed with 1 remaining, got %+v", decision)
+			}
+			if !decision.ResetAt.Equal(windowStart.Add(time.Minute)) {
+				t.Errorf("Expected reset at %v, got %v", windowStart.Add(time.Minute), decision.ResetAt)
+			}
+
+			denied, err := limiter.Decide(ctx, "key", 2)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if denied.Allowed || denied.Remaining != 1 {
+				t.Errorf("Expected denied with 1 remaining, got %+v", denied)
+			}
+			if denied.RetryAfter != 40*time.Second {
+				t.Errorf("Expected retry after 40s, got %v", denied.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestFixedWindowLimiter_ContextCancellation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewFixedWindowLimiter(memStorage, 5, time.Second, false, nil, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // Cancel immediately
+
+	_, err := limiter.Allow(ctx, "key")
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
+)
+
+// GCRALimiter implements the Generic Cell Rate Algorithm
+// Stores a single theoretical arrival time (TAT) per key: requests are spaced by the
+// emission interval (window / limit) and up to burst requests may arrive at once
+type GCRALimiter struct {
+	storage          storage.Storage
+	emissionInterval time.Duration
+	burstOffset      time.Duration
+	burst            int
+	clock            clock.Clock
+	logger           *slog.Logger
+}
+
+// NewGCRALimiter creates a new GCRA limiter.
+// A burst of 0 allows limit requests at once, like a full token bucket.
+func NewGCRALimiter(
+	storage storage.Storage,
+	limit int,
+	window time.Duration,
+	burst int,
+	clk clock.Clock,
+	logger *slog.Logger,
+) *GCRALimiter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if clk == nil {
+		clk = clock.System()
+	}
+	if burst <= 0 {
+		burst = limit
+	}
+	emissionInterval := window / time.Duration(limit)
+	return &GCRALimiter{
+		storage:          storage,
+		emissionInterval: emissionInterval,
+		burstOffset:      emissionInterval * time.Duration(burst),
+		burst:            burst,
+		clock:            clk,
+		logger:           logger,
+	}
+}
+
+// gcraState represents the state of a GCRA limiter
+type gcraState struct {
+	TAT int64 `json:"tat"` // Theoretical arrival time, Unix timestamp in nanoseconds
+}
+
+// Allow checks if a request should be allowed using GCRA
+func (g *GCRALimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return allowed(g.Decide(ctx, key, 1))
+}
+
+// AllowN checks if a request taking n emission intervals should be allowed
+func (g *GCRALimiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	return allowed(g.Decide(ctx, key, n))
+}
+
+// Decide checks if a request taking n emission intervals should be allowed and reports the burst state
+func (g *GCRALimiter) Decide(ctx context.Context, key string, n int) (interfaces.Decision, error) {
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		g.logger.Warn("Allow operation cancelled", "key", key, "error", ctx.Err())
+		return interfaces.Decision{}, ctx.Err()
+	default:
+	}
+
+	if err := validateCost(n); err != nil {
+		g.logger.Warn("Invalid cost", "key", key, "cost", n)
+		return interfaces.Decision{}, err
+	}
+
+	decision, err := g.decideAt(ctx, key, n, g.clock.Now())
+	if err != nil {
+		return interfaces.Decision{}, err
+	}
+
+	if !decision.Allowed {
+		g.logger.Debug("Request denied: limit exceeded",
+			"key", key,
+			"retry_after", decision.RetryAfter,
+		)
+		return decision, nil
+	}
+
+	g.logger.Debug("Request allowed",
+		"key", key,
+		"remaining", decision.Remaining,
+		"reset_at", decision.ResetAt,
+	)
+	return decision, nil
+}
+
+// decideAt applies GCRA to a request taking n emission intervals arriving at now
+func (g *GCRALimiter) decideAt(ctx context.Context, key string, n int, now time.Time) (interfaces.Decision, error) {
+	// Let the storage evaluate the TAT atomically when it supports it
+	if evaluator, ok := g.storage.(storage.GCRAEvaluator); ok {
+		allowed, tat, err := evaluator.EvalGCRA(ctx, key, g.emissionInterval, g.burstOffset, n, now)
+		if err != nil {
+			g.logger.Error("Failed to evaluate GCRA", "key", key, "error", err)
+			return interfaces.Decision{}, fmt.Errorf("failed to evaluate GCRA: %w", err)
+		}
+		return g.decision(allowed, n, tat, now), nil
+	}
+
+	var allowed bool
+	var tat int64
+	err := g.storage.Update(ctx, key, func(stateData interface{}) (interface{}, int64, error) {
+		var state gcraState
+		if stateData != nil {
+			if err := decodeState(stateData, &state); err != nil {
+				// If unmarshal fails, start from an empty schedule
+				g.logger.Warn("Failed to unmarshal state, resetting TAT", "key", key, "error", err)
+				state = gcraState{}
+			}
+		}
+
+		tat = max(state.TAT, now.UnixNano())
+		newTAT := tat + int64(g.emissionInterval)*int64(n)
+		allowed = newTAT-int64(g.burstOffset) <= now.UnixNano()
+		if allowed {
+			tat = newTAT
+		}
+
+		// Once the TAT has passed the state is equivalent to an empty one
+		return gcraState{TAT: tat}, expirationAt(time.Unix(0, tat), 0), nil
+	})
+	if err != nil {
+		g.logger.Error("Failed to update GCRA state", "key", key, "error", err)
+		return interfaces.Decision{}, fmt.Errorf("failed to update GCRA state: %w", err)
+	}
+
+	return g.decision(allowed, n, tat, now), nil
+}
+
+// decision derives the remaining burst, retry and reset times from the TAT after evaluation
+func (g *GCRALimiter) decision(allowed bool, n int, tat int64, now time.Time) interfaces.Decision {
+	nowNano := now.UnixNano()
+	decision := interfaces.Decision{
+		Allowed: allowed,
+		Limit:   g.burst,
+		// The full burst is available again once the TAT has passed
+		ResetAt: time.Unix(0, max(tat, nowNano)),
+	}
+
+	// A request of cost n conforms once now reaches tat + n*emissionInterval - burstOffset
+	if !allowed && n <= g.burst {
+		conformsAt := tat + int64(g.emissionInterval)*int64(n) - int64(g.burstOffset)
+		decision.RetryAfter = time.Duration(max(conformsAt-nowNano, 0))
+	}
+
+	// The next single request is allowed once now reaches tat + emissionInterval - burstOffset
+	allowAt := tat + int64(g.emissionInterval) - int64(g.burstOffset)
+	if allowAt <= nowNano {
+		decision.Remaining = min(int((nowNano-allowAt)/int64(g.emissionInterval))+1, g.burst)
+	}
+	return decision
+}
+
+// Ensure GCRALimiter implements interfaces.RateLimiter
+var _ interfaces.RateLimiter = (*GCRALimiter)(nil)
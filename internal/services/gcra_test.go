@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+)
+
+func TestGCRALimiter_Allow(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	clk := clock.NewFake(time.Now())
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewGCRALimiter(memStorage, 5, time.Second, 0, clk, logger)
+	ctx := context.Background()
+
+	key := "test-key"
+
+	// Default burst allows the first 5 requests at once
+	for i := 0; i < 5; i++ {
+		allowed, err := limiter.Allow(ctx, key)
+		if err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+		if !allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+
+	// 6th request should be denied
+	allowed, err := limiter.Allow(ctx, key)
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if allowed {
+		t.Error("6th request should be denied")
+	}
+}
+
+func TestGCRALimiter_EmissionInterval(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	clk := clock.NewFake(time.Now())
+	for name, store := range counterTestStorages(t, clk, logger) {
+		t.Run(name, func(t *testing.T) {
+			// 10 requests per second with a burst of 2: one request every 100ms
+			limiter := NewGCRALimiter(store, 10, time.Second, 2, clk, logger)
+			ctx := context.Background()
+			now := clk.Now()
+
+			first, err := limiter.Decide(ctx, "key", 1)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if !first.Allowed || first.Remaining != 1 {
+				t.Errorf("Expected first request allowed with 1 remaining, got %+v", first)
+			}
+			// Storage may evaluate with microsecond precision and report the TAT as a float
+			if diff := first.ResetAt.Sub(now) - 100*time.Millisecond; diff < -2*time.Microsecond || diff > 2*time.Microsecond {
+				t.Errorf("Expected reset after 100ms, got %v", first.ResetAt.Sub(now))
+			}
+
+			second, err := limiter.Decide(ctx, "key", 1)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if !second.Allowed || second.Remaining != 0 {
+				t.Errorf("Expected second request allowed with 0 remaining, got %+v", second)
+			}
+
+			clk.Set(now.Add(30 * time.Millisecond))
+			denied, err := limiter.Decide(ctx, "key", 1)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if denied.Allowed {
+				t.Error("Third request within the burst tolerance should be denied")
+			}
+			// Tolerance is exceeded until the first emission interval has passed
+			if diff := denied.RetryAfter - 70*time.Millisecond; diff < -2*time.Microsecond || diff > 2*time.Microsecond {
+				t.Errorf("Expected retry after 70ms, got %v", denied.RetryAfter)
+			}
+
+			// After the retry delay the request conforms again
+			clk.Set(now.Add(100*time.Millisecond + time.Microsecond))
+			retried, err := limiter.Decide(ctx, "key", 1)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if !retried.Allowed {
+				t.Error("Request should be allowed after the retry delay")
+			}
+		})
+	}
+}
+
+func TestGCRALimiter_SustainedRate(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	clk := clock.NewFake(time.Now())
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewGCRALimiter(memStorage, 10, time.Second, 1, clk, logger)
+	ctx := context.Background()
+	now := clk.Now()
+
+	// Offer 100 requests per second for 10 seconds, only 10 per second conform
+	allowedCount := 0
+	for i := 0; i < 1000; i++ {
+		clk.Set(now.Add(time.Duration(i) * 10 * time.Millisecond))
+		result, err := limiter.Decide(ctx, "key", 1)
+		if err != nil {
+			t.Fatalf("Decide failed: %v", err)
+		}
+		if result.Allowed {
+			allowedCount++
+		}
+	}
+
+	if allowedCount != 100 {
+		t.Errorf("Expected 100 allowed requests, got %d", allowedCount)
+	}
+}
+
+func TestGCRALimiter_ContextCancellation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewGCRALimiter(memStorage, 5, time.Second, 0, nil, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // Cancel immediately
+
+	_, err := limiter.Allow(ctx, "key")
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
+)
+
+// LeakyBucketLimiter implements the Leaky Bucket algorithm as a queue
+// Requests join a queue of limited capacity that drains at a constant rate (limit per window),
+// so admitted requests leave strictly spaced instead of in bursts
+type LeakyBucketLimiter struct {
+	storage       storage.Storage
+	drainInterval time.Duration
+	capacity      int
+	clock         clock.Clock
+	logger        *slog.Logger
+}
+
+// NewLeakyBucketLimiter creates a new Leaky Bucket limiter.
+// A capacity of 0 lets up to limit requests wait in the queue.
+func NewLeakyBucketLimiter(
+	storage storage.Storage,
+	limit int,
+	window time.Duration,
+	capacity int,
+	clk clock.Clock,
+	logger *slog.Logger,
+) *LeakyBucketLimiter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if clk == nil {
+		clk = clock.System()
+	}
+	if capacity <= 0 {
+		capacity = limit
+	}
+	return &LeakyBucketLimiter{
+		storage:       storage,
+		drainInterval: window / time.Duration(limit),
+		capacity:      capacity,
+		clock:         clk,
+		logger:        logger,
+	}
+}
+
+// leakyBucketState represents the state of a leaky bucket queue
+type leakyBucketState struct {
+	NextDeparture int64 `json:"next_departure"` // Unix timestamp in nanoseconds when the next queued request may leave
+}
+
+// Allow checks if a request fits into the queue using Leaky Bucket algorithm.
+// The caller is expected to honour the delay returned by Decide.
+func (l *LeakyBucketLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return allowed(l.Decide(ctx, key, 1))
+}
+
+// AllowN checks if a request taking n places fits into the queue
+func (l *LeakyBucketLimiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	return allowed(l.Decide(ctx, key, n))
+}
+
+// Decide checks if a request taking n places fits into the queue and reports
+// the delay after which the caller may proceed
+func (l *LeakyBucketLimiter) Decide(ctx context.Context, key string, n int) (interfaces.Decision, error) {
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		l.logger.Warn("Allow operation cancelled", "key", key, "error", ctx.Err())
+		return interfaces.Decision{}, ctx.Err()
+	default:
+	}
+
+	if err := validateCost(n); err != nil {
+		l.logger.Warn("Invalid cost", "key", key, "cost", n)
+		return interfaces.Decision{}, err
+	}
+
+	decision, err := l.decideAt(ctx, key, n, l.clock.Now())
+	if err != nil {
+		return interfaces.Decision{}, err
+	}
+
+	if !decision.Allowed {
+		l.logger.Debug("Request denied: queue is full",
+			"key", key,
+			"capacity", l.capacity,
+			"retry_after", decision.RetryAfter,
+		)
+		return decision, nil
+	}
+
+	l.logger.Debug("Request queued", "key", key, "delay", decision.Delay)
+	return decision, nil
+}
+
+// decideAt queues a request taking n places arriving at now
+func (l *LeakyBucketLimiter) decideAt(ctx context.Context, key string, n int, now time.Time) (interfaces.Decision, error) {
+	// Let the storage evaluate the queue atomically when it supports it
+	if evaluator, ok := l.storage.(storage.LeakyBucketEvaluator); ok {
+		allowed, departure, err := evaluator.EvalLeakyBucket(ctx, key, l.drainInterval, l.capacity, n, now)
+		if err != nil {
+			l.logger.Error("Failed to evaluate leaky bucket", "key", key, "error", err)
+			return interfaces.Decision{}, fmt.Errorf("failed to evaluate leaky bucket: %w", err)
+		}
+		return l.decision(allowed, n, departure, now), nil
+	}
+
+	var allowed bool
+	var departure int64
+	err := l.storage.Update(ctx, key, func(stateData interface{}) (interface{}, int64, error) {
+		var state leakyBucketState
+		if stateData != nil {
+			if err := decodeState(stateData, &state); err != nil {
+				// If unmarshal fails, start with an empty queue
+				l.logger.Warn("Failed to unmarshal state, resetting queue", "key", key, "error", err)
+				state = leakyBucketState{}
+			}
+		}
+
+		// The request leaves once everything queued before it has drained
+		departure = max(state.NextDeparture, now.UnixNano())
+		delay := time.Duration(departure - now.UnixNano())
+		// Every request ahead that has not fully drained still occupies a place in the queue
+		allowed = delay <= l.drainInterval*time.Duration(l.capacity-n)
+		if allowed {
+			state.NextDeparture = departure + int64(l.drainInterval)*int64(n)
+			departure = state.NextDeparture
+		}
+
+		// Once the queue has drained the state is equivalent to an empty one
+		return state, expirationAt(time.Unix(0, state.NextDeparture), 0), nil
+	})
+	if err != nil {
+		l.logger.Error("Failed to update queue state", "key", key, "error", err)
+		return interfaces.Decision{}, fmt.Errorf("failed to update queue state: %w", err)
+	}
+
+	return l.decision(allowed, n, departure, now), nil
+}
+
+// decision derives the delay, free places and reset time from the time the queue will have drained
+func (l *LeakyBucketLimiter) decision(allowed bool, n int, departure int64, now time.Time) interfaces.Decision {
+	queued := time.Duration(max(departure-now.UnixNano(), 0))
+	// A partially drained request still occupies its place
+	occupied := int((queued + l.drainInterval - 1) / l.drainInterval)
+	decision := interfaces.Decision{
+		Allowed:   allowed,
+		Limit:     l.capacity,
+		Remaining: max(l.capacity-occupied, 0),
+		ResetAt:   now.Add(queued),
+	}
+
+	if allowed {
+		// The admitted request leaves after everything queued ahead of it
+		decision.Delay = queued - l.drainInterval*time.Duration(n)
+	} else if n <= l.capacity {
+		decision.RetryAfter = queued - l.drainInterval*time.Duration(l.capacity-n)
+	}
+	return decision
+}
+
+// Ensure LeakyBucketLimiter implements interfaces.RateLimiter
+var _ interfaces.RateLimiter = (*LeakyBucketLimiter)(nil)
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+)
+
+func TestLeakyBucketLimiter_Allow(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	clk := clock.NewFake(time.Now())
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewLeakyBucketLimiter(memStorage, 5, time.Hour, 0, clk, logger)
+	ctx := context.Background()
+
+	key := "test-key"
+
+	// Should queue first 5 requests
+	for i := 0; i < 5; i++ {
+		allowed, err := limiter.Allow(ctx, key)
+		if err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+		if !allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+
+	// 6th request should be denied, the queue is full
+	allowed, err := limiter.Allow(ctx, key)
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if allowed {
+		t.Error("6th request should be denied")
+	}
+}
+
+func TestLeakyBucketLimiter_Delay(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	clk := clock.NewFake(time.Now())
+	for name, store := range counterTestStorages(t, clk, logger) {
+		t.Run(name, func(t *testing.T) {
+			// 10 requests per second drain every 100ms, up to 3 may wait
+			limiter := NewLeakyBucketLimiter(store, 10, time.Second, 3, clk, logger)
+			ctx := context.Background()
+			now := clk.Now().Truncate(time.Second).Add(time.Second)
+			clk.Set(now)
+
+			// Queued requests leave strictly spaced by the drain interval
+			for i := 0; i < 3; i++ {
+				decision, err := limiter.Decide(ctx, "key", 1)
+				if err != nil {
+					t.Fatalf("Decide failed: %v", err)
+				}
+				if !decision.Allowed {
+					t.Fatalf("Request %d should be queued", i+1)
+				}
+				if want := time.Duration(i) * 100 * time.Millisecond; decision.Delay != want {
+					t.Errorf("Request %d: expected delay %v, got %v", i+1, want, decision.Delay)
+				}
+				if decision.Remaining != 2-i {
+					t.Errorf("Request %d: expected %d remaining, got %d", i+1, 2-i, decision.Remaining)
+				}
+			}
+
+			denied, err := limiter.Decide(ctx, "key", 1)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if denied.Allowed || denied.Delay != 0 {
+				t.Errorf("Expected full queue to deny without delay, got %+v", denied)
+			}
+			// A place frees up once the first request has drained
+			if denied.RetryAfter != 100*time.Millisecond {
+				t.Errorf("Expected retry after 100ms, got %v", denied.RetryAfter)
+			}
+			if !denied.ResetAt.Equal(now.Add(300 * time.Millisecond)) {
+				t.Errorf("Expected queue to drain at %v, got %v", now.Add(300*time.Millisecond), denied.ResetAt)
+			}
+
+			// Once one request has drained there is room for exactly one more
+			clk.Set(now.Add(100 * time.Millisecond))
+			decision, err := limiter.Decide(ctx, "key", 1)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if !decision.Allowed || decision.Delay != 200*time.Millisecond {
+				t.Errorf("Expected request queued with delay 200ms, got %+v", decision)
+			}
+
+			// An idle queue lets the next request through immediately
+			clk.Set(now.Add(time.Minute))
+			decision, err = limiter.Decide(ctx, "key", 1)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if !decision.Allowed || decision.Delay != 0 {
+				t.Errorf("Expected request allowed without delay, got %+v", decision)
+			}
+		})
+	}
+}
+
+func TestLeakyBucketLimiter_ContextCancellation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewLeakyBucketLimiter(memStorage, 5, time.Second, 0, nil, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // Cancel immediately
+
+	_, err := limiter.Decide(ctx, "key", 1)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -2,11 +2,12 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
+	"sort"
 	"time"
 
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
 )
@@ -17,6 +18,7 @@ type SlidingWindowLimiter struct {
 	storage storage.Storage
 	limit   int
 	window  time.Duration
+	clock   clock.Clock
 	logger  *slog.Logger
 }
 
@@ -25,15 +27,20 @@ func NewSlidingWindowLimiter(
 	storage storage.Storage,
 	limit int,
 	window time.Duration,
+	clk clock.Clock,
 	logger *slog.Logger,
 ) *SlidingWindowLimiter {
 	if logger == nil {
 		logger = slog.Default()
 	}
+	if clk == nil {
+		clk = clock.System()
+	}
 	return &SlidingWindowLimiter{
 		storage: storage,
 		limit:   limit,
 		window:  window,
+		clock:   clk,
 		logger:  logger,
 	}
 }
@@ -45,57 +52,140 @@ type slidingWindowState struct {
 
 // Allow checks if a request should be allowed using Sliding Window Log algorithm
 func (s *SlidingWindowLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return allowed(s.Decide(ctx, key, 1))
+}
+
+// AllowN checks if a request taking n slots of the window should be allowed
+func (s *SlidingWindowLimiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	return allowed(s.Decide(ctx, key, n))
+}
+
+// Decide checks if a request taking n slots of the window should be allowed and reports the window state
+func (s *SlidingWindowLimiter) Decide(ctx context.Context, key string, n int) (interfaces.Decision, error) {
 	// Check context cancellation
 	select {
 	case <-ctx.Done():
 		s.logger.Warn("Allow operation cancelled", "key", key, "error", ctx.Err())
-		return false, ctx.Err()
+		return interfaces.Decision{}, ctx.Err()
 	default:
 	}
 
-	now := time.Now()
-	nowUnixNano := now.UnixNano()
-	windowStart := now.Add(-s.window).UnixNano()
+	if err := validateCost(n); err != nil {
+		s.logger.Warn("Invalid cost", "key", key, "cost", n)
+		return interfaces.Decision{}, err
+	}
 
-	// Get current state
-	stateData, err := s.storage.Get(ctx, key)
+	decision, err := s.decideAt(ctx, key, n, s.clock.Now())
 	if err != nil {
-		s.logger.Error("Failed to get window state", "key", key, "error", err)
-		return false, fmt.Errorf("failed to get window state: %w", err)
+		return interfaces.Decision{}, err
 	}
 
-	var state slidingWindowState
-	if stateData == nil {
-		state = slidingWindowState{
-			Timestamps: []int64{},
-		}
-		s.logger.Debug("Initialized new sliding window", "key", key)
-	} else {
-		// Parse state
-		var stateJSON string
-		switch v := stateData.(type) {
-		case string:
-			stateJSON = v
-		default:
-			data, err := json.Marshal(v)
-			if err != nil {
-				s.logger.Error("Failed to marshal state", "key", key, "error", err)
-				return false, fmt.Errorf("failed to marshal state: %w", err)
-			}
-			stateJSON = string(data)
+	if !decision.Allowed {
+		s.logger.Debug("Request denied: limit exceeded",
+			"key", key,
+			"remaining", decision.Remaining,
+			"limit", s.limit,
+		)
+		return decision, nil
+	}
+
+	s.logger.Debug("Request allowed",
+		"key", key,
+		"remaining", decision.Remaining,
+		"limit", s.limit,
+	)
+	return decision, nil
+}
+
+// decideAt evaluates a request taking n slots arriving at now
+func (s *SlidingWindowLimiter) decideAt(ctx context.Context, key string, n int, now time.Time) (interfaces.Decision, error) {
+	// Let the storage evaluate the window atomically when it supports it,
+	// so that concurrent replicas cannot both take the last slot.
+	if evaluator, ok := s.storage.(storage.SlidingWindowEvaluator); ok {
+		allowed, count, newest, blocking, err := evaluator.EvalSlidingWindow(ctx, key, s.limit, s.window, n, now)
+		if err != nil {
+			s.logger.Error("Failed to evaluate sliding window", "key", key, "error", err)
+			return interfaces.Decision{}, fmt.Errorf("failed to evaluate sliding window: %w", err)
 		}
+		return s.decision(allowed, count, newest, blocking, now), nil
+	}
 
-		if err := json.Unmarshal([]byte(stateJSON), &state); err != nil {
-			// If unmarshal fails, reset window
-			s.logger.Warn("Failed to unmarshal state, resetting window", "key", key, "error", err)
-			state = slidingWindowState{
-				Timestamps: []int64{},
+	var allowed bool
+	var count int
+	var newest, blocking int64
+	err := s.storage.Update(ctx, key, func(stateData interface{}) (interface{}, int64, error) {
+		state := s.trim(key, stateData, now)
+
+		// Check if we're within the limit
+		allowed = len(state.Timestamps)+n <= s.limit
+		if allowed {
+			// Add current timestamp once per slot taken
+			for i := 0; i < n; i++ {
+				state.Timestamps = append(state.Timestamps, now.UnixNano())
 			}
 		}
+		count = len(state.Timestamps)
+		newest, blocking = windowBounds(state.Timestamps, count+n-s.limit, allowed)
+
+		// State is saved even if the request is denied
+		return state, expirationAt(now, s.window), nil
+	})
+	if err != nil {
+		s.logger.Error("Failed to update window state", "key", key, "error", err)
+		return interfaces.Decision{}, fmt.Errorf("failed to update window state: %w", err)
+	}
+
+	return s.decision(allowed, count, newest, blocking, now), nil
+}
+
+// windowBounds returns the newest timestamp and, for a denied request, the timestamp
+// that has to leave the window before the needed slots are free (0 if there is none)
+func windowBounds(timestamps []int64, needed int, allowed bool) (int64, int64) {
+	if len(timestamps) == 0 {
+		return 0, 0
+	}
+	sorted := append([]int64(nil), timestamps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var blocking int64
+	if !allowed && needed > 0 && needed <= len(sorted) {
+		blocking = sorted[needed-1]
+	}
+	return sorted[len(sorted)-1], blocking
+}
+
+// decision derives the remaining slots, reset and retry times from the window after evaluation
+func (s *SlidingWindowLimiter) decision(allowed bool, count int, newest, blocking int64, now time.Time) interfaces.Decision {
+	decision := interfaces.Decision{
+		Allowed:   allowed,
+		Limit:     s.limit,
+		Remaining: max(s.limit-count, 0),
+		ResetAt:   now,
+	}
+	// Every timestamp leaves the window once it is older than the window
+	if newest > 0 {
+		decision.ResetAt = time.Unix(0, newest).Add(s.window)
+	}
+	if !allowed && blocking > 0 {
+		decision.RetryAfter = durationUntil(time.Unix(0, blocking).Add(s.window), now)
+	}
+	return decision
+}
+
+// trim decodes the stored window state and drops timestamps that fell out of the window
+func (s *SlidingWindowLimiter) trim(key string, stateData interface{}, now time.Time) slidingWindowState {
+	var state slidingWindowState
+	if stateData == nil {
+		s.logger.Debug("Initialized new sliding window", "key", key)
+	} else if err := decodeState(stateData, &state); err != nil {
+		// If unmarshal fails, reset window
+		s.logger.Warn("Failed to unmarshal state, resetting window", "key", key, "error", err)
+		state = slidingWindowState{}
 	}
 
 	// Remove timestamps outside the window.
 	// We keep all timestamps that are within [windowStart, now] inclusive.
+	windowStart := now.Add(-s.window).UnixNano()
 	validTimestamps := make([]int64, 0, len(state.Timestamps))
 	for _, ts := range state.Timestamps {
 		if ts >= windowStart {
@@ -103,39 +193,7 @@ func (s *SlidingWindowLimiter) Allow(ctx context.Context, key string) (bool, err
 		}
 	}
 	state.Timestamps = validTimestamps
-
-	// Check if we're within the limit
-	if len(state.Timestamps) >= s.limit {
-		// Save state even if request is denied
-		stateJSON, _ := json.Marshal(state)
-		expiration := now.Add(s.window).Unix()
-		if err := s.storage.Set(ctx, key, string(stateJSON), expiration); err != nil {
-			s.logger.Error("Failed to save window state", "key", key, "error", err)
-			return false, fmt.Errorf("failed to save window state: %w", err)
-		}
-		s.logger.Debug("Request denied: limit exceeded",
-			"key", key,
-			"count", len(state.Timestamps),
-			"limit", s.limit,
-		)
-		return false, nil
-	}
-
-	// Add current timestamp
-	state.Timestamps = append(state.Timestamps, nowUnixNano)
-	stateJSON, _ := json.Marshal(state)
-	expiration := now.Add(s.window).Unix()
-	if err := s.storage.Set(ctx, key, string(stateJSON), expiration); err != nil {
-		s.logger.Error("Failed to save window state", "key", key, "error", err)
-		return false, fmt.Errorf("failed to save window state: %w", err)
-	}
-
-	s.logger.Debug("Request allowed",
-		"key", key,
-		"count", len(state.Timestamps),
-		"limit", s.limit,
-	)
-	return true, nil
+	return state
 }
 
 // Ensure SlidingWindowLimiter implements interfaces.RateLimiter
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
+)
+
+// SlidingWindowCounterLimiter implements the Sliding Window Counter algorithm
+// Approximates a sliding window by weighting the previous fixed window's count
+// with its overlap with the sliding window, so only two counters are stored per key
+type SlidingWindowCounterLimiter struct {
+	storage storage.Storage
+	limit   int
+	window  time.Duration
+	clock   clock.Clock
+	logger  *slog.Logger
+}
+
+// NewSlidingWindowCounterLimiter creates a new Sliding Window Counter limiter
+func NewSlidingWindowCounterLimiter(
+	storage storage.Storage,
+	limit int,
+	window time.Duration,
+	clk clock.Clock,
+	logger *slog.Logger,
+) *SlidingWindowCounterLimiter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if clk == nil {
+		clk = clock.System()
+	}
+	return &SlidingWindowCounterLimiter{
+		storage: storage,
+		limit:   limit,
+		window:  window,
+		clock:   clk,
+		logger:  logger,
+	}
+}
+
+// slidingWindowCounterState represents the state of a sliding window counter
+type slidingWindowCounterState struct {
+	WindowStart   int64 `json:"window_start"` // Start of the current window, Unix timestamp in nanoseconds
+	CurrentCount  int   `json:"current_count"`
+	PreviousCount int   `json:"previous_count"`
+}
+
+// Allow checks if a request should be allowed using Sliding Window Counter algorithm
+func (s *SlidingWindowCounterLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return allowed(s.Decide(ctx, key, 1))
+}
+
+// AllowN checks if a request counting as n requests should be allowed
+func (s *SlidingWindowCounterLimiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	return allowed(s.Decide(ctx, key, n))
+}
+
+// Decide checks if a request counting as n requests should be allowed and reports the window state
+func (s *SlidingWindowCounterLimiter) Decide(ctx context.Context, key string, n int) (interfaces.Decision, error) {
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Allow operation cancelled", "key", key, "error", ctx.Err())
+		return interfaces.Decision{}, ctx.Err()
+	default:
+	}
+
+	if err := validateCost(n); err != nil {
+		s.logger.Warn("Invalid cost", "key", key, "cost", n)
+		return interfaces.Decision{}, err
+	}
+
+	decision, err := s.decideAt(ctx, key, n, s.clock.Now())
+	if err != nil {
+		return interfaces.Decision{}, err
+	}
+
+	if !decision.Allowed {
+		s.logger.Debug("Request denied: limit exceeded",
+			"key", key,
+			"retry_after", decision.RetryAfter,
+			"limit", s.limit,
+		)
+		return decision, nil
+	}
+
+	s.logger.Debug("Request allowed",
+		"key", key,
+		"remaining", decision.Remaining,
+		"limit", s.limit,
+	)
+	return decision, nil
+}
+
+// decideAt evaluates a request counting as n requests arriving at now
+func (s *SlidingWindowCounterLimiter) decideAt(ctx context.Context, key string, n int, now time.Time) (interfaces.Decision, error) {
+	window := int64(s.window)
+	windowStart := now.UnixNano() - now.UnixNano()%window
+	// Share of the previous window still covered by the sliding window
+	previousWeight := 1 - float64(now.UnixNano()-windowStart)/float64(window)
+	// The previous count is needed until the end of the next window
+	expiration := expirationAt(time.Unix(0, windowStart), 2*s.window)
+
+	// Let the storage evaluate the window atomically when it supports it
+	if evaluator, ok := s.storage.(storage.SlidingWindowCounterEvaluator); ok {
+		allowed, current, previous, err := evaluator.EvalSlidingWindowCounter(
+			ctx, key, s.limit, n, windowStart, window, previousWeight, time.Unix(expiration, 0),
+		)
+		if err != nil {
+			s.logger.Error("Failed to evaluate sliding window counter", "key", key, "error", err)
+			return interfaces.Decision{}, fmt.Errorf("failed to evaluate sliding window counter: %w", err)
+		}
+		state := slidingWindowCounterState{WindowStart: windowStart, CurrentCount: current, PreviousCount: previous}
+		return s.decision(allowed, n, state, previousWeight, now), nil
+	}
+
+	var allowed bool
+	var state slidingWindowCounterState
+	err := s.storage.Update(ctx, key, func(stateData interface{}) (interface{}, int64, error) {
+		state = slidingWindowCounterState{}
+		if stateData != nil {
+			if err := decodeState(stateData, &state); err != nil {
+				// If unmarshal fails, reset window
+				s.logger.Warn("Failed to unmarshal state, resetting window", "key", key, "error", err)
+				state = slidingWindowCounterState{}
+			}
+		}
+
+		// Roll the counters forward to the current window
+		switch state.WindowStart {
+		case windowStart:
+		case windowStart - window:
+			state = slidingWindowCounterState{WindowStart: windowStart, PreviousCount: state.CurrentCount}
+		default:
+			state = slidingWindowCounterState{WindowStart: windowStart}
+		}
+
+		estimated := float64(state.PreviousCount)*previousWeight + float64(state.CurrentCount)
+		// A single request fits while the estimate is below limit, every further unit needs a whole slot
+		allowed = estimated+float64(n-1) < float64(s.limit)
+		if allowed {
+			state.CurrentCount += n
+		}
+
+		return state, expiration, nil
+	})
+	if err != nil {
+		s.logger.Error("Failed to update window state", "key", key, "error", err)
+		return interfaces.Decision{}, fmt.Errorf("failed to update window state: %w", err)
+	}
+
+	return s.decision(allowed, n, state, previousWeight, now), nil
+}
+
+// decision derives the remaining requests, reset and retry times from the counters after evaluation
+func (s *SlidingWindowCounterLimiter) decision(
+	allowed bool,
+	n int,
+	state slidingWindowCounterState,
+	previousWeight float64,
+	now time.Time,
+) interfaces.Decision {
+	windowStart := time.Unix(0, state.WindowStart)
+	estimated := float64(state.PreviousCount)*previousWeight + float64(state.CurrentCount)
+
+	decision := interfaces.Decision{
+		Allowed:   allowed,
+		Limit:     s.limit,
+		Remaining: max(int(math.Ceil(float64(s.limit)-estimated)), 0),
+		ResetAt:   now,
+	}
+	// The estimate drops to zero once the last counted window has fully slid out
+	switch {
+	case state.CurrentCount > 0:
+		decision.ResetAt = windowStart.Add(2 * s.window)
+	case state.PreviousCount > 0:
+		decision.ResetAt = windowStart.Add(s.window)
+	}
+
+	if !allowed && n <= s.limit {
+		decision.RetryAfter = durationUntil(s.fitsAt(n, state, windowStart), now)
+	}
+	return decision
+}
+
+// fitsAt returns when the decaying estimate leaves room for a request counting as n requests
+func (s *SlidingWindowCounterLimiter) fitsAt(n int, state slidingWindowCounterState, windowStart time.Time) time.Time {
+	// The request fits once weight * decaying count + fixed count + n - 1 drops below limit
+	decayAt := func(start time.Time, decaying, fixed int) (time.Time, bool) {
+		room := float64(s.limit-n+1-fixed) / float64(max(decaying, 1))
+		if room <= 0 {
+			return time.Time{}, false
+		}
+		// The weight falls linearly from 1 to 0 over the window
+		share := math.Max(1-room, 0)
+		return start.Add(time.Duration(share * float64(s.window))), true
+	}
+
+	if at, ok := decayAt(windowStart, state.PreviousCount, state.CurrentCount); ok {
+		return at
+	}
+	// The current count only starts to decay in the next window
+	at, _ := decayAt(windowStart.Add(s.window), state.CurrentCount, 0)
+	return at
+}
+
+// Ensure SlidingWindowCounterLimiter implements interfaces.RateLimiter
+var _ interfaces.RateLimiter = (*SlidingWindowCounterLimiter)(nil)
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	_ "modernc.org/sqlite"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+func TestSlidingWindowCounterLimiter_Allow(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	clk := clock.NewFake(time.Now())
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewSlidingWindowCounterLimiter(memStorage, 5, time.Hour, clk, logger)
+	ctx := context.Background()
+
+	key := "test-key"
+
+	// Should allow first 5 requests
+	for i := 0; i < 5; i++ {
+		allowed, err := limiter.Allow(ctx, key)
+		if err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+		if !allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+
+	// 6th request should be denied
+	allowed, err := limiter.Allow(ctx, key)
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if allowed {
+		t.Error("6th request should be denied")
+	}
+}
+
+func TestSlidingWindowCounterLimiter_PreviousWindowWeight(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	clk := clock.NewFake(time.Now())
+	for name, store := range counterTestStorages(t, clk, logger) {
+		t.Run(name, func(t *testing.T) {
+			limiter := NewSlidingWindowCounterLimiter(store, 10, time.Minute, clk, logger)
+			ctx := context.Background()
+			windowStart := clk.Now().Truncate(time.Minute).Add(time.Minute)
+
+			// Fill the previous window right before its end
+			clk.Set(windowStart.Add(-time.Second))
+			if allowed := countAllowed(t, 20, func() (bool, error) {
+				return limiter.Allow(ctx, "key")
+			}); allowed != 10 {
+				t.Fatalf("Expected 10 allowed requests in the first window, got %d", allowed)
+			}
+
+			// A quarter into the next window the previous count weighs 7.5,
+			// so exactly 3 more requests fit below the limit
+			clk.Set(windowStart.Add(15 * time.Second))
+			if allowed := countAllowed(t, 20, func() (bool, error) {
+				return limiter.Allow(ctx, "key")
+			}); allowed != 3 {
+				t.Errorf("Expected 3 allowed requests after the boundary, got %d", allowed)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowCounterLimiter_AccuracyAgainstLog(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	const limit = 100
+	const window = time.Minute
+	const windows = 10
+
+	scenarios := []struct {
+		name      string
+		rate      float64 // Offered requests per window, relative to limit
+		tolerance float64 // Allowed relative difference to the log
+	}{
+		{name: "under limit", rate: 0.5, tolerance: 0},
+		{name: "at limit", rate: 1, tolerance: 0.05},
+		{name: "twice the limit", rate: 2, tolerance: 0.05},
+		{name: "five times the limit", rate: 5, tolerance: 0.05},
+	}
+
+	clk := clock.NewFake(time.Now())
+	for name, store := range counterTestStorages(t, clk, logger) {
+		for _, sc := range scenarios {
+			t.Run(name+"/"+sc.name, func(t *testing.T) {
+				ctx := context.Background()
+				logLimiter := NewSlidingWindowLimiter(storage.NewMemoryStorage(clk, logger), limit, window, clk, logger)
+				counterLimiter := NewSlidingWindowCounterLimiter(store, limit, window, clk, logger)
+				key := "accuracy:" + sc.name
+
+				// Poisson arrivals with a fixed seed keep the test deterministic
+				rng := rand.New(rand.NewSource(42))
+				meanGap := float64(window) / (sc.rate * limit)
+				clk.Set(clk.Now().Truncate(window).Add(window))
+				end := clk.Now().Add(windows * window)
+
+				var logAllowed, counterAllowed int
+				for clk.Now().Before(end) {
+					clk.Advance(time.Duration(rng.ExpFloat64() * meanGap))
+
+					decision, err := logLimiter.Decide(ctx, key, 1)
+					if err != nil {
+						t.Fatalf("Log allow failed: %v", err)
+					}
+					if decision.Allowed {
+						logAllowed++
+					}
+
+					decision, err = counterLimiter.Decide(ctx, key, 1)
+					if err != nil {
+						t.Fatalf("Counter allow failed: %v", err)
+					}
+					if decision.Allowed {
+						counterAllowed++
+					}
+				}
+
+				diff := math.Abs(float64(counterAllowed-logAllowed)) / float64(logAllowed)
+				if diff > sc.tolerance {
+					t.Errorf("Counter allowed %d requests, log allowed %d (%.1f%% off, tolerance %.1f%%)",
+						counterAllowed, logAllowed, diff*100, sc.tolerance*100)
+				}
+			})
+		}
+	}
+}
+
+func TestSlidingWindowCounterLimiter_NoBoundaryBurst(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	ctx := context.Background()
+	clk := clock.NewFake(time.Now())
+	logLimiter := NewSlidingWindowLimiter(storage.NewMemoryStorage(clk, logger), 10, time.Minute, clk, logger)
+	counterLimiter := NewSlidingWindowCounterLimiter(storage.NewMemoryStorage(clk, logger), 10, time.Minute, clk, logger)
+	boundary := clk.Now().Truncate(time.Minute).Add(time.Minute)
+
+	// A full burst right before and right after the boundary: a fixed window
+	// would let both through, the log denies the second one entirely.
+	for _, at := range []time.Time{boundary.Add(-time.Second), boundary.Add(time.Second)} {
+		clk.Set(at)
+		logAllowed := countAllowed(t, 10, func() (bool, error) { return logLimiter.Allow(ctx, "key") })
+		counterAllowed := countAllowed(t, 10, func() (bool, error) { return counterLimiter.Allow(ctx, "key") })
+		if counterAllowed-logAllowed > 1 {
+			t.Errorf("At %v counter allowed %d requests, log allowed %d", at.Sub(boundary), counterAllowed, logAllowed)
+		}
+	}
+}
+
+func TestSlidingWindowCounterLimiter_ContextCancellation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewSlidingWindowCounterLimiter(memStorage, 5, time.Second, nil, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // Cancel immediately
+
+	_, err := limiter.Allow(ctx, "key")
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// counterTestStorages returns the backends the sliding window counter must work on
+func counterTestStorages(t *testing.T, clk clock.Clock, logger *slog.Logger) map[string]storage.Storage {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	redisStorage, err := storage.NewRedisStorage(config.StorageConfig{RedisAddress: mr.Addr()}, logger)
+	if err != nil {
+		t.Fatalf("NewRedisStorage failed: %v", err)
+	}
+	t.Cleanup(func() { redisStorage.Close() })
+	sqlStorage, err := storage.NewSQLStorage(config.StorageConfig{SQLDriver: "sqlite", SQLDSN: ":memory:"}, clk, logger)
+	if err != nil {
+		t.Fatalf("NewSQLStorage failed: %v", err)
+	}
+	t.Cleanup(func() { sqlStorage.Close() })
+	binaryStorage, err := storage.NewSQLStorage(config.StorageConfig{SQLDriver: "sqlite", SQLDSN: ":memory:", StateCodec: storage.StateCodecBinary}, clk, logger)
+	if err != nil {
+		t.Fatalf("NewSQLStorage failed: %v", err)
+	}
+	t.Cleanup(func() { binaryStorage.Close() })
+
+	return map[string]storage.Storage{
+		"memory":         storage.NewMemoryStorage(clk, logger),
+		"sharded_memory": storage.NewShardedMemoryStorage(0, clk, logger),
+		"redis":          redisStorage,
+		"sql":            sqlStorage,
+		"sql_binary":     binaryStorage,
+	}
+}
+
+// countAllowed performs n checks and returns how many were allowed
+func countAllowed(t *testing.T, n int, allow func() (bool, error)) int {
+	t.Helper()
+	count := 0
+	for i := 0; i < n; i++ {
+		allowed, err := allow()
+		if err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+		if allowed {
+			count++
+		}
+	}
+	return count
+}
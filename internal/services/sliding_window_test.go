@@ -7,13 +7,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
 )
 
 func TestSlidingWindowLimiter_Allow(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
-	limiter := NewSlidingWindowLimiter(memStorage, 5, time.Second, logger)
+	clk := clock.NewFake(time.Now())
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewSlidingWindowLimiter(memStorage, 5, time.Second, clk, logger)
 	ctx := context.Background()
 
 	key := "test-key"
@@ -41,8 +43,9 @@ func TestSlidingWindowLimiter_Allow(t *testing.T) {
 
 func TestSlidingWindowLimiter_WindowSliding(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
-	limiter := NewSlidingWindowLimiter(memStorage, 3, 500*time.Millisecond, logger)
+	clk := clock.NewFake(time.Now())
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewSlidingWindowLimiter(memStorage, 3, 500*time.Millisecond, clk, logger)
 	ctx := context.Background()
 
 	key := "sliding-key"
@@ -67,8 +70,8 @@ func TestSlidingWindowLimiter_WindowSliding(t *testing.T) {
 		t.Error("4th request should be denied")
 	}
 
-	// Wait for window to slide (oldest request should expire)
-	time.Sleep(600 * time.Millisecond)
+	// Let the window slide past the requests, the window bound itself is inclusive
+	clk.Advance(500*time.Millisecond + time.Nanosecond)
 
 	// Should allow one more request (oldest expired)
 	allowed, err = limiter.Allow(ctx, key)
@@ -80,10 +83,52 @@ func TestSlidingWindowLimiter_WindowSliding(t *testing.T) {
 	}
 }
 
+func TestSlidingWindowLimiter_Decide(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	clk := clock.NewFake(time.Now())
+	for name, store := range counterTestStorages(t, clk, logger) {
+		t.Run(name, func(t *testing.T) {
+			limiter := NewSlidingWindowLimiter(store, 3, time.Second, clk, logger)
+			ctx := context.Background()
+			now := clk.Now()
+
+			// Requests 100ms apart fill the window
+			for i := 0; i < 3; i++ {
+				clk.Set(now.Add(time.Duration(i) * 100 * time.Millisecond))
+				decision, err := limiter.Decide(ctx, "key", 1)
+				if err != nil {
+					t.Fatalf("Decide failed: %v", err)
+				}
+				if !decision.Allowed || decision.Limit != 3 || decision.Remaining != 2-i {
+					t.Errorf("Request %d: expected allowed with %d remaining, got %+v", i+1, 2-i, decision)
+				}
+			}
+
+			clk.Set(now.Add(300 * time.Millisecond))
+			denied, err := limiter.Decide(ctx, "key", 2)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if denied.Allowed || denied.Remaining != 0 {
+				t.Errorf("Expected full window to deny, got %+v", denied)
+			}
+			// Two slots are free once the second request leaves the window.
+			// Redis keeps timestamps as double scores, allow for rounding.
+			if diff := (denied.RetryAfter - 800*time.Millisecond).Abs(); diff > time.Microsecond {
+				t.Errorf("Expected retry after 800ms, got %v", denied.RetryAfter)
+			}
+			if diff := denied.ResetAt.Sub(now.Add(1200 * time.Millisecond)).Abs(); diff > time.Microsecond {
+				t.Errorf("Expected window to be empty at %v, got %v", now.Add(1200*time.Millisecond), denied.ResetAt)
+			}
+		})
+	}
+}
+
 func TestSlidingWindowLimiter_ContextCancellation(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
-	limiter := NewSlidingWindowLimiter(memStorage, 5, time.Second, logger)
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewSlidingWindowLimiter(memStorage, 5, time.Second, nil, logger)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
@@ -96,8 +141,9 @@ func TestSlidingWindowLimiter_ContextCancellation(t *testing.T) {
 
 func TestSlidingWindowLimiter_DifferentKeys(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
-	limiter := NewSlidingWindowLimiter(memStorage, 2, time.Second, logger)
+	clk := clock.NewFake(time.Now())
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewSlidingWindowLimiter(memStorage, 2, time.Second, clk, logger)
 	ctx := context.Background()
 
 	key1 := "key1"
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
+)
+
+// decodeState decodes algorithm state returned by storage into v.
+// In-process backends return the typed state stored by the previous update as is,
+// serializing backends return the stored string in any state codec format,
+// and custom backends may return an already decoded JSON value.
+func decodeState[T any](stateData interface{}, v *T) error {
+	var stateJSON []byte
+	switch data := stateData.(type) {
+	case T:
+		*v = data
+		return nil
+	case string:
+		return storage.DecodeState([]byte(data), v)
+	case []byte:
+		return storage.DecodeState(data, v)
+	default:
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to marshal state: %w", err)
+		}
+		stateJSON = encoded
+	}
+
+	return json.Unmarshal(stateJSON, v)
+}
+
+// expirationAt returns the Unix timestamp at which state written at now may expire.
+// It is rounded up so that second granularity never drops state before the window ends.
+func expirationAt(now time.Time, window time.Duration) int64 {
+	end := now.Add(window)
+	if end.Nanosecond() > 0 {
+		return end.Unix() + 1
+	}
+	return end.Unix()
+}
+
+// validateCost rejects requests costing less than one unit, which would create capacity instead of using it
+func validateCost(n int) error {
+	if n < 1 {
+		return fmt.Errorf("%w, got %d", storage.ErrInvalidCost, n)
+	}
+	return nil
+}
+
+// allowed reduces a decision to the answer of Allow and AllowN
+func allowed(decision interfaces.Decision, err error) (bool, error) {
+	return decision.Allowed, err
+}
+
+// durationUntil returns the time left from now until at, or 0 if at has passed
+func durationUntil(at time.Time, now time.Time) time.Duration {
+	if at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
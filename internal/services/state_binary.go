@@ -0,0 +1,205 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Binary forms of the limiter state, written by the binary state codec of serializing storages.
+// Integers are varints and timestamps of a sliding window log are stored as deltas from their
+// predecessor, so a log of requests made close to each other takes a few bytes per entry.
+// Changing a form requires a new version of the binary state header.
+
+// errInvalidBinaryState is returned for truncated binary state or state with trailing bytes
+var errInvalidBinaryState = errors.New("invalid binary state")
+
+// MarshalBinary encodes the bucket as its token count and last refill time
+func (s tokenBucketState) MarshalBinary() ([]byte, error) {
+	data := binary.LittleEndian.AppendUint64(nil, math.Float64bits(s.Tokens))
+	return binary.AppendVarint(data, s.LastRefill), nil
+}
+
+// UnmarshalBinary decodes the form written by MarshalBinary
+func (s *tokenBucketState) UnmarshalBinary(data []byte) error {
+	r := stateReader{data: data}
+	s.Tokens = math.Float64frombits(r.uint64())
+	s.LastRefill = r.varint()
+	return r.close()
+}
+
+// MarshalBinary encodes the log as its length followed by delta-encoded timestamps
+func (s slidingWindowState) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, binary.MaxVarintLen64+2*len(s.Timestamps))
+	data = binary.AppendUvarint(data, uint64(len(s.Timestamps)))
+	var previous int64
+	for _, ts := range s.Timestamps {
+		data = binary.AppendVarint(data, ts-previous)
+		previous = ts
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes the form written by MarshalBinary
+func (s *slidingWindowState) UnmarshalBinary(data []byte) error {
+	r := stateReader{data: data}
+	n := r.uvarint()
+	// Every timestamp takes at least one byte, which bounds the allocation for corrupt state
+	if n > uint64(len(data)) {
+		return errInvalidBinaryState
+	}
+	s.Timestamps = make([]int64, n)
+	var previous int64
+	for i := range s.Timestamps {
+		previous += r.varint()
+		s.Timestamps[i] = previous
+	}
+	return r.close()
+}
+
+// MarshalBinary encodes the window start and its counter
+func (s fixedWindowState) MarshalBinary() ([]byte, error) {
+	data := binary.AppendVarint(nil, s.WindowStart)
+	return binary.AppendVarint(data, int64(s.Count)), nil
+}
+
+// UnmarshalBinary decodes the form written by MarshalBinary
+func (s *fixedWindowState) UnmarshalBinary(data []byte) error {
+	r := stateReader{data: data}
+	s.WindowStart = r.varint()
+	s.Count = int(r.varint())
+	return r.close()
+}
+
+// MarshalBinary encodes the current window start and the counters of both windows
+func (s slidingWindowCounterState) MarshalBinary() ([]byte, error) {
+	data := binary.AppendVarint(nil, s.WindowStart)
+	data = binary.AppendVarint(data, int64(s.CurrentCount))
+	return binary.AppendVarint(data, int64(s.PreviousCount)), nil
+}
+
+// UnmarshalBinary decodes the form written by MarshalBinary
+func (s *slidingWindowCounterState) UnmarshalBinary(data []byte) error {
+	r := stateReader{data: data}
+	s.WindowStart = r.varint()
+	s.CurrentCount = int(r.varint())
+	s.PreviousCount = int(r.varint())
+	return r.close()
+}
+
+// MarshalBinary encodes the theoretical arrival time
+func (s gcraState) MarshalBinary() ([]byte, error) {
+	return binary.AppendVarint(nil, s.TAT), nil
+}
+
+// UnmarshalBinary decodes the form written by MarshalBinary
+func (s *gcraState) UnmarshalBinary(data []byte) error {
+	r := stateReader{data: data}
+	s.TAT = r.varint()
+	return r.close()
+}
+
+// MarshalBinary encodes the departure time of the next queued request
+func (s leakyBucketState) MarshalBinary() ([]byte, error) {
+	return binary.AppendVarint(nil, s.NextDeparture), nil
+}
+
+// UnmarshalBinary decodes the form written by MarshalBinary
+func (s *leakyBucketState) UnmarshalBinary(data []byte) error {
+	r := stateReader{data: data}
+	s.NextDeparture = r.varint()
+	return r.close()
+}
+
+// MarshalBinary encodes the number of leases followed by the ID and expiration of each
+func (s concurrencyState) MarshalBinary() ([]byte, error) {
+	data := binary.AppendUvarint(nil, uint64(len(s.Leases)))
+	for id, expiresAt := range s.Leases {
+		data = binary.AppendUvarint(data, uint64(len(id)))
+		data = append(data, id...)
+		data = binary.AppendVarint(data, expiresAt)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes the form written by MarshalBinary
+func (s *concurrencyState) UnmarshalBinary(data []byte) error {
+	r := stateReader{data: data}
+	n := r.uvarint()
+	// Every lease takes at least two bytes, which bounds the allocation for corrupt state
+	if n > uint64(len(data)) {
+		return errInvalidBinaryState
+	}
+	s.Leases = make(map[string]int64, n)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		id := string(r.bytes(r.uvarint()))
+		s.Leases[id] = r.varint()
+	}
+	return r.close()
+}
+
+// stateReader reads the fields of binary state, remembering the first error
+type stateReader struct {
+	data []byte
+	err  error
+}
+
+func (r *stateReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errInvalidBinaryState
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *stateReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errInvalidBinaryState
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *stateReader) uint64() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 8 {
+		r.err = errInvalidBinaryState
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.data)
+	r.data = r.data[8:]
+	return v
+}
+
+func (r *stateReader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.data)) {
+		r.err = errInvalidBinaryState
+		return nil
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v
+}
+
+// close returns the first error, or an error if bytes were left unread
+func (r *stateReader) close() error {
+	if r.err == nil && len(r.data) > 0 {
+		r.err = errInvalidBinaryState
+	}
+	return r.err
+}
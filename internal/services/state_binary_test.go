@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+func TestBinaryState_RoundTrip(t *testing.T) {
+	codec, err := storage.NewStateCodec(storage.StateCodecBinary)
+	if err != nil {
+		t.Fatalf("NewStateCodec failed: %v", err)
+	}
+	now := time.Now().UnixNano()
+
+	tests := []struct {
+		name    string
+		state   interface{}
+		decoded interface{}
+	}{
+		{"token bucket", tokenBucketState{Tokens: 2.75, LastRefill: now}, &tokenBucketState{}},
+		{"sliding window", slidingWindowState{Timestamps: []int64{now - 2e9, now - 1e9, now - 1e9, now}}, &slidingWindowState{}},
+		{"empty sliding window", slidingWindowState{Timestamps: []int64{}}, &slidingWindowState{}},
+		{"fixed window", fixedWindowState{WindowStart: now, Count: 42}, &fixedWindowState{}},
+		{"sliding window counter", slidingWindowCounterState{WindowStart: now, CurrentCount: 3, PreviousCount: 9}, &slidingWindowCounterState{}},
+		{"gcra", gcraState{TAT: now}, &gcraState{}},
+		{"leaky bucket", leakyBucketState{NextDeparture: now}, &leakyBucketState{}},
+		{"concurrency", concurrencyState{Leases: map[string]int64{"a": now, "lease-b": now + 1}}, &concurrencyState{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := codec.Encode(tt.state)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if err := storage.DecodeState(encoded, tt.decoded); err != nil {
+				t.Fatalf("DecodeState failed: %v", err)
+			}
+			if decoded := reflect.ValueOf(tt.decoded).Elem().Interface(); !reflect.DeepEqual(decoded, tt.state) {
+				t.Errorf("Expected %+v, got %+v", tt.state, decoded)
+			}
+
+			// Truncated state is rejected instead of decoded partially
+			if err := storage.DecodeState(encoded[:len(encoded)-1], tt.decoded); err == nil {
+				t.Error("Expected error for truncated state")
+			}
+		})
+	}
+}
+
+func TestBinaryState_SlidingWindowSize(t *testing.T) {
+	codec, _ := storage.NewStateCodec(storage.StateCodecBinary)
+
+	// A thousand requests over a second
+	state := slidingWindowState{Timestamps: make([]int64, 1000)}
+	start := time.Now().UnixNano()
+	for i := range state.Timestamps {
+		state.Timestamps[i] = start + int64(i)*int64(time.Millisecond)
+	}
+
+	binaryState, _ := codec.Encode(state)
+	jsonState, _ := json.Marshal(state)
+	if len(binaryState)*5 > len(jsonState) {
+		t.Errorf("Expected binary state to be at least 5x smaller than JSON, got %d and %d bytes", len(binaryState), len(jsonState))
+	}
+}
+
+func TestBinaryState_ReadsLegacyJSON(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	open := func(codec string) *storage.SQLStorage {
+		s, err := storage.NewSQLStorage(config.StorageConfig{SQLDriver: "sqlite", SQLDSN: path, StateCodec: codec}, nil, logger)
+		if err != nil {
+			t.Fatalf("NewSQLStorage failed: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+
+	// State written before the switch to the binary codec
+	legacy := open(storage.StateCodecJSON)
+	limiter := NewSlidingWindowLimiter(legacy, 5, time.Minute, nil, logger)
+	if allowed := countAllowed(t, 3, func() (bool, error) { return limiter.Allow(ctx, "key") }); allowed != 3 {
+		t.Fatalf("Expected 3 requests allowed, got %d", allowed)
+	}
+	legacy.Close()
+
+	// The binary codec continues from the JSON state and replaces it
+	migrated := open(storage.StateCodecBinary)
+	limiter = NewSlidingWindowLimiter(migrated, 5, time.Minute, nil, logger)
+	if allowed := countAllowed(t, 5, func() (bool, error) { return limiter.Allow(ctx, "key") }); allowed != 2 {
+		t.Errorf("Expected 2 requests allowed after migration, got %d", allowed)
+	}
+	value, err := migrated.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if data := value.(string); len(data) == 0 || data[0] == '{' {
+		t.Errorf("Expected state to be rewritten in binary form, got %q", data)
+	}
+}
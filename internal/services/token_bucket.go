@@ -2,148 +2,209 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
 	"time"
 
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
 )
 
 // TokenBucketLimiter implements the Token Bucket algorithm
-// Tokens are refilled at a constant rate, allowing for burst capacity
+// Tokens are refilled at a constant rate (limit per window) into a bucket holding up to burst tokens,
+// so the sustained rate and the burst capacity are configured independently
 type TokenBucketLimiter struct {
 	storage storage.Storage
 	limit   int
 	window  time.Duration
+	burst   int
+	clock   clock.Clock
 	logger  *slog.Logger
 }
 
-// NewTokenBucketLimiter creates a new Token Bucket limiter
+// NewTokenBucketLimiter creates a new Token Bucket limiter.
+// A burst of 0 makes the bucket hold limit tokens.
 func NewTokenBucketLimiter(
 	storage storage.Storage,
 	limit int,
 	window time.Duration,
+	burst int,
+	clk clock.Clock,
 	logger *slog.Logger,
 ) *TokenBucketLimiter {
 	if logger == nil {
 		logger = slog.Default()
 	}
+	if clk == nil {
+		clk = clock.System()
+	}
+	if burst <= 0 {
+		burst = limit
+	}
 	return &TokenBucketLimiter{
 		storage: storage,
 		limit:   limit,
 		window:  window,
+		burst:   burst,
+		clock:   clk,
 		logger:  logger,
 	}
 }
 
+// tokenEpsilon absorbs floating point error of fractional refills,
+// so that refills adding up to a whole token are counted as one
+const tokenEpsilon = 1e-9
+
 // tokenBucketState represents the state of a token bucket
 type tokenBucketState struct {
-	Tokens     int   `json:"tokens"`
-	LastRefill int64 `json:"last_refill"` // Unix timestamp in nanoseconds
+	Tokens     float64 `json:"tokens"`      // Fractional, so that slow refill rates do not lose partial tokens
+	LastRefill int64   `json:"last_refill"` // Unix timestamp in nanoseconds
 }
 
 // Allow checks if a request should be allowed using Token Bucket algorithm
 func (t *TokenBucketLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return allowed(t.Decide(ctx, key, 1))
+}
+
+// AllowN checks if a request consuming n tokens should be allowed
+func (t *TokenBucketLimiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	return allowed(t.Decide(ctx, key, n))
+}
+
+// Decide checks if a request consuming n tokens should be allowed and reports the bucket state
+func (t *TokenBucketLimiter) Decide(ctx context.Context, key string, n int) (interfaces.Decision, error) {
 	// Check context cancellation
 	select {
 	case <-ctx.Done():
 		t.logger.Warn("Allow operation cancelled", "key", key, "error", ctx.Err())
-		return false, ctx.Err()
+		return interfaces.Decision{}, ctx.Err()
 	default:
 	}
 
-	now := time.Now()
-	refillRate := float64(t.limit) / t.window.Seconds()
+	if err := validateCost(n); err != nil {
+		t.logger.Warn("Invalid cost", "key", key, "cost", n)
+		return interfaces.Decision{}, err
+	}
 
-	// Get current state
-	stateData, err := t.storage.Get(ctx, key)
+	decision, err := t.decideAt(ctx, key, n, t.clock.Now())
 	if err != nil {
-		t.logger.Error("Failed to get bucket state", "key", key, "error", err)
-		return false, fmt.Errorf("failed to get bucket state: %w", err)
+		return interfaces.Decision{}, err
+	}
+
+	if !decision.Allowed {
+		t.logger.Debug("Request denied: not enough tokens available",
+			"key", key,
+			"cost", n,
+			"retry_after", decision.RetryAfter,
+		)
+		return decision, nil
 	}
 
+	t.logger.Debug("Request allowed", "key", key, "cost", n, "remaining", decision.Remaining)
+	return decision, nil
+}
+
+// decideAt evaluates a request consuming n tokens arriving at now
+func (t *TokenBucketLimiter) decideAt(ctx context.Context, key string, n int, now time.Time) (interfaces.Decision, error) {
+	// Let the storage evaluate the bucket atomically when it supports it,
+	// so that concurrent replicas cannot both consume the last token.
+	if evaluator, ok := t.storage.(storage.TokenBucketEvaluator); ok {
+		allowed, tokens, lastRefill, err := evaluator.EvalTokenBucket(ctx, key, t.limit, t.window, t.burst, n, now)
+		if err != nil {
+			t.logger.Error("Failed to evaluate token bucket", "key", key, "error", err)
+			return interfaces.Decision{}, fmt.Errorf("failed to evaluate token bucket: %w", err)
+		}
+		return t.decision(allowed, n, tokenBucketState{Tokens: tokens, LastRefill: lastRefill}, now), nil
+	}
+
+	var allowed bool
 	var state tokenBucketState
+	err := t.storage.Update(ctx, key, func(stateData interface{}) (interface{}, int64, error) {
+		state = t.refill(key, stateData, now)
+
+		// Check if we have enough tokens available
+		allowed = state.Tokens+tokenEpsilon >= float64(n)
+		if allowed {
+			// Consume the tokens
+			state.Tokens = math.Max(state.Tokens-float64(n), 0)
+		}
+
+		// State is saved even if the request is denied
+		// Once the bucket is full again the state is equivalent to a new one
+		return state, expirationAt(t.refilledAt(state, float64(t.burst)-state.Tokens), 0), nil
+	})
+	if err != nil {
+		t.logger.Error("Failed to update bucket state", "key", key, "error", err)
+		return interfaces.Decision{}, fmt.Errorf("failed to update bucket state: %w", err)
+	}
+
+	return t.decision(allowed, n, state, now), nil
+}
+
+// decision derives the remaining tokens, reset and retry times from the bucket state after evaluation
+func (t *TokenBucketLimiter) decision(allowed bool, n int, state tokenBucketState, now time.Time) interfaces.Decision {
+	decision := interfaces.Decision{
+		Allowed:   allowed,
+		Limit:     t.burst,
+		Remaining: int(math.Floor(state.Tokens + tokenEpsilon)),
+		ResetAt:   now,
+	}
+	if state.Tokens < float64(t.burst) {
+		decision.ResetAt = t.refilledAt(state, float64(t.burst)-state.Tokens)
+	}
+	if !allowed && n <= t.burst {
+		decision.RetryAfter = durationUntil(t.refilledAt(state, float64(n)-state.Tokens), now)
+	}
+	return decision
+}
+
+// refilledAt returns the time at which k more tokens have been refilled into the bucket
+func (t *TokenBucketLimiter) refilledAt(state tokenBucketState, k float64) time.Time {
+	elapsed := math.Ceil(k * t.tokenInterval())
+	return time.Unix(0, state.LastRefill).Add(time.Duration(elapsed))
+}
+
+// tokenInterval returns the time it takes to refill a single token in nanoseconds
+func (t *TokenBucketLimiter) tokenInterval() float64 {
+	return float64(t.window) / float64(t.limit)
+}
+
+// refill decodes the stored bucket state and adds the tokens accumulated since the last refill
+func (t *TokenBucketLimiter) refill(key string, stateData interface{}, now time.Time) tokenBucketState {
 	if stateData == nil {
 		// Initialize bucket with full tokens
-		state = tokenBucketState{
-			Tokens:     t.limit,
+		t.logger.Debug("Initialized new token bucket", "key", key, "tokens", t.burst)
+		return tokenBucketState{
+			Tokens:     float64(t.burst),
 			LastRefill: now.UnixNano(),
 		}
-		t.logger.Debug("Initialized new token bucket", "key", key, "tokens", t.limit)
-	} else {
-		// Parse state
-		var stateJSON string
-		switch v := stateData.(type) {
-		case string:
-			stateJSON = v
-		default:
-			data, err := json.Marshal(v)
-			if err != nil {
-				t.logger.Error("Failed to marshal state", "key", key, "error", err)
-				return false, fmt.Errorf("failed to marshal state: %w", err)
-			}
-			stateJSON = string(data)
-		}
-
-		if err := json.Unmarshal([]byte(stateJSON), &state); err != nil {
-			// If unmarshal fails, reset bucket
-			t.logger.Warn("Failed to unmarshal state, resetting bucket", "key", key, "error", err)
-			state = tokenBucketState{
-				Tokens:     t.limit,
-				LastRefill: now.UnixNano(),
-			}
-		} else {
-			// Refill tokens based on time elapsed since last refill/emptying
-			elapsedSeconds := float64(now.UnixNano()-state.LastRefill) / float64(time.Second)
-			if elapsedSeconds > 0 {
-				tokensToAdd := int(elapsedSeconds * refillRate)
-				if tokensToAdd > 0 {
-					oldTokens := state.Tokens
-					state.Tokens = min(state.Tokens+tokensToAdd, t.limit)
-					state.LastRefill = now.UnixNano()
-					t.logger.Debug("Tokens refilled",
-						"key", key,
-						"old_tokens", oldTokens,
-						"added", tokensToAdd,
-						"new_tokens", state.Tokens,
-					)
-				}
-			}
-		}
 	}
 
-	// Check if we have tokens available
-	if state.Tokens <= 0 {
-		// Save state even if request is denied
-		stateJSON, _ := json.Marshal(state)
-		expiration := now.Add(t.window).Unix()
-		if err := t.storage.Set(ctx, key, string(stateJSON), expiration); err != nil {
-			t.logger.Error("Failed to save bucket state", "key", key, "error", err)
-			return false, fmt.Errorf("failed to save bucket state: %w", err)
+	var state tokenBucketState
+	if err := decodeState(stateData, &state); err != nil {
+		// If unmarshal fails, reset bucket
+		t.logger.Warn("Failed to unmarshal state, resetting bucket", "key", key, "error", err)
+		return tokenBucketState{
+			Tokens:     float64(t.burst),
+			LastRefill: now.UnixNano(),
 		}
-		t.logger.Debug("Request denied: no tokens available", "key", key)
-		return false, nil
 	}
 
-	// Consume a token
-	state.Tokens--
-	// When the bucket becomes empty, move the refill reference point
-	// to the moment of emptying so that new tokens start accumulating
-	// from this time, not from the initial creation time.
-	if state.Tokens == 0 {
+	// Refill tokens based on time elapsed since last refill, keeping the fraction of a token
+	elapsed := now.UnixNano() - state.LastRefill
+	if elapsed > 0 {
+		oldTokens := state.Tokens
+		state.Tokens = math.Min(state.Tokens+float64(elapsed)/t.tokenInterval(), float64(t.burst))
 		state.LastRefill = now.UnixNano()
+		t.logger.Debug("Tokens refilled",
+			"key", key,
+			"old_tokens", oldTokens,
+			"new_tokens", state.Tokens,
+		)
 	}
-	stateJSON, _ := json.Marshal(state)
-	expiration := now.Add(t.window).Unix()
-	if err := t.storage.Set(ctx, key, string(stateJSON), expiration); err != nil {
-		t.logger.Error("Failed to save bucket state", "key", key, "error", err)
-		return false, fmt.Errorf("failed to save bucket state: %w", err)
-	}
-
-	t.logger.Debug("Request allowed", "key", key, "remaining_tokens", state.Tokens)
-	return true, nil
+	return state
 }
 
 // min returns the minimum of two integers
@@ -4,16 +4,19 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
 	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
 )
 
 func TestTokenBucketLimiter_Allow(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
-	limiter := NewTokenBucketLimiter(memStorage, 5, time.Second, logger)
+	clk := clock.NewFake(time.Now())
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewTokenBucketLimiter(memStorage, 5, time.Second, 0, clk, logger)
 	ctx := context.Background()
 
 	key := "test-key"
@@ -41,9 +44,10 @@ func TestTokenBucketLimiter_Allow(t *testing.T) {
 
 func TestTokenBucketLimiter_TokenRefill(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
+	clk := clock.NewFake(time.Now())
+	memStorage := storage.NewMemoryStorage(clk, logger)
 	// 2 tokens per second
-	limiter := NewTokenBucketLimiter(memStorage, 2, time.Second, logger)
+	limiter := NewTokenBucketLimiter(memStorage, 2, time.Second, 0, clk, logger)
 	ctx := context.Background()
 
 	key := "refill-key"
@@ -68,8 +72,8 @@ func TestTokenBucketLimiter_TokenRefill(t *testing.T) {
 		t.Error("Request should be denied when no tokens available")
 	}
 
-	// Wait for token refill (slightly more than 0.5 seconds for 1 token)
-	time.Sleep(600 * time.Millisecond)
+	// Half a second refills one token
+	clk.Advance(500 * time.Millisecond)
 
 	// Should allow one more request
 	allowed, err = limiter.Allow(ctx, key)
@@ -81,10 +85,169 @@ func TestTokenBucketLimiter_TokenRefill(t *testing.T) {
 	}
 }
 
+func TestTokenBucketLimiter_Decide(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	clk := clock.NewFake(time.Now())
+	for name, store := range counterTestStorages(t, clk, logger) {
+		t.Run(name, func(t *testing.T) {
+			// 3 tokens per 3 seconds: one token is refilled every second
+			limiter := NewTokenBucketLimiter(store, 3, 3*time.Second, 0, clk, logger)
+			ctx := context.Background()
+			now := clk.Now()
+
+			for i := 0; i < 3; i++ {
+				decision, err := limiter.Decide(ctx, "key", 1)
+				if err != nil {
+					t.Fatalf("Decide failed: %v", err)
+				}
+				if !decision.Allowed || decision.Limit != 3 || decision.Remaining != 2-i {
+					t.Errorf("Request %d: expected allowed with %d remaining, got %+v", i+1, 2-i, decision)
+				}
+			}
+
+			clk.Advance(500 * time.Millisecond)
+			denied, err := limiter.Decide(ctx, "key", 2)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if denied.Allowed || denied.Remaining != 0 {
+				t.Errorf("Expected empty bucket to deny, got %+v", denied)
+			}
+			// Two tokens are back two seconds after the bucket was drained
+			if denied.RetryAfter != 1500*time.Millisecond {
+				t.Errorf("Expected retry after 1.5s, got %v", denied.RetryAfter)
+			}
+			if !denied.ResetAt.Equal(now.Add(3 * time.Second)) {
+				t.Errorf("Expected bucket to be full at %v, got %v", now.Add(3*time.Second), denied.ResetAt)
+			}
+		})
+	}
+}
+
+func TestTokenBucketLimiter_Burst(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	clk := clock.NewFake(time.Now())
+	for name, store := range counterTestStorages(t, clk, logger) {
+		t.Run(name, func(t *testing.T) {
+			// 10 requests per second, bursting to 50
+			limiter := NewTokenBucketLimiter(store, 10, time.Second, 50, clk, logger)
+			ctx := context.Background()
+			now := clk.Now()
+
+			for i := 0; i < 50; i++ {
+				decision, err := limiter.Decide(ctx, "key", 1)
+				if err != nil {
+					t.Fatalf("Decide failed: %v", err)
+				}
+				if !decision.Allowed {
+					t.Fatalf("Request %d should be allowed within the burst", i+1)
+				}
+			}
+
+			denied, err := limiter.Decide(ctx, "key", 1)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if denied.Allowed || denied.Limit != 50 {
+				t.Errorf("Expected request beyond the burst denied with limit 50, got %+v", denied)
+			}
+			// Tokens come back at the sustained rate, not the burst size
+			if denied.RetryAfter != 100*time.Millisecond {
+				t.Errorf("Expected retry after 100ms, got %v", denied.RetryAfter)
+			}
+			if !denied.ResetAt.Equal(now.Add(5 * time.Second)) {
+				t.Errorf("Expected bucket to be full at %v, got %v", now.Add(5*time.Second), denied.ResetAt)
+			}
+
+			clk.Advance(100 * time.Millisecond)
+			allowed, err := limiter.Decide(ctx, "key", 1)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if !allowed.Allowed {
+				t.Error("Request should be allowed after one token was refilled")
+			}
+		})
+	}
+}
+
+func TestTokenBucketLimiter_FractionalRefill(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	clk := clock.NewFake(time.Now())
+	for name, store := range counterTestStorages(t, clk, logger) {
+		t.Run(name, func(t *testing.T) {
+			// 2 tokens per 3 seconds: one token every 1.5s
+			limiter := NewTokenBucketLimiter(store, 2, 3*time.Second, 0, clk, logger)
+			ctx := context.Background()
+			now := clk.Now()
+
+			steps := []struct {
+				at      time.Duration
+				cost    int
+				allowed bool
+			}{
+				{at: 0, cost: 2, allowed: true},
+				{at: time.Second, cost: 1, allowed: false}, // 0.67 tokens
+				{at: 2 * time.Second, cost: 1, allowed: true},
+				// 0.33 tokens were left over from the previous refill and must not be lost
+				{at: 3 * time.Second, cost: 1, allowed: true},
+				{at: 4 * time.Second, cost: 1, allowed: false},
+			}
+
+			for i, step := range steps {
+				clk.Set(now.Add(step.at))
+				decision, err := limiter.Decide(ctx, "key", step.cost)
+				if err != nil {
+					t.Fatalf("Decide failed: %v", err)
+				}
+				if decision.Allowed != step.allowed {
+					t.Errorf("Step %d (at %v): expected allowed=%v, got %v", i+1, step.at, step.allowed, decision.Allowed)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenBucketLimiter_SnapshotRestore(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	path := filepath.Join(t.TempDir(), "memory.snapshot")
+	ctx := context.Background()
+	clk := clock.NewFake(time.Now())
+
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewTokenBucketLimiter(memStorage, 5, time.Minute, 0, clk, logger)
+	if decision, err := limiter.Decide(ctx, "key", 4); err != nil || !decision.Allowed {
+		t.Fatalf("Expected first request to be allowed, got %+v, %v", decision, err)
+	}
+	if _, err := memStorage.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	// A restarted service continues with the restored bucket instead of a full one
+	restoredStorage := storage.NewMemoryStorage(clk, logger)
+	if _, err := restoredStorage.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	restored := NewTokenBucketLimiter(restoredStorage, 5, time.Minute, 0, clk, logger)
+	decision, err := restored.Decide(ctx, "key", 2)
+	if err != nil {
+		t.Fatalf("Decide failed: %v", err)
+	}
+	if decision.Allowed {
+		t.Error("Request exceeding the restored tokens should be denied")
+	}
+	if decision.Remaining != 1 {
+		t.Errorf("Expected 1 remaining token, got %d", decision.Remaining)
+	}
+}
+
 func TestTokenBucketLimiter_ContextCancellation(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
-	limiter := NewTokenBucketLimiter(memStorage, 5, time.Second, logger)
+	memStorage := storage.NewMemoryStorage(nil, logger)
+	limiter := NewTokenBucketLimiter(memStorage, 5, time.Second, 0, nil, logger)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
@@ -97,8 +260,9 @@ func TestTokenBucketLimiter_ContextCancellation(t *testing.T) {
 
 func TestTokenBucketLimiter_DifferentKeys(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	memStorage := storage.NewMemoryStorage(logger)
-	limiter := NewTokenBucketLimiter(memStorage, 2, time.Second, logger)
+	clk := clock.NewFake(time.Now())
+	memStorage := storage.NewMemoryStorage(clk, logger)
+	limiter := NewTokenBucketLimiter(memStorage, 2, time.Second, 0, clk, logger)
 	ctx := context.Background()
 
 	key1 := "key1"
@@ -0,0 +1,501 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// Defaults of the memory cluster used when none are configured
+const (
+	DefaultClusterRefreshInterval = 5 * time.Second
+	DefaultClusterForwardTimeout  = time.Second
+)
+
+// clusterUpdateMaxRetries bounds the compare-and-swap retries of Update on a remote owner
+const clusterUpdateMaxRetries = 1000
+
+// clusterRebalanceTimeout bounds the handoff of the keys owned by other nodes
+const clusterRebalanceTimeout = 30 * time.Second
+
+// errCompareMismatch aborts a local compare-and-swap whose expected value is outdated
+var errCompareMismatch = errors.New("storage: compare-and-swap mismatch")
+
+// ClusterEnabled reports whether cfg configures the peers of a memory cluster
+func ClusterEnabled(cfg config.StorageConfig) bool {
+	return len(cfg.ClusterPeers) > 0 || cfg.ClusterDNS != ""
+}
+
+// ClusterStorage runs memory storage on several replicas without a shared backend.
+//
+// Every key is owned by one node of a consistent-hash ring. The owner keeps the state in its
+// MemoryStorage, the other nodes forward their operations to it over the internal HTTP
+// endpoint served by Handler. Limiters are evaluated by the owner in a single round trip,
+// under the lock of the key in its MemoryStorage, as Redis evaluates them in Lua scripts.
+// Update runs an arbitrary function, which cannot be forwarded; on a remote owner it is an
+// optimistic compare-and-swap retried while the value keeps changing, as Update of RedisStorage.
+//
+// Members come from a static peer list or a DNS name, and are probed every refresh interval.
+// When a node joins or leaves, the ring is rebuilt and every node hands the keys it no longer
+// owns over to their new owner; Close hands off all keys of the node. Checks racing with a
+// handoff, or answered by a node that has not noticed the change yet, may be counted on the
+// previous owner. Keys of a node that fails without closing start over on their new owner.
+type ClusterStorage struct {
+	local      *MemoryStorage
+	codec      StateCodec
+	keys       KeyNamespace
+	self       string
+	peers      []string
+	dns        string
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	secret     string
+	client     *http.Client
+	clock      clock.Clock
+	interval   time.Duration
+	logger     *slog.Logger
+
+	mu      sync.RWMutex
+	ring    *hashRing
+	handoff bool // Keys owned by other nodes are left after a failed handoff
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewClusterStorage creates the memory storage of this node, cfg.ClusterAdvertiseAddress, in the cluster
+// of cfg.ClusterPeers or cfg.ClusterDNS. The local storage is bounded as configured by cfg.
+// metrics and clk may be nil.
+func NewClusterStorage(cfg config.StorageConfig, metrics MemoryMetrics, clk clock.Clock, logger *slog.Logger) (*ClusterStorage, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if clk == nil {
+		clk = clock.System()
+	}
+	if cfg.ClusterAdvertiseAddress == "" {
+		return nil, fmt.Errorf("cluster advertise address is required")
+	}
+	// The internal endpoint is served on the API port, so it must never be left open
+	if cfg.ClusterSecret == "" {
+		return nil, fmt.Errorf("cluster secret is required")
+	}
+	if len(cfg.ClusterPeers) > 0 && cfg.ClusterDNS != "" {
+		return nil, fmt.Errorf("cluster peers and cluster DNS are mutually exclusive")
+	}
+	if cfg.ClusterDNS != "" {
+		if _, _, err := net.SplitHostPort(cfg.ClusterDNS); err != nil {
+			return nil, fmt.Errorf("invalid cluster DNS address: %w", err)
+		}
+	}
+	if cfg.ClusterRefreshInterval < 0 {
+		return nil, fmt.Errorf("cluster refresh interval must not be negative, got %v", cfg.ClusterRefreshInterval)
+	}
+	if cfg.ClusterForwardTimeout < 0 {
+		return nil, fmt.Errorf("cluster forward timeout must not be negative, got %v", cfg.ClusterForwardTimeout)
+	}
+
+	codec, err := NewStateCodec(cfg.StateCodec)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := configuredKeyNamespace(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are namespaced before they are hashed and forwarded, the local storage keeps them as they are
+	localCfg := cfg
+	localCfg.KeyPrefix = ""
+	localCfg.Namespace = ""
+	local, err := NewMemoryStorageWithConfig(localCfg, metrics, clk, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := cfg.ClusterRefreshInterval
+	if interval == 0 {
+		interval = DefaultClusterRefreshInterval
+	}
+	timeout := cfg.ClusterForwardTimeout
+	if timeout == 0 {
+		timeout = DefaultClusterForwardTimeout
+	}
+
+	c := &ClusterStorage{
+		local:      local,
+		codec:      codec,
+		keys:       keys,
+		self:       cfg.ClusterAdvertiseAddress,
+		peers:      cfg.ClusterPeers,
+		dns:        cfg.ClusterDNS,
+		lookupHost: net.DefaultResolver.LookupHost,
+		secret:     cfg.ClusterSecret,
+		client:     &http.Client{Timeout: timeout},
+		clock:      clk,
+		interval:   interval,
+		logger:     logger,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	// Until the first probe, every configured peer is assumed to be up,
+	// so that replicas starting together agree on the ring right away
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	members, err := c.candidates(ctx)
+	cancel()
+	if err != nil {
+		logger.Error("Failed to resolve cluster peers, starting alone", "dns", c.dns, "error", err)
+		members = []string{c.self}
+	}
+	c.ring = newHashRing(members)
+	go c.run()
+
+	logger.Info("Cluster storage configured",
+		"node", c.self,
+		"members", members,
+		"dns", c.dns,
+		"refresh_interval", interval,
+		"forward_timeout", timeout,
+		"key_prefix", keys.Prefix(),
+	)
+	return c, nil
+}
+
+// Members returns the nodes of the ring, including this one
+func (c *ClusterStorage) Members() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.ring.nodes...)
+}
+
+// owner returns the node owning a namespaced key
+func (c *ClusterStorage) owner(key string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ring.owner(key)
+}
+
+// Get retrieves a value from the owner of key as the stored string, see DecodeState
+func (c *ClusterStorage) Get(ctx context.Context, key string) (interface{}, error) {
+	key = c.keys.Key(key)
+	owner := c.owner(key)
+	if owner == c.self {
+		return c.local.Get(ctx, key)
+	}
+
+	value, found, err := c.remoteGet(ctx, owner, key)
+	if err != nil {
+		c.logger.Error("Failed to get value from cluster peer", "key", key, "owner", owner, "error", err)
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+	return string(value), nil
+}
+
+// Set stores a value on the owner of key with optional expiration
+func (c *ClusterStorage) Set(ctx context.Context, key string, value interface{}, expiration int64) error {
+	key = c.keys.Key(key)
+	encoded, err := c.codec.Encode(value)
+	if err != nil {
+		c.logger.Error("Failed to marshal value", "key", key, "error", err)
+		return err
+	}
+
+	owner := c.owner(key)
+	if owner == c.self {
+		return c.local.Set(ctx, key, string(encoded), expiration)
+	}
+	if err := c.remoteSet(ctx, owner, key, encoded, expiration); err != nil {
+		c.logger.Error("Failed to set value on cluster peer", "key", key, "owner", owner, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Delete removes a value from the owner of key
+func (c *ClusterStorage) Delete(ctx context.Context, key string) error {
+	key = c.keys.Key(key)
+	owner := c.owner(key)
+	if owner == c.self {
+		return c.local.Delete(ctx, key)
+	}
+	if err := c.remoteDelete(ctx, owner, key); err != nil {
+		c.logger.Error("Failed to delete value on cluster peer", "key", key, "owner", owner, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Update atomically replaces the value of key on its owner.
+// A remote owner is updated by compare-and-swap, retried while the value changes concurrently;
+// limiters use the evaluators instead, which take a single round trip.
+func (c *ClusterStorage) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	key = c.keys.Key(key)
+	owner := c.owner(key)
+	if owner == c.self {
+		return c.local.Update(ctx, key, func(current interface{}) (interface{}, int64, error) {
+			value, expiration, err := fn(current)
+			if err != nil {
+				return nil, 0, err
+			}
+			encoded, err := c.codec.Encode(value)
+			if err != nil {
+				return nil, 0, err
+			}
+			return string(encoded), expiration, nil
+		})
+	}
+
+	current, found, err := c.remoteGet(ctx, owner, key)
+	if err != nil {
+		c.logger.Error("Failed to get value from cluster peer", "key", key, "owner", owner, "error", err)
+		return err
+	}
+	for attempt := 0; attempt < clusterUpdateMaxRetries; attempt++ {
+		var state interface{}
+		if found {
+			state = string(current)
+		}
+		value, expiration, err := fn(state)
+		if err != nil {
+			return err
+		}
+		encoded, err := c.codec.Encode(value)
+		if err != nil {
+			return err
+		}
+
+		swapped, latest, latestFound, err := c.remoteCompareAndSwap(ctx, owner, key, current, found, encoded, expiration)
+		if err != nil {
+			c.logger.Error("Failed to update value on cluster peer", "key", key, "owner", owner, "error", err)
+			return err
+		}
+		if swapped {
+			c.logger.Debug("Value updated on cluster peer", "key", key, "owner", owner, "attempts", attempt+1)
+			return nil
+		}
+		// Another node updated the key first, retry with its value
+		current, found = latest, latestFound
+	}
+
+	c.logger.Warn("Update retries exhausted", "key", key, "owner", owner, "retries", clusterUpdateMaxRetries)
+	return ErrUpdateConflict
+}
+
+// Close hands the keys of this node over to the remaining members and closes the local storage
+func (c *ClusterStorage) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+		c.leave()
+		err = c.local.Close()
+	})
+	return err
+}
+
+// compareAndSwap stores value at key if the local value is still expected, absent if expectedFound is false.
+// It returns whether the value was swapped and the current value otherwise.
+func (c *ClusterStorage) compareAndSwap(
+	ctx context.Context,
+	key string,
+	expected []byte,
+	expectedFound bool,
+	value []byte,
+	expiration int64,
+) (bool, []byte, bool, error) {
+	var current []byte
+	var found bool
+	err := c.local.Update(ctx, key, func(stored interface{}) (interface{}, int64, error) {
+		s, _ := stored.(string)
+		current, found = []byte(s), stored != nil
+		if found != expectedFound || (found && s != string(expected)) {
+			return nil, 0, errCompareMismatch
+		}
+		return string(value), expiration, nil
+	})
+	if errors.Is(err, errCompareMismatch) {
+		return false, current, found, nil
+	}
+	if err != nil {
+		return false, nil, false, err
+	}
+	return true, nil, false, nil
+}
+
+// run refreshes the membership every interval until the storage is closed
+func (c *ClusterStorage) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.refresh(context.Background())
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// candidates returns the configured members: the static peers or the addresses the DNS name resolves to,
+// always including this node
+func (c *ClusterStorage) candidates(ctx context.Context) ([]string, error) {
+	members := []string{c.self}
+	seen := map[string]bool{c.self: true}
+	add := func(node string) {
+		if !seen[node] {
+			seen[node] = true
+			members = append(members, node)
+		}
+	}
+
+	if c.dns == "" {
+		for _, peer := range c.peers {
+			add(peer)
+		}
+		return members, nil
+	}
+
+	host, port, err := net.SplitHostPort(c.dns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster DNS address: %w", err)
+	}
+	addrs, err := c.lookupHost(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve cluster DNS name: %w", err)
+	}
+	for _, addr := range addrs {
+		add(net.JoinHostPort(addr, port))
+	}
+	return members, nil
+}
+
+// refresh probes the configured members, rebuilds the ring if the reachable members changed
+// and hands the keys this node no longer owns over to their owner
+func (c *ClusterStorage) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, clusterRebalanceTimeout)
+	defer cancel()
+
+	candidates, err := c.candidates(ctx)
+	if err != nil {
+		// Keep the current ring rather than shrinking it on a DNS hiccup
+		c.logger.Error("Failed to refresh cluster members", "error", err)
+		return
+	}
+	members := c.probe(ctx, candidates)
+
+	c.mu.Lock()
+	changed := !c.ring.equal(members)
+	if changed {
+		c.ring = newHashRing(members)
+		c.handoff = true
+	}
+	handoff := c.handoff
+	c.mu.Unlock()
+
+	if changed {
+		c.logger.Info("Cluster membership changed", "node", c.self, "members", members)
+	}
+	if handoff {
+		c.rebalance(ctx)
+	}
+}
+
+// probe returns this node and the candidates answering a ping
+func (c *ClusterStorage) probe(ctx context.Context, candidates []string) []string {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	members := []string{c.self}
+	for _, node := range candidates {
+		if node == c.self {
+			continue
+		}
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			if err := c.ping(ctx, node); err != nil {
+				c.logger.Debug("Cluster peer unreachable", "peer", node, "error", err)
+				return
+			}
+			mu.Lock()
+			members = append(members, node)
+			mu.Unlock()
+		}(node)
+	}
+	wg.Wait()
+	return members
+}
+
+// rebalance hands every local key owned by another node over to it.
+// A key is only deleted locally once the owner stored it. The owner keeps the state it already has
+// for a key, as it was updated after the ring changed; such keys are kept and offered again
+// on the next refresh, until either copy expires.
+func (c *ClusterStorage) rebalance(ctx context.Context) {
+	now := c.clock.Now().Unix()
+	moved, kept, failed := 0, 0, 0
+	for _, item := range c.local.liveItems(now) {
+		owner := c.owner(item.key)
+		if owner == c.self {
+			continue
+		}
+		taken, err := c.local.handOver(item.key, now, func(value interface{}, expiresAt int64) (bool, error) {
+			encoded, _ := value.(string)
+			swapped, _, _, err := c.remoteCompareAndSwap(ctx, owner, item.key, nil, false, []byte(encoded), expiresAt)
+			return swapped, err
+		})
+		switch {
+		case err != nil:
+			c.logger.Warn("Failed to hand key over to its owner", "key", item.key, "owner", owner, "error", err)
+			failed++
+		case !taken:
+			c.logger.Debug("Owner already has state for key, keeping it", "key", item.key, "owner", owner)
+			kept++
+		default:
+			moved++
+		}
+	}
+
+	c.mu.Lock()
+	c.handoff = failed > 0 || kept > 0
+	c.mu.Unlock()
+
+	if moved > 0 || kept > 0 || failed > 0 {
+		c.logger.Info("Cluster keys handed over", "node", c.self, "moved", moved, "kept", kept, "failed", failed)
+	}
+}
+
+// leave removes this node from its ring and hands all its keys over to the remaining members
+func (c *ClusterStorage) leave() {
+	c.mu.Lock()
+	remaining := make([]string, 0, len(c.ring.nodes))
+	for _, node := range c.ring.nodes {
+		if node != c.self {
+			remaining = append(remaining, node)
+		}
+	}
+	if len(remaining) > 0 {
+		c.ring = newHashRing(remaining)
+	}
+	c.mu.Unlock()
+
+	if len(remaining) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clusterRebalanceTimeout)
+	defer cancel()
+	c.rebalance(ctx)
+}
@@ -0,0 +1,519 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Algorithms evaluated by the owner of a key, see clusterEvalRequest
+const (
+	clusterEvalTokenBucket          = "token_bucket"
+	clusterEvalSlidingWindow        = "sliding_window"
+	clusterEvalFixedWindow          = "fixed_window"
+	clusterEvalSlidingWindowCounter = "sliding_window_counter"
+	clusterEvalGCRA                 = "gcra"
+	clusterEvalLeakyBucket          = "leaky_bucket"
+	clusterEvalAcquireLease         = "acquire_lease"
+	clusterEvalReleaseLease         = "release_lease"
+)
+
+// clusterEvalRequest evaluates Algorithm for Key on its owner, with the arguments of the matching evaluator.
+// Times are Unix nanoseconds and durations nanoseconds.
+type clusterEvalRequest struct {
+	Algorithm      string  `json:"algorithm"`
+	Key            string  `json:"key"`
+	Limit          int     `json:"limit,omitempty"`
+	Cost           int     `json:"cost,omitempty"`
+	Window         int64   `json:"window,omitempty"`
+	Burst          int     `json:"burst,omitempty"`
+	Interval       int64   `json:"interval,omitempty"` // GCRA emission interval or leaky bucket drain interval
+	BurstOffset    int64   `json:"burst_offset,omitempty"`
+	Capacity       int     `json:"capacity,omitempty"`
+	WindowStart    int64   `json:"window_start,omitempty"`
+	PreviousWeight float64 `json:"previous_weight,omitempty"`
+	LeaseID        string  `json:"lease_id,omitempty"`
+	ExpireAt       int64   `json:"expire_at,omitempty"`
+	Now            int64   `json:"now,omitempty"`
+}
+
+// clusterEvalResponse is the outcome of an evaluation, each algorithm setting the fields it returns
+type clusterEvalResponse struct {
+	Allowed  bool    `json:"allowed"`
+	Tokens   float64 `json:"tokens,omitempty"`
+	Count    int     `json:"count,omitempty"` // Log entries, or requests of the current window
+	Previous int     `json:"previous,omitempty"`
+	Time     int64   `json:"time,omitempty"` // Last refill, newest entry, TAT or departure
+	Blocking int64   `json:"blocking,omitempty"`
+}
+
+// States of the algorithms, stored JSON encoded in the memory storage of the owner
+type (
+	clusterTokenBucketState struct {
+		Tokens     float64 `json:"tokens"`
+		LastRefill int64   `json:"last_refill"`
+	}
+	clusterSlidingWindowState struct {
+		Entries []int64 `json:"entries"` // Sorted ascending
+	}
+	clusterCounterState struct {
+		WindowStart int64 `json:"window_start"`
+		Current     int   `json:"current"`
+		Previous    int   `json:"previous,omitempty"`
+	}
+	clusterTimeState struct {
+		Time int64 `json:"time"` // TAT or departure
+	}
+	clusterLeaseState struct {
+		Leases map[string]int64 `json:"leases"` // Expiration by lease ID
+	}
+)
+
+// evaluate runs an evaluation on the owner of the namespaced req.Key in a single round trip
+func (c *ClusterStorage) evaluate(ctx context.Context, req clusterEvalRequest) (clusterEvalResponse, error) {
+	if err := req.validate(); err != nil {
+		return clusterEvalResponse{}, err
+	}
+	owner := c.owner(req.Key)
+	if owner == c.self {
+		return c.evaluateLocally(ctx, req)
+	}
+
+	var resp clusterEvalResponse
+	if err := c.call(ctx, owner, clusterOpEval, req, &resp); err != nil {
+		c.logger.Error("Failed to evaluate on cluster peer", "algorithm", req.Algorithm, "key", req.Key, "owner", owner, "error", err)
+		return clusterEvalResponse{}, err
+	}
+	return resp, nil
+}
+
+// evaluateLocally runs an evaluation against the local storage, holding the lock of the key throughout,
+// as the Lua scripts of RedisStorage run atomically. A state of another form is started over.
+func (c *ClusterStorage) evaluateLocally(ctx context.Context, req clusterEvalRequest) (clusterEvalResponse, error) {
+	if err := req.validate(); err != nil {
+		return clusterEvalResponse{}, err
+	}
+	var resp clusterEvalResponse
+	err := c.local.Update(ctx, req.Key, func(current interface{}) (interface{}, int64, error) {
+		stored, _ := current.(string)
+
+		var state interface{}
+		var expireAt int64
+		switch req.Algorithm {
+		case clusterEvalTokenBucket:
+			state, expireAt = evalClusterTokenBucket(req, stored, &resp)
+		case clusterEvalSlidingWindow:
+			state, expireAt = evalClusterSlidingWindow(req, stored, &resp)
+		case clusterEvalFixedWindow:
+			state, expireAt = evalClusterFixedWindow(req, stored, &resp)
+		case clusterEvalSlidingWindowCounter:
+			state, expireAt = evalClusterSlidingWindowCounter(req, stored, &resp)
+		case clusterEvalGCRA:
+			state, expireAt = evalClusterGCRA(req, stored, &resp)
+		case clusterEvalLeakyBucket:
+			state, expireAt = evalClusterLeakyBucket(req, stored, &resp)
+		case clusterEvalAcquireLease:
+			state, expireAt = evalClusterAcquireLease(req, stored, &resp)
+		case clusterEvalReleaseLease:
+			state, expireAt = evalClusterReleaseLease(req, stored, &resp)
+		default:
+			return nil, 0, fmt.Errorf("unsupported cluster evaluation: %s", req.Algorithm)
+		}
+
+		encoded, err := json.Marshal(state)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to marshal %s state: %w", req.Algorithm, err)
+		}
+		return string(encoded), clusterExpiration(expireAt), nil
+	})
+	if err != nil {
+		return clusterEvalResponse{}, err
+	}
+	return resp, nil
+}
+
+// validate rejects evaluations of requests costing less than one unit, leases have no cost
+func (r clusterEvalRequest) validate() error {
+	if r.Algorithm == clusterEvalAcquireLease || r.Algorithm == clusterEvalReleaseLease {
+		return nil
+	}
+	return validateCost(r.Cost)
+}
+
+// evalClusterTokenBucket refills the bucket and consumes req.Cost tokens if they are available.
+// The state expires once the bucket would be full again.
+func evalClusterTokenBucket(req clusterEvalRequest, stored string, resp *clusterEvalResponse) (interface{}, int64) {
+	interval := float64(req.Window) / float64(req.Limit)
+	burst := float64(req.Burst)
+
+	var state clusterTokenBucketState
+	if json.Unmarshal([]byte(stored), &state) != nil || state.LastRefill == 0 {
+		state = clusterTokenBucketState{Tokens: burst, LastRefill: req.Now}
+	} else if elapsed := req.Now - state.LastRefill; elapsed > 0 {
+		state.Tokens = math.Min(state.Tokens+float64(elapsed)/interval, burst)
+		state.LastRefill = req.Now
+	}
+
+	// Refills adding up to a whole token may fall short of it by floating point error
+	if state.Tokens+1e-9 >= float64(req.Cost) {
+		state.Tokens = math.Max(state.Tokens-float64(req.Cost), 0)
+		resp.Allowed = true
+	}
+	resp.Tokens, resp.Time = state.Tokens, state.LastRefill
+
+	refill := int64(math.Ceil((burst - state.Tokens) * interval))
+	return state, req.Now + max(refill, int64(time.Millisecond))
+}
+
+// evalClusterSlidingWindow trims the log to the window and records req.Cost entries if they fit
+func evalClusterSlidingWindow(req clusterEvalRequest, stored string, resp *clusterEvalResponse) (interface{}, int64) {
+	var state clusterSlidingWindowState
+	if json.Unmarshal([]byte(stored), &state) != nil {
+		state = clusterSlidingWindowState{}
+	}
+
+	windowStart := req.Now - req.Window
+	first := 0
+	for first < len(state.Entries) && state.Entries[first] < windowStart {
+		first++
+	}
+	state.Entries = state.Entries[first:]
+
+	if len(state.Entries)+req.Cost <= req.Limit {
+		// Nodes may disagree slightly on the time, entries are inserted in order
+		at := sort.Search(len(state.Entries), func(i int) bool { return state.Entries[i] > req.Now })
+		entries := make([]int64, 0, len(state.Entries)+req.Cost)
+		entries = append(entries, state.Entries[:at]...)
+		for i := 0; i < req.Cost; i++ {
+			entries = append(entries, req.Now)
+		}
+		state.Entries = append(entries, state.Entries[at:]...)
+		resp.Allowed = true
+	}
+
+	count := len(state.Entries)
+	resp.Count = count
+	if count > 0 {
+		resp.Time = state.Entries[count-1]
+	}
+	if needed := count + req.Cost - req.Limit; !resp.Allowed && needed <= count {
+		resp.Blocking = state.Entries[needed-1]
+	}
+	return state, req.Now + req.Window
+}
+
+// evalClusterFixedWindow adds req.Cost to the counter of the window starting at req.WindowStart
+// if the result does not exceed the limit
+func evalClusterFixedWindow(req clusterEvalRequest, stored string, resp *clusterEvalResponse) (interface{}, int64) {
+	var state clusterCounterState
+	if json.Unmarshal([]byte(stored), &state) != nil || state.WindowStart != req.WindowStart {
+		state = clusterCounterState{WindowStart: req.WindowStart}
+	}
+
+	if state.Current+req.Cost <= req.Limit {
+		state.Current += req.Cost
+		resp.Allowed = true
+	}
+	resp.Count = state.Current
+	return state, req.ExpireAt
+}
+
+// evalClusterSlidingWindowCounter rolls the counters to the window starting at req.WindowStart
+// and counts req.Cost requests if the weighted previous count and the current count leave room for them
+func evalClusterSlidingWindowCounter(req clusterEvalRequest, stored string, resp *clusterEvalResponse) (interface{}, int64) {
+	var state clusterCounterState
+	if json.Unmarshal([]byte(stored), &state) != nil {
+		state = clusterCounterState{}
+	}
+	switch state.WindowStart {
+	case req.WindowStart:
+	case req.WindowStart - req.Window:
+		state = clusterCounterState{WindowStart: req.WindowStart, Previous: state.Current}
+	default:
+		state = clusterCounterState{WindowStart: req.WindowStart}
+	}
+
+	if float64(state.Previous)*req.PreviousWeight+float64(state.Current+req.Cost-1) < float64(req.Limit) {
+		state.Current += req.Cost
+		resp.Allowed = true
+	}
+	resp.Count, resp.Previous = state.Current, state.Previous
+	return state, req.ExpireAt
+}
+
+// evalClusterGCRA advances the theoretical arrival time by req.Cost emission intervals
+// if the request conforms to the burst offset. The state expires at the TAT.
+func evalClusterGCRA(req clusterEvalRequest, stored string, resp *clusterEvalResponse) (interface{}, int64) {
+	var state clusterTimeState
+	if json.Unmarshal([]byte(stored), &state) != nil || state.Time < req.Now {
+		state = clusterTimeState{Time: req.Now}
+	}
+
+	if tat := state.Time + req.Interval*int64(req.Cost); tat-req.BurstOffset <= req.Now {
+		state.Time = tat
+		resp.Allowed = true
+	}
+	resp.Time = state.Time
+	return state, state.Time
+}
+
+// evalClusterLeakyBucket queues a request taking req.Cost places if they are free.
+// The state expires once the queue has drained.
+func evalClusterLeakyBucket(req clusterEvalRequest, stored string, resp *clusterEvalResponse) (interface{}, int64) {
+	var state clusterTimeState
+	if json.Unmarshal([]byte(stored), &state) != nil || state.Time < req.Now {
+		state = clusterTimeState{Time: req.Now}
+	}
+
+	if state.Time-req.Now <= req.Interval*int64(req.Capacity-req.Cost) {
+		state.Time += req.Interval * int64(req.Cost)
+		resp.Allowed = true
+	}
+	resp.Time = state.Time
+	return state, state.Time
+}
+
+// evalClusterAcquireLease drops the expired leases and records req.LeaseID until req.ExpireAt
+// if fewer than the limit are held. The state expires with the last lease.
+func evalClusterAcquireLease(req clusterEvalRequest, stored string, resp *clusterEvalResponse) (interface{}, int64) {
+	state := liveClusterLeases(stored, req.Now)
+	if len(state.Leases) < req.Limit {
+		state.Leases[req.LeaseID] = req.ExpireAt
+		resp.Allowed = true
+	}
+	return state, state.lastExpiration(req.Now)
+}
+
+// evalClusterReleaseLease removes req.LeaseID and reports whether it was still held
+func evalClusterReleaseLease(req clusterEvalRequest, stored string, resp *clusterEvalResponse) (interface{}, int64) {
+	state := liveClusterLeases(stored, req.Now)
+	if _, ok := state.Leases[req.LeaseID]; ok {
+		delete(state.Leases, req.LeaseID)
+		resp.Allowed = true
+	}
+	return state, state.lastExpiration(req.Now)
+}
+
+// liveClusterLeases decodes the leases of a key, without those expired by now
+func liveClusterLeases(stored string, now int64) clusterLeaseState {
+	var state clusterLeaseState
+	if json.Unmarshal([]byte(stored), &state) != nil || state.Leases == nil {
+		state = clusterLeaseState{Leases: make(map[string]int64)}
+	}
+	for id, expiresAt := range state.Leases {
+		if expiresAt <= now {
+			delete(state.Leases, id)
+		}
+	}
+	return state
+}
+
+// lastExpiration returns the expiration of the last lease, or now if none is held
+func (s clusterLeaseState) lastExpiration(now int64) int64 {
+	last := now
+	for _, expiresAt := range s.Leases {
+		last = max(last, expiresAt)
+	}
+	return last
+}
+
+// clusterExpiration converts Unix nanoseconds into the expiration of the memory storage,
+// rounded up to the next second so that state never expires early
+func clusterExpiration(nanos int64) int64 {
+	return (nanos + int64(time.Second) - 1) / int64(time.Second)
+}
+
+// EvalTokenBucket evaluates the Token Bucket algorithm for key on its owner
+func (c *ClusterStorage) EvalTokenBucket(
+	ctx context.Context,
+	key string,
+	limit int,
+	window time.Duration,
+	burst int,
+	cost int,
+	now time.Time,
+) (bool, float64, int64, error) {
+	resp, err := c.evaluate(ctx, clusterEvalRequest{
+		Algorithm: clusterEvalTokenBucket,
+		Key:       c.keys.Key(key),
+		Limit:     limit,
+		Window:    int64(window),
+		Burst:     burst,
+		Cost:      cost,
+		Now:       now.UnixNano(),
+	})
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("failed to evaluate token bucket in cluster: %w", err)
+	}
+	return resp.Allowed, resp.Tokens, resp.Time, nil
+}
+
+// EvalSlidingWindow evaluates the Sliding Window Log algorithm for key on its owner
+func (c *ClusterStorage) EvalSlidingWindow(
+	ctx context.Context,
+	key string,
+	limit int,
+	window time.Duration,
+	cost int,
+	now time.Time,
+) (bool, int, int64, int64, error) {
+	resp, err := c.evaluate(ctx, clusterEvalRequest{
+		Algorithm: clusterEvalSlidingWindow,
+		Key:       c.keys.Key(key),
+		Limit:     limit,
+		Window:    int64(window),
+		Cost:      cost,
+		Now:       now.UnixNano(),
+	})
+	if err != nil {
+		return false, 0, 0, 0, fmt.Errorf("failed to evaluate sliding window in cluster: %w", err)
+	}
+	return resp.Allowed, resp.Count, resp.Time, resp.Blocking, nil
+}
+
+// EvalFixedWindow evaluates the Fixed Window Counter algorithm for key on its owner
+func (c *ClusterStorage) EvalFixedWindow(
+	ctx context.Context,
+	key string,
+	limit int,
+	cost int,
+	windowStart int64,
+	expireAt time.Time,
+) (bool, int, error) {
+	resp, err := c.evaluate(ctx, clusterEvalRequest{
+		Algorithm:   clusterEvalFixedWindow,
+		Key:         c.keys.Key(key),
+		Limit:       limit,
+		Cost:        cost,
+		WindowStart: windowStart,
+		ExpireAt:    expireAt.UnixNano(),
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to evaluate fixed window in cluster: %w", err)
+	}
+	return resp.Allowed, resp.Count, nil
+}
+
+// EvalSlidingWindowCounter evaluates the Sliding Window Counter algorithm for key on its owner
+func (c *ClusterStorage) EvalSlidingWindowCounter(
+	ctx context.Context,
+	key string,
+	limit int,
+	cost int,
+	windowStart int64,
+	window int64,
+	previousWeight float64,
+	expireAt time.Time,
+) (bool, int, int, error) {
+	resp, err := c.evaluate(ctx, clusterEvalRequest{
+		Algorithm:      clusterEvalSlidingWindowCounter,
+		Key:            c.keys.Key(key),
+		Limit:          limit,
+		Cost:           cost,
+		WindowStart:    windowStart,
+		Window:         window,
+		PreviousWeight: previousWeight,
+		ExpireAt:       expireAt.UnixNano(),
+	})
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("failed to evaluate sliding window counter in cluster: %w", err)
+	}
+	return resp.Allowed, resp.Count, resp.Previous, nil
+}
+
+// EvalGCRA evaluates the Generic Cell Rate Algorithm for key on its owner
+func (c *ClusterStorage) EvalGCRA(
+	ctx context.Context,
+	key string,
+	emissionInterval time.Duration,
+	burstOffset time.Duration,
+	cost int,
+	now time.Time,
+) (bool, int64, error) {
+	resp, err := c.evaluate(ctx, clusterEvalRequest{
+		Algorithm:   clusterEvalGCRA,
+		Key:         c.keys.Key(key),
+		Interval:    int64(emissionInterval),
+		BurstOffset: int64(burstOffset),
+		Cost:        cost,
+		Now:         now.UnixNano(),
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to evaluate GCRA in cluster: %w", err)
+	}
+	return resp.Allowed, resp.Time, nil
+}
+
+// EvalLeakyBucket evaluates the Leaky Bucket queue for key on its owner
+func (c *ClusterStorage) EvalLeakyBucket(
+	ctx context.Context,
+	key string,
+	drainInterval time.Duration,
+	capacity int,
+	cost int,
+	now time.Time,
+) (bool, int64, error) {
+	resp, err := c.evaluate(ctx, clusterEvalRequest{
+		Algorithm: clusterEvalLeakyBucket,
+		Key:       c.keys.Key(key),
+		Interval:  int64(drainInterval),
+		Capacity:  capacity,
+		Cost:      cost,
+		Now:       now.UnixNano(),
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to evaluate leaky bucket in cluster: %w", err)
+	}
+	return resp.Allowed, resp.Time, nil
+}
+
+// EvalAcquireLease acquires a concurrency lease for key on its owner
+func (c *ClusterStorage) EvalAcquireLease(
+	ctx context.Context,
+	key string,
+	leaseID string,
+	limit int,
+	expireAt time.Time,
+	now time.Time,
+) (bool, error) {
+	resp, err := c.evaluate(ctx, clusterEvalRequest{
+		Algorithm: clusterEvalAcquireLease,
+		Key:       c.keys.Key(key),
+		LeaseID:   leaseID,
+		Limit:     limit,
+		ExpireAt:  expireAt.UnixNano(),
+		Now:       now.UnixNano(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease in cluster: %w", err)
+	}
+	return resp.Allowed, nil
+}
+
+// EvalReleaseLease releases a concurrency lease for key on its owner
+func (c *ClusterStorage) EvalReleaseLease(ctx context.Context, key string, leaseID string, now time.Time) (bool, error) {
+	resp, err := c.evaluate(ctx, clusterEvalRequest{
+		Algorithm: clusterEvalReleaseLease,
+		Key:       c.keys.Key(key),
+		LeaseID:   leaseID,
+		Now:       now.UnixNano(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to release lease in cluster: %w", err)
+	}
+	return resp.Allowed, nil
+}
+
+// Ensure ClusterStorage implements the server-side evaluators
+var (
+	_ TokenBucketEvaluator          = (*ClusterStorage)(nil)
+	_ SlidingWindowEvaluator        = (*ClusterStorage)(nil)
+	_ FixedWindowEvaluator          = (*ClusterStorage)(nil)
+	_ SlidingWindowCounterEvaluator = (*ClusterStorage)(nil)
+	_ GCRAEvaluator                 = (*ClusterStorage)(nil)
+	_ LeakyBucketEvaluator          = (*ClusterStorage)(nil)
+	_ LeaseEvaluator                = (*ClusterStorage)(nil)
+)
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ClusterPathPrefix is the path of the internal endpoint served by ClusterStorage.Handler
+const ClusterPathPrefix = "/internal/v1/cluster/"
+
+// clusterSecretHeader carries the shared secret of the cluster
+const clusterSecretHeader = "X-Cluster-Secret"
+
+// Operations of the internal endpoint
+const (
+	clusterOpPing   = "ping"
+	clusterOpGet    = "get"
+	clusterOpSet    = "set"
+	clusterOpDelete = "delete"
+	clusterOpCAS    = "cas"
+	clusterOpEval   = "eval"
+)
+
+// clusterEntry is a key with its encoded value, exchanged by get, set and delete
+type clusterEntry struct {
+	Key        string `json:"key"`
+	Value      []byte `json:"value,omitempty"`
+	Found      bool   `json:"found,omitempty"`
+	Expiration int64  `json:"expiration,omitempty"` // Unix timestamp, 0 means no expiration
+}
+
+// clusterCASRequest stores Value at Key if the owner still has Expected, or no value if ExpectedFound is false
+type clusterCASRequest struct {
+	Key           string `json:"key"`
+	Expected      []byte `json:"expected,omitempty"`
+	ExpectedFound bool   `json:"expected_found"`
+	Value         []byte `json:"value"`
+	Expiration    int64  `json:"expiration,omitempty"`
+}
+
+// clusterCASResponse reports whether the value was swapped, and the current value otherwise
+type clusterCASResponse struct {
+	Swapped bool   `json:"swapped"`
+	Current []byte `json:"current,omitempty"`
+	Found   bool   `json:"found,omitempty"`
+}
+
+// Handler returns the internal endpoint answering the operations forwarded by the other nodes,
+// to be served under ClusterPathPrefix. Forwarded operations are always applied locally.
+func (c *ClusterStorage) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ClusterPathPrefix+clusterOpPing, func(w http.ResponseWriter, r *http.Request) {
+		writeClusterResponse(w, clusterEntry{Key: c.self, Found: true})
+	})
+	mux.HandleFunc(ClusterPathPrefix+clusterOpGet, c.serveGet)
+	mux.HandleFunc(ClusterPathPrefix+clusterOpSet, c.serveSet)
+	mux.HandleFunc(ClusterPathPrefix+clusterOpDelete, c.serveDelete)
+	mux.HandleFunc(ClusterPathPrefix+clusterOpCAS, c.serveCompareAndSwap)
+	mux.HandleFunc(ClusterPathPrefix+clusterOpEval, c.serveEvaluate)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(clusterSecretHeader)), []byte(c.secret)) != 1 {
+			http.Error(w, "invalid cluster secret", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (c *ClusterStorage) serveGet(w http.ResponseWriter, r *http.Request) {
+	var req clusterEntry
+	if !readClusterRequest(w, r, &req) {
+		return
+	}
+	value, err := c.local.Get(r.Context(), req.Key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := clusterEntry{Key: req.Key}
+	if s, ok := value.(string); ok {
+		resp.Value, resp.Found = []byte(s), true
+	}
+	writeClusterResponse(w, resp)
+}
+
+func (c *ClusterStorage) serveSet(w http.ResponseWriter, r *http.Request) {
+	var req clusterEntry
+	if !readClusterRequest(w, r, &req) {
+		return
+	}
+	if err := c.local.Set(r.Context(), req.Key, string(req.Value), req.Expiration); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeClusterResponse(w, clusterEntry{Key: req.Key})
+}
+
+func (c *ClusterStorage) serveDelete(w http.ResponseWriter, r *http.Request) {
+	var req clusterEntry
+	if !readClusterRequest(w, r, &req) {
+		return
+	}
+	if err := c.local.Delete(r.Context(), req.Key); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeClusterResponse(w, clusterEntry{Key: req.Key})
+}
+
+func (c *ClusterStorage) serveCompareAndSwap(w http.ResponseWriter, r *http.Request) {
+	var req clusterCASRequest
+	if !readClusterRequest(w, r, &req) {
+		return
+	}
+	swapped, current, found, err := c.compareAndSwap(r.Context(), req.Key, req.Expected, req.ExpectedFound, req.Value, req.Expiration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeClusterResponse(w, clusterCASResponse{Swapped: swapped, Current: current, Found: found})
+}
+
+func (c *ClusterStorage) serveEvaluate(w http.ResponseWriter, r *http.Request) {
+	var req clusterEvalRequest
+	if !readClusterRequest(w, r, &req) {
+		return
+	}
+	resp, err := c.evaluateLocally(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeClusterResponse(w, resp)
+}
+
+// readClusterRequest decodes the JSON body of a forwarded operation, answering malformed requests
+func readClusterRequest(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeClusterResponse encodes the JSON response of a forwarded operation
+func writeClusterResponse(w http.ResponseWriter, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// call sends an operation to node and decodes its response into resp
+func (c *ClusterStorage) call(ctx context.Context, node string, op string, req interface{}, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", op, err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+node+ClusterPathPrefix+op, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", op, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(clusterSecretHeader, c.secret)
+
+	res, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to forward %s to %s: %w", op, node, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("failed to forward %s to %s: %s: %s", op, node, res.Status, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return fmt.Errorf("failed to decode %s response from %s: %w", op, node, err)
+	}
+	return nil
+}
+
+// ping checks that node serves the internal endpoint
+func (c *ClusterStorage) ping(ctx context.Context, node string) error {
+	var resp clusterEntry
+	return c.call(ctx, node, clusterOpPing, struct{}{}, &resp)
+}
+
+// remoteGet reads the encoded value of key on node
+func (c *ClusterStorage) remoteGet(ctx context.Context, node string, key string) ([]byte, bool, error) {
+	var resp clusterEntry
+	if err := c.call(ctx, node, clusterOpGet, clusterEntry{Key: key}, &resp); err != nil {
+		return nil, false, err
+	}
+	return resp.Value, resp.Found, nil
+}
+
+// remoteSet stores the encoded value of key on node
+func (c *ClusterStorage) remoteSet(ctx context.Context, node string, key string, value []byte, expiration int64) error {
+	var resp clusterEntry
+	return c.call(ctx, node, clusterOpSet, clusterEntry{Key: key, Value: value, Expiration: expiration}, &resp)
+}
+
+// remoteDelete removes key on node
+func (c *ClusterStorage) remoteDelete(ctx context.Context, node string, key string) error {
+	var resp clusterEntry
+	return c.call(ctx, node, clusterOpDelete, clusterEntry{Key: key}, &resp)
+}
+
+// remoteCompareAndSwap stores value at key on node if it still has expected, see compareAndSwap
+func (c *ClusterStorage) remoteCompareAndSwap(
+	ctx context.Context,
+	node string,
+	key string,
+	expected []byte,
+	expectedFound bool,
+	value []byte,
+	expiration int64,
+) (bool, []byte, bool, error) {
+	req := clusterCASRequest{
+		Key:           key,
+		Expected:      expected,
+		ExpectedFound: expectedFound,
+		Value:         value,
+		Expiration:    expiration,
+	}
+	var resp clusterCASResponse
+	if err := c.call(ctx, node, clusterOpCAS, req, &resp); err != nil {
+		return false, nil, false, err
+	}
+	return resp.Swapped, resp.Current, resp.Found, nil
+}
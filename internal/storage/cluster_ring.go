@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// clusterRingReplicas is the number of points of every node on the ring.
+// More points spread the keys more evenly between the nodes.
+const clusterRingReplicas = 128
+
+// hashRing assigns keys to nodes by consistent hashing: when a node joins or leaves,
+// only the keys it owns or takes over move
+type hashRing struct {
+	points []uint64          // Sorted hashes of the node points
+	owners map[uint64]string // Node of every point
+	nodes  []string          // Sorted node addresses
+}
+
+// newHashRing builds the ring of nodes, which must not be empty
+func newHashRing(nodes []string) *hashRing {
+	r := &hashRing{
+		points: make([]uint64, 0, len(nodes)*clusterRingReplicas),
+		owners: make(map[uint64]string, len(nodes)*clusterRingReplicas),
+		nodes:  append([]string(nil), nodes...),
+	}
+	sort.Strings(r.nodes)
+
+	for _, node := range r.nodes {
+		for i := 0; i < clusterRingReplicas; i++ {
+			point := ringHash(node + "#" + strconv.Itoa(i))
+			if _, taken := r.owners[point]; taken {
+				continue
+			}
+			r.owners[point] = node
+			r.points = append(r.points, point)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// owner returns the node owning key: the node of the first point at or after the hash of the key
+func (r *hashRing) owner(key string) string {
+	hash := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// equal reports whether both rings have the same nodes
+func (r *hashRing) equal(nodes []string) bool {
+	if len(nodes) != len(r.nodes) {
+		return false
+	}
+	sorted := append([]string(nil), nodes...)
+	sort.Strings(sorted)
+	for i := range sorted {
+		if sorted[i] != r.nodes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ringHash places a key or node point on the ring.
+// FNV-1a is finalized with the MurmurHash3 mixer, as the node points only differ in their last bytes.
+func ringHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,441 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// clusterTestNode is an in-process cluster node serving its internal endpoint on localhost
+type clusterTestNode struct {
+	server  *httptest.Server
+	storage *ClusterStorage
+}
+
+// addr returns the address the other nodes reach the node at
+func (n *clusterTestNode) addr() string {
+	return n.server.Listener.Addr().String()
+}
+
+// start creates the storage of the node in the cluster of peers and starts serving it
+func (n *clusterTestNode) start(t *testing.T, peers []string, secret string) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	storage, err := NewClusterStorage(config.StorageConfig{
+		ClusterAdvertiseAddress: n.addr(),
+		ClusterPeers:            peers,
+		ClusterRefreshInterval:  time.Hour, // Tests refresh explicitly
+		ClusterForwardTimeout:   200 * time.Millisecond,
+		ClusterSecret:           secret,
+	}, nil, nil, logger)
+	if err != nil {
+		t.Fatalf("NewClusterStorage failed: %v", err)
+	}
+	n.storage = storage
+	n.server.Config.Handler = storage.Handler()
+	n.server.Start()
+}
+
+// newClusterTestNodes reserves the addresses of count nodes, without starting them
+func newClusterTestNodes(t *testing.T, count int) ([]*clusterTestNode, []string) {
+	t.Helper()
+	nodes := make([]*clusterTestNode, count)
+	peers := make([]string, count)
+	for i := range nodes {
+		nodes[i] = &clusterTestNode{server: httptest.NewUnstartedServer(nil)}
+		peers[i] = nodes[i].addr()
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			node.server.Close()
+			if node.storage != nil {
+				node.storage.Close()
+			}
+		}
+	})
+	return nodes, peers
+}
+
+// assertOwnedLocally checks that every node only keeps the keys it owns
+func assertOwnedLocally(t *testing.T, nodes ...*clusterTestNode) {
+	t.Helper()
+	for _, node := range nodes {
+		for _, item := range node.storage.local.liveItems(time.Now().Unix()) {
+			if owner := node.storage.owner(item.key); owner != node.addr() {
+				t.Errorf("Node %s keeps %s owned by %s", node.addr(), item.key, owner)
+			}
+		}
+	}
+}
+
+func TestHashRing(t *testing.T) {
+	nodes := []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080"}
+	ring := newHashRing(nodes)
+
+	owned := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		owned[ring.owner("key:"+strconv.Itoa(i))]++
+	}
+	for _, node := range nodes {
+		if owned[node] < 700 {
+			t.Errorf("Expected keys to be spread evenly, %s owns %d of 3000", node, owned[node])
+		}
+	}
+
+	// Removing a node only moves the keys it owned
+	smaller := newHashRing(nodes[:2])
+	for i := 0; i < 3000; i++ {
+		key := "key:" + strconv.Itoa(i)
+		if before := ring.owner(key); before != nodes[2] && smaller.owner(key) != before {
+			t.Fatalf("Key %s moved from %s although its owner stayed", key, before)
+		}
+	}
+
+	if !ring.equal([]string{"10.0.0.3:8080", "10.0.0.1:8080", "10.0.0.2:8080"}) || ring.equal(nodes[:2]) {
+		t.Error("Expected rings to be compared by their nodes regardless of order")
+	}
+}
+
+func TestClusterStorage_Forwarding(t *testing.T) {
+	nodes, peers := newClusterTestNodes(t, 3)
+	for _, node := range nodes {
+		node.start(t, peers, "secret")
+	}
+	ctx := context.Background()
+
+	// Values written through any node are read through every other one
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		if err := nodes[i%3].storage.Set(ctx, key, key, 0); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		value, err := nodes[(i+1)%3].storage.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if value != key {
+			t.Errorf("Expected %s, got %v", key, value)
+		}
+	}
+	assertOwnedLocally(t, nodes...)
+
+	if err := nodes[0].storage.Delete(ctx, "key:1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if value, _ := nodes[2].storage.Get(ctx, "key:1"); value != nil {
+		t.Errorf("Expected nil after delete, got %v", value)
+	}
+
+	// Concurrent updates from every node are all applied by the owner
+	const increments = 20
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		for i := 0; i < increments; i++ {
+			wg.Add(1)
+			go func(storage *ClusterStorage) {
+				defer wg.Done()
+				err := storage.Update(ctx, "counter", func(current interface{}) (interface{}, int64, error) {
+					count := 0
+					if current != nil {
+						count, _ = strconv.Atoi(current.(string))
+					}
+					return strconv.Itoa(count + 1), 0, nil
+				})
+				if err != nil {
+					t.Errorf("Update failed: %v", err)
+				}
+			}(node.storage)
+		}
+	}
+	wg.Wait()
+
+	value, err := nodes[1].storage.Get(ctx, "counter")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if value != strconv.Itoa(3*increments) {
+		t.Errorf("Expected %d increments, got %v", 3*increments, value)
+	}
+}
+
+func TestClusterStorage_Rebalance(t *testing.T) {
+	nodes, peers := newClusterTestNodes(t, 4)
+	a, b, c, d := nodes[0], nodes[1], nodes[2], nodes[3]
+	for _, node := range nodes[:3] {
+		node.start(t, peers, "secret")
+	}
+	ctx := context.Background()
+
+	// d is configured but not running yet, the probes drop it from the ring
+	for _, node := range nodes[:3] {
+		node.storage.refresh(ctx)
+		if members := node.storage.Members(); len(members) != 3 {
+			t.Fatalf("Expected 3 members, got %v", members)
+		}
+	}
+
+	const keys = 60
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		if err := a.storage.Set(ctx, key, key, 0); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	assertKeysReadable := func(via *clusterTestNode) {
+		t.Helper()
+		for i := 0; i < keys; i++ {
+			key := fmt.Sprintf("key:%d", i)
+			if value, err := via.storage.Get(ctx, key); err != nil || value != key {
+				t.Errorf("Expected %s through %s, got %v (%v)", key, via.addr(), value, err)
+			}
+		}
+	}
+
+	// c leaves: it hands its keys over before it stops serving
+	owned := c.storage.local.Len()
+	if owned == 0 {
+		t.Fatal("Expected c to own some keys")
+	}
+	c.storage.Close()
+	c.server.Close()
+	a.storage.refresh(ctx)
+	b.storage.refresh(ctx)
+	if members := a.storage.Members(); len(members) != 2 {
+		t.Fatalf("Expected 2 members after c left, got %v", members)
+	}
+	assertKeysReadable(b)
+	assertOwnedLocally(t, a, b)
+
+	// d joins: the keys it owns now are handed over to it
+	d.start(t, peers, "secret")
+	for _, node := range []*clusterTestNode{d, a, b} {
+		node.storage.refresh(ctx)
+	}
+	if members := a.storage.Members(); len(members) != 3 {
+		t.Fatalf("Expected 3 members after d joined, got %v", members)
+	}
+	if d.storage.local.Len() == 0 {
+		t.Error("Expected keys to be handed over to d")
+	}
+	assertKeysReadable(d)
+	assertOwnedLocally(t, a, b, d)
+}
+
+func TestClusterStorage_Evaluate(t *testing.T) {
+	nodes, peers := newClusterTestNodes(t, 2)
+	for _, node := range nodes {
+		node.start(t, peers, "secret")
+	}
+	var forwarded atomic.Int64
+	handler := nodes[1].server.Config.Handler
+	nodes[1].server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded.Add(1)
+		handler.ServeHTTP(w, r)
+	})
+	ctx := context.Background()
+
+	key := ""
+	for i := 0; key == ""; i++ {
+		if candidate := fmt.Sprintf("key:%d", i); nodes[0].storage.owner(nodes[0].storage.keys.Key(candidate)) == nodes[1].addr() {
+			key = candidate
+		}
+	}
+
+	// Every check through a node not owning the key is decided by the owner in one round trip
+	for i, expected := range []bool{true, true, true, false} {
+		allowed, count, err := nodes[i%2].storage.EvalFixedWindow(ctx, key, 3, 1, 1_000, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatalf("EvalFixedWindow failed: %v", err)
+		}
+		if allowed != expected || count != min(i+1, 3) {
+			t.Errorf("Check %d: expected allowed=%v with count %d, got %v with %d", i+1, expected, min(i+1, 3), allowed, count)
+		}
+	}
+	if requests := forwarded.Load(); requests != 2 {
+		t.Errorf("Expected 2 forwarded checks, got %d requests", requests)
+	}
+	if nodes[0].storage.local.Len() != 0 {
+		t.Error("Expected the state to be kept by the owner only")
+	}
+
+	now := time.Now()
+	allowed, tat, err := nodes[0].storage.EvalGCRA(ctx, "gcra:"+key, time.Second, time.Second, 1, now)
+	if err != nil || !allowed || tat != now.Add(time.Second).UnixNano() {
+		t.Errorf("Expected the first GCRA request to advance the TAT by 1s, got %v %d (%v)", allowed, tat, err)
+	}
+	if allowed, _, _ := nodes[1].storage.EvalGCRA(ctx, "gcra:"+key, time.Second, time.Second, 1, now); allowed {
+		t.Error("Expected the second GCRA request to be denied by the shared TAT")
+	}
+
+	if acquired, err := nodes[0].storage.EvalAcquireLease(ctx, "lease:"+key, "lease-1", 1, now.Add(time.Minute), now); err != nil || !acquired {
+		t.Fatalf("Expected the lease to be acquired, got %v (%v)", acquired, err)
+	}
+	if acquired, _ := nodes[1].storage.EvalAcquireLease(ctx, "lease:"+key, "lease-2", 1, now.Add(time.Minute), now); acquired {
+		t.Error("Expected the second lease to be rejected")
+	}
+	if released, err := nodes[1].storage.EvalReleaseLease(ctx, "lease:"+key, "lease-1", now); err != nil || !released {
+		t.Errorf("Expected the lease to be released through the other node, got %v (%v)", released, err)
+	}
+}
+
+func TestClusterStorage_EvalInvalidCost(t *testing.T) {
+	nodes, peers := newClusterTestNodes(t, 2)
+	for _, node := range nodes {
+		node.start(t, peers, "secret")
+	}
+	ctx := context.Background()
+	now := time.Now()
+
+	// Rejected by the forwarding node and by the owner alike
+	for _, node := range nodes {
+		for i := 0; i < 4; i++ {
+			key := fmt.Sprintf("key:%d", i)
+			if _, _, err := node.storage.EvalFixedWindow(ctx, key, 5, -10, now.UnixNano(), now.Add(time.Minute)); !errors.Is(err, ErrInvalidCost) {
+				t.Errorf("Expected ErrInvalidCost, got %v", err)
+			}
+		}
+	}
+	if _, err := nodes[0].storage.evaluateLocally(ctx, clusterEvalRequest{Algorithm: clusterEvalGCRA, Key: "key", Interval: int64(time.Second), Now: now.UnixNano()}); !errors.Is(err, ErrInvalidCost) {
+		t.Errorf("Expected the owner to reject a missing cost, got %v", err)
+	}
+	if nodes[0].storage.local.Len() != 0 || nodes[1].storage.local.Len() != 0 {
+		t.Error("Expected no state for rejected costs")
+	}
+}
+
+func TestClusterStorage_RebalanceKeepsOwnerState(t *testing.T) {
+	nodes, peers := newClusterTestNodes(t, 2)
+	a, b := nodes[0], nodes[1]
+	for _, node := range nodes {
+		node.start(t, peers, "secret")
+	}
+	ctx := context.Background()
+
+	key := ""
+	for i := 0; key == ""; i++ {
+		if candidate := fmt.Sprintf("key:%d", i); a.storage.owner(a.storage.keys.Key(candidate)) == b.addr() {
+			key = candidate
+		}
+	}
+	namespaced := a.storage.keys.Key(key)
+
+	// a still has a copy of a key b already updated, e.g. from before a ring change
+	if err := a.storage.local.Set(ctx, namespaced, "stale", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := b.storage.Set(ctx, key, "current", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	a.storage.rebalance(ctx)
+	if value, _ := b.storage.Get(ctx, key); value != "current" {
+		t.Errorf("Expected the owner to keep its state, got %v", value)
+	}
+	if value, _ := a.storage.local.Get(ctx, namespaced); value != "stale" {
+		t.Errorf("Expected the key not taken by the owner to be kept, got %v", value)
+	}
+	if !a.storage.handoff {
+		t.Error("Expected the handoff to be retried")
+	}
+
+	// Once the owner no longer has the key, the next handoff moves it
+	if err := b.storage.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	a.storage.rebalance(ctx)
+	if value, _ := b.storage.Get(ctx, key); value != "stale" {
+		t.Errorf("Expected the key to be handed over, got %v", value)
+	}
+	if a.storage.local.Len() != 0 || a.storage.handoff {
+		t.Error("Expected the handed over key to be deleted locally")
+	}
+}
+
+func TestClusterStorage_Secret(t *testing.T) {
+	nodes, peers := newClusterTestNodes(t, 2)
+	nodes[0].start(t, peers, "secret")
+	nodes[1].start(t, peers, "other")
+	ctx := context.Background()
+
+	res, err := http.Post(nodes[0].server.URL+ClusterPathPrefix+clusterOpGet, "application/json", nil)
+	if err != nil {
+		t.Fatalf("Post failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the cluster secret, got %d", res.StatusCode)
+	}
+
+	// Keys owned by the other node cannot be forwarded with a different secret
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		if nodes[0].storage.owner(key) == nodes[1].addr() {
+			if err := nodes[0].storage.Set(ctx, key, "value", 0); err == nil {
+				t.Error("Expected forwarding to fail with a different secret")
+			}
+			return
+		}
+	}
+	t.Fatal("Expected the other node to own some keys")
+}
+
+func TestClusterStorage_DNSMembers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	storage, err := NewClusterStorage(config.StorageConfig{
+		ClusterAdvertiseAddress: "10.0.0.1:8080",
+		ClusterDNS:              "rate-limiter.invalid:8080",
+		ClusterRefreshInterval:  time.Hour,
+		ClusterSecret:           "secret",
+	}, nil, nil, logger)
+	if err != nil {
+		t.Fatalf("NewClusterStorage failed: %v", err)
+	}
+	defer storage.Close()
+
+	storage.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if host != "rate-limiter.invalid" {
+			t.Errorf("Expected the DNS name to be resolved, got %s", host)
+		}
+		return []string{"10.0.0.2", "10.0.0.1"}, nil
+	}
+	members, err := storage.candidates(context.Background())
+	if err != nil {
+		t.Fatalf("candidates failed: %v", err)
+	}
+	if len(members) != 2 || members[0] != "10.0.0.1:8080" || members[1] != "10.0.0.2:8080" {
+		t.Errorf("Expected this node and the resolved peer, got %v", members)
+	}
+}
+
+func TestClusterStorage_InvalidConfig(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	tests := []struct {
+		name string
+		cfg  config.StorageConfig
+	}{
+		{"missing advertise address", config.StorageConfig{ClusterPeers: []string{"10.0.0.1:8080"}, ClusterSecret: "secret"}},
+		{"missing secret", config.StorageConfig{ClusterAdvertiseAddress: "10.0.0.1:8080", ClusterPeers: []string{"10.0.0.1:8080"}}},
+		{"peers and dns", config.StorageConfig{ClusterAdvertiseAddress: "10.0.0.1:8080", ClusterPeers: []string{"10.0.0.1:8080"}, ClusterDNS: "peers:8080", ClusterSecret: "secret"}},
+		{"dns without port", config.StorageConfig{ClusterAdvertiseAddress: "10.0.0.1:8080", ClusterDNS: "peers", ClusterSecret: "secret"}},
+		{"negative refresh interval", config.StorageConfig{ClusterAdvertiseAddress: "10.0.0.1:8080", ClusterRefreshInterval: -time.Second, ClusterSecret: "secret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClusterStorage(tt.cfg, nil, nil, logger); err == nil {
+				t.Error("Expected an invalid cluster configuration to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// State codecs selected by config.StorageConfig.StateCodec
+const (
+	// StateCodecJSON stores limiter state as JSON text
+	StateCodecJSON = "json"
+	// StateCodecBinary stores limiter state in its compact binary form behind a versioned header
+	StateCodecBinary = "binary"
+)
+
+// Binary state header: a first byte that never starts JSON text, then the format version
+const (
+	binaryStateMagic   byte = 0x00
+	binaryStateVersion byte = 1
+)
+
+// ErrUnsupportedStateVersion is returned when binary state was written by a newer format
+var ErrUnsupportedStateVersion = errors.New("storage: unsupported binary state version")
+
+// StateCodec serializes values for backends that store bytes, such as Redis and SQL.
+// Whatever the codec, DecodeState reads every format, so the codec can be switched
+// on a running deployment.
+type StateCodec interface {
+	// Name returns the configuration name of the codec
+	Name() string
+	// Encode serializes value. Strings are stored as they are.
+	Encode(value interface{}) ([]byte, error)
+}
+
+// NewStateCodec returns the codec configured by name, JSON if name is empty
+func NewStateCodec(name string) (StateCodec, error) {
+	switch name {
+	case "", StateCodecJSON:
+		return jsonStateCodec{}, nil
+	case StateCodecBinary:
+		return binaryStateCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported state codec: %s", name)
+	}
+}
+
+// jsonStateCodec encodes values as JSON
+type jsonStateCodec struct{}
+
+func (jsonStateCodec) Name() string {
+	return StateCodecJSON
+}
+
+func (jsonStateCodec) Encode(value interface{}) ([]byte, error) {
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal value: %w", err)
+	}
+	return data, nil
+}
+
+// binaryStateCodec encodes values implementing encoding.BinaryMarshaler in their binary form
+// behind the binary state header, and every other value as JSON
+type binaryStateCodec struct{}
+
+func (binaryStateCodec) Name() string {
+	return StateCodecBinary
+}
+
+func (binaryStateCodec) Encode(value interface{}) ([]byte, error) {
+	marshaler, ok := value.(encoding.BinaryMarshaler)
+	if !ok {
+		return jsonStateCodec{}.Encode(value)
+	}
+	body, err := marshaler.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal value: %w", err)
+	}
+	return append([]byte{binaryStateMagic, binaryStateVersion}, body...), nil
+}
+
+// DecodeState decodes data written by any StateCodec into v.
+// Binary state requires v to implement encoding.BinaryUnmarshaler, anything else is read as JSON.
+func DecodeState(data []byte, v interface{}) error {
+	if len(data) == 0 || data[0] != binaryStateMagic {
+		return json.Unmarshal(data, v)
+	}
+	if len(data) < 2 {
+		return errors.New("truncated binary state header")
+	}
+	if data[1] != binaryStateVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedStateVersion, data[1])
+	}
+	unmarshaler, ok := v.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("cannot decode binary state into %T", v)
+	}
+	return unmarshaler.UnmarshalBinary(data[2:])
+}
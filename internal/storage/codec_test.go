@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// counterState is limiter-like state with a binary form that contains zero bytes
+type counterState struct {
+	Count byte `json:"count"`
+}
+
+func (s counterState) MarshalBinary() ([]byte, error) {
+	return []byte{0, s.Count}, nil
+}
+
+func (s *counterState) UnmarshalBinary(data []byte) error {
+	if len(data) != 2 {
+		return errors.New("invalid counter state")
+	}
+	s.Count = data[1]
+	return nil
+}
+
+func TestStateCodecs(t *testing.T) {
+	jsonCodec, err := NewStateCodec("")
+	if err != nil || jsonCodec.Name() != StateCodecJSON {
+		t.Fatalf("Expected JSON codec by default, got %v (%v)", jsonCodec, err)
+	}
+	binaryCodec, err := NewStateCodec(StateCodecBinary)
+	if err != nil {
+		t.Fatalf("NewStateCodec failed: %v", err)
+	}
+	if _, err := NewStateCodec("gob"); err == nil {
+		t.Error("Expected error for unsupported codec")
+	}
+
+	encoded, err := binaryCodec.Encode(counterState{Count: 7})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !bytes.Equal(encoded, []byte{binaryStateMagic, binaryStateVersion, 0, 7}) {
+		t.Errorf("Expected header and binary form, got %v", encoded)
+	}
+
+	// Values without a binary form and strings are not wrapped
+	if encoded, _ := binaryCodec.Encode(map[string]int{"count": 1}); string(encoded) != `{"count":1}` {
+		t.Errorf("Expected JSON for a value without binary form, got %q", encoded)
+	}
+	if encoded, _ := binaryCodec.Encode("plain"); string(encoded) != "plain" {
+		t.Errorf("Expected string stored as is, got %q", encoded)
+	}
+}
+
+func TestDecodeState(t *testing.T) {
+	binaryCodec, _ := NewStateCodec(StateCodecBinary)
+	encoded, _ := binaryCodec.Encode(counterState{Count: 7})
+
+	var state counterState
+	if err := DecodeState(encoded, &state); err != nil || state.Count != 7 {
+		t.Errorf("Expected binary state to decode, got %+v (%v)", state, err)
+	}
+
+	// Legacy JSON state is still read
+	state = counterState{}
+	if err := DecodeState([]byte(`{"count":3}`), &state); err != nil || state.Count != 3 {
+		t.Errorf("Expected JSON state to decode, got %+v (%v)", state, err)
+	}
+
+	if err := DecodeState([]byte{binaryStateMagic, 9, 0, 7}, &state); !errors.Is(err, ErrUnsupportedStateVersion) {
+		t.Errorf("Expected ErrUnsupportedStateVersion, got %v", err)
+	}
+	if err := DecodeState([]byte{binaryStateMagic}, &state); err == nil {
+		t.Error("Expected error for truncated header")
+	}
+	var untyped map[string]interface{}
+	if err := DecodeState(encoded, &untyped); err == nil {
+		t.Error("Expected error decoding binary state into a type without binary form")
+	}
+}
+
+func TestSQLStorage_BinaryState(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	storage, err := NewSQLStorage(config.StorageConfig{
+		SQLDriver:  "sqlite",
+		SQLDSN:     filepath.Join(t.TempDir(), "state.db"),
+		StateCodec: StateCodecBinary,
+	}, nil, logger)
+	if err != nil {
+		t.Fatalf("NewSQLStorage failed: %v", err)
+	}
+	defer storage.Close()
+
+	// Zero bytes survive the round trip through the database
+	if err := storage.Set(context.Background(), "key", counterState{Count: 5}, 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	value, err := storage.Get(context.Background(), "key")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	var state counterState
+	if err := DecodeState([]byte(value.(string)), &state); err != nil || state.Count != 5 {
+		t.Errorf("Expected stored binary state, got %+v (%v)", state, err)
+	}
+}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// DefaultHybridSyncInterval is the reconciliation interval used when none is configured
+const DefaultHybridSyncInterval = 100 * time.Millisecond
+
+// hybridSyncTimeout bounds a single reconciliation with Redis
+const hybridSyncTimeout = 5 * time.Second
+
+// HybridStorage counts requests in memory and reconciles the counts with Redis in the background.
+//
+// Fixed Window Counter and Sliding Window Counter checks are decided locally against the count
+// last read from Redis plus the increments of this instance not pushed yet. Every sync interval
+// the local increments are added to Redis and the totals of all instances are read back.
+// Every other algorithm and operation is evaluated in Redis as by RedisStorage.
+//
+// An instance does not see what other instances admitted since their last sync, so a window
+// may admit more than its limit: at most what the other instances admit in one sync interval,
+// and never more than the number of instances times the limit. A request is never denied
+// while the window is below its limit. If Redis is unreachable, instances keep deciding
+// locally and push their increments once it is back.
+type HybridStorage struct {
+	*RedisStorage
+
+	mu       sync.Mutex
+	counters map[hybridCounterID]*hybridCounter
+	interval time.Duration
+	clock    clock.Clock
+	logger   *slog.Logger
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// hybridCounterID identifies the counter of one window of a key
+type hybridCounterID struct {
+	key         string
+	windowStart int64 // Unix nanoseconds
+}
+
+// hybridCounter is the local view of a window counter
+type hybridCounter struct {
+	expireAt time.Time
+	synced   int // Count in Redis at the last sync, including the increments of this instance
+	pushing  int // Local increments being added to Redis
+	pending  int // Local increments not pushed yet
+}
+
+// count returns the best known count of the window across all instances
+func (c *hybridCounter) count() int {
+	return c.synced + c.pushing + c.pending
+}
+
+// NewHybridStorage connects to Redis like NewRedisStorage and reconciles local counts
+// with it every cfg.HybridSyncInterval. Counters of windows expired by clk, the system clock if nil,
+// are dropped on sync.
+func NewHybridStorage(cfg config.StorageConfig, clk clock.Clock, logger *slog.Logger) (*HybridStorage, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if clk == nil {
+		clk = clock.System()
+	}
+	if cfg.HybridSyncInterval < 0 {
+		return nil, fmt.Errorf("hybrid sync interval must not be negative, got %v", cfg.HybridSyncInterval)
+	}
+
+	remote, err := NewRedisStorage(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := cfg.HybridSyncInterval
+	if interval == 0 {
+		interval = DefaultHybridSyncInterval
+	}
+	h := &HybridStorage{
+		RedisStorage: remote,
+		counters:     make(map[hybridCounterID]*hybridCounter),
+		interval:     interval,
+		clock:        clk,
+		logger:       logger,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go h.run()
+
+	logger.Info("Hybrid storage configured", "sync_interval", interval)
+	return h, nil
+}
+
+// EvalFixedWindow adds cost to the local counter of the window starting at windowStart
+// if the known count across all instances leaves room for it
+func (h *HybridStorage) EvalFixedWindow(
+	ctx context.Context,
+	key string,
+	limit int,
+	cost int,
+	windowStart int64,
+	expireAt time.Time,
+) (bool, int, error) {
+	if err := validateCost(cost); err != nil {
+		return false, 0, err
+	}
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		return false, 0, ctx.Err()
+	default:
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counter := h.counter(key, windowStart, expireAt)
+	allowed := counter.count()+cost <= limit
+	if allowed {
+		counter.pending += cost
+	}
+	return allowed, counter.count(), nil
+}
+
+// EvalSlidingWindowCounter adds cost to the local counter of the window starting at windowStart
+// if the known counts of this and the previous window across all instances leave room for it
+func (h *HybridStorage) EvalSlidingWindowCounter(
+	ctx context.Context,
+	key string,
+	limit int,
+	cost int,
+	windowStart int64,
+	window int64,
+	previousWeight float64,
+	expireAt time.Time,
+) (bool, int, int, error) {
+	if err := validateCost(cost); err != nil {
+		return false, 0, 0, err
+	}
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		return false, 0, 0, ctx.Err()
+	default:
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	current := h.counter(key, windowStart, expireAt)
+	// Tracking the previous window lets the next sync read its total
+	previous := h.counter(key, windowStart-window, expireAt)
+
+	allowed := float64(previous.count())*previousWeight+float64(current.count()+cost-1) < float64(limit)
+	if allowed {
+		current.pending += cost
+	}
+	return allowed, current.count(), previous.count(), nil
+}
+
+// Close pushes the pending local increments to Redis and closes the connection
+func (h *HybridStorage) Close() error {
+	var err error
+	h.closeOnce.Do(func() {
+		close(h.stop)
+		<-h.done
+		h.syncOnce()
+		err = h.RedisStorage.Close()
+	})
+	return err
+}
+
+// counter returns the local counter of the window of key, creating it if needed. h.mu must be held.
+func (h *HybridStorage) counter(key string, windowStart int64, expireAt time.Time) *hybridCounter {
+	id := hybridCounterID{key: key, windowStart: windowStart}
+	counter, ok := h.counters[id]
+	if !ok {
+		counter = &hybridCounter{expireAt: expireAt}
+		h.counters[id] = counter
+	}
+	if expireAt.After(counter.expireAt) {
+		counter.expireAt = expireAt
+	}
+	return counter
+}
+
+// run reconciles the local counters with Redis every interval until the storage is closed
+func (h *HybridStorage) run() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.syncOnce()
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// syncOnce reconciles the local counters with Redis, logging failures
+func (h *HybridStorage) syncOnce() {
+	ctx, cancel := context.WithTimeout(context.Background(), hybridSyncTimeout)
+	defer cancel()
+
+	if err := h.sync(ctx); err != nil {
+		h.logger.Error("Failed to reconcile hybrid counters with Redis", "error", err)
+	}
+}
+
+// hybridSync is a counter taking part in one reconciliation
+type hybridSync struct {
+	id       hybridCounterID
+	counter  *hybridCounter
+	delta    int
+	expireAt time.Time
+	cmd      redis.Cmder
+}
+
+// sync adds the pending increments of every live counter to Redis in a single pipeline
+// and reads back the totals. Counters of expired windows are dropped.
+// Increments that could not be pushed stay pending for the next sync.
+func (h *HybridStorage) sync(ctx context.Context) error {
+	now := h.clock.Now()
+
+	h.mu.Lock()
+	batch := make([]hybridSync, 0, len(h.counters))
+	for id, counter := range h.counters {
+		if !now.Before(counter.expireAt) {
+			delete(h.counters, id)
+			continue
+		}
+		counter.pushing = counter.pending
+		counter.pending = 0
+		batch = append(batch, hybridSync{id: id, counter: counter, delta: counter.pushing, expireAt: counter.expireAt})
+	}
+	h.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	pipe := h.client.Pipeline()
+	for i := range batch {
+		key := h.counterKey(batch[i].id)
+		if batch[i].delta > 0 {
+			batch[i].cmd = pipe.IncrBy(ctx, key, int64(batch[i].delta))
+			pipe.PExpireAt(ctx, key, batch[i].expireAt)
+		} else {
+			batch[i].cmd = pipe.Get(ctx, key)
+		}
+	}
+	// Per-command results are checked below, a missing counter is not a failure
+	_, _ = pipe.Exec(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var syncErr error
+	for _, s := range batch {
+		total, err := hybridTotal(s.cmd)
+		if err != nil {
+			s.counter.pending += s.counter.pushing
+			syncErr = err
+		} else {
+			s.counter.synced = total
+		}
+		s.counter.pushing = 0
+	}
+	if syncErr != nil {
+		return fmt.Errorf("failed to reconcile counters: %w", syncErr)
+	}
+
+	h.logger.Debug("Hybrid counters reconciled", "counters", len(batch))
+	return nil
+}
+
+// hybridTotal returns the window total read by cmd, 0 for a window nobody counted yet
+func hybridTotal(cmd redis.Cmder) (int, error) {
+	switch c := cmd.(type) {
+	case *redis.IntCmd:
+		total, err := c.Result()
+		return int(total), err
+	case *redis.StringCmd:
+		total, err := c.Int()
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return total, err
+	default:
+		return 0, fmt.Errorf("unexpected command %T", cmd)
+	}
+}
+
+// counterKey returns the Redis key of a window counter, in the hash slot of its limiter key
+func (h *HybridStorage) counterKey(id hybridCounterID) string {
+	return h.key(id.key) + ":hybrid:" + strconv.FormatInt(id.windowStart, 10)
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// newTestHybridStorage connects a hybrid storage to mr. Background syncs are disabled
+// by a long interval, tests reconcile explicitly.
+func newTestHybridStorage(t *testing.T, mr *miniredis.Miniredis) *HybridStorage {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	storage, err := NewHybridStorage(config.StorageConfig{RedisAddress: mr.Addr(), HybridSyncInterval: time.Hour}, nil, logger)
+	if err != nil {
+		t.Fatalf("NewHybridStorage failed: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	return storage
+}
+
+// countFixedWindow performs n fixed window checks and returns how many were allowed
+func countFixedWindow(t *testing.T, storage *HybridStorage, n int, limit int, windowStart int64, expireAt time.Time) int {
+	t.Helper()
+	allowed := 0
+	for i := 0; i < n; i++ {
+		ok, _, err := storage.EvalFixedWindow(context.Background(), "key", limit, 1, windowStart, expireAt)
+		if err != nil {
+			t.Fatalf("EvalFixedWindow failed: %v", err)
+		}
+		if ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestHybridStorage_EvalFixedWindow(t *testing.T) {
+	mr := miniredis.RunT(t)
+	first := newTestHybridStorage(t, mr)
+	second := newTestHybridStorage(t, mr)
+	ctx := context.Background()
+
+	windowStart := time.Now().Truncate(time.Minute).UnixNano()
+	expireAt := time.Now().Add(time.Minute)
+
+	// Each instance decides locally until it reconciles
+	if allowed := countFixedWindow(t, first, 6, 10, windowStart, expireAt); allowed != 6 {
+		t.Errorf("Expected 6 requests allowed by the first instance, got %d", allowed)
+	}
+	if err := first.sync(ctx); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if err := second.sync(ctx); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	// The second instance has not seen the window yet, so it learns the total on its next sync
+	if allowed := countFixedWindow(t, second, 2, 10, windowStart, expireAt); allowed != 2 {
+		t.Errorf("Expected 2 requests allowed by the second instance, got %d", allowed)
+	}
+	if err := second.sync(ctx); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if allowed := countFixedWindow(t, second, 5, 10, windowStart, expireAt); allowed != 2 {
+		t.Errorf("Expected the second instance to stop at the shared limit, got %d allowed", allowed)
+	}
+
+	total, err := mr.Get(first.counterKey(hybridCounterID{key: "key", windowStart: windowStart}))
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if total != "8" {
+		t.Errorf("Expected 8 pushed increments, got %s", total)
+	}
+	if ttl := mr.TTL(first.counterKey(hybridCounterID{key: "key", windowStart: windowStart})); ttl <= 0 {
+		t.Errorf("Expected the counter to expire, got TTL %v", ttl)
+	}
+}
+
+func TestHybridStorage_EvalInvalidCost(t *testing.T) {
+	storage := newTestHybridStorage(t, miniredis.RunT(t))
+	ctx := context.Background()
+	now := time.Now()
+
+	if _, _, err := storage.EvalFixedWindow(ctx, "key", 5, -10, now.UnixNano(), now.Add(time.Minute)); !errors.Is(err, ErrInvalidCost) {
+		t.Errorf("Expected ErrInvalidCost, got %v", err)
+	}
+	if _, _, _, err := storage.EvalSlidingWindowCounter(ctx, "key", 5, 0, now.UnixNano(), int64(time.Minute), 0, now.Add(time.Minute)); !errors.Is(err, ErrInvalidCost) {
+		t.Errorf("Expected ErrInvalidCost, got %v", err)
+	}
+	if allowed := countFixedWindow(t, storage, 10, 5, now.UnixNano(), now.Add(time.Minute)); allowed != 5 {
+		t.Errorf("Expected the limit of 5 to be unaffected, got %d allowed", allowed)
+	}
+}
+
+func TestHybridStorage_Overshoot(t *testing.T) {
+	mr := miniredis.RunT(t)
+	instances := []*HybridStorage{newTestHybridStorage(t, mr), newTestHybridStorage(t, mr), newTestHybridStorage(t, mr)}
+
+	windowStart := time.Now().Truncate(time.Minute).UnixNano()
+	expireAt := time.Now().Add(time.Minute)
+
+	// Without syncs the window admits at most instances x limit
+	total := 0
+	for _, instance := range instances {
+		total += countFixedWindow(t, instance, 20, 10, windowStart, expireAt)
+	}
+	if total != 30 {
+		t.Errorf("Expected 30 requests allowed without syncs, got %d", total)
+	}
+
+	// Once reconciled nobody admits more
+	for _, instance := range instances {
+		if err := instance.sync(context.Background()); err != nil {
+			t.Fatalf("sync failed: %v", err)
+		}
+		if allowed := countFixedWindow(t, instance, 1, 10, windowStart, expireAt); allowed != 0 {
+			t.Errorf("Expected no request allowed after sync, got %d", allowed)
+		}
+	}
+}
+
+func TestHybridStorage_EvalSlidingWindowCounter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	first := newTestHybridStorage(t, mr)
+	second := newTestHybridStorage(t, mr)
+	ctx := context.Background()
+
+	window := time.Minute.Nanoseconds()
+	previousStart := time.Now().Truncate(time.Minute).UnixNano()
+	currentStart := previousStart + window
+	expireAt := time.Now().Add(2 * time.Minute)
+
+	// The first instance fills the previous window
+	for i := 0; i < 10; i++ {
+		if _, _, _, err := first.EvalSlidingWindowCounter(ctx, "key", 10, 1, previousStart, window, 0, expireAt); err != nil {
+			t.Fatalf("EvalSlidingWindowCounter failed: %v", err)
+		}
+	}
+	if err := first.sync(ctx); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	// The second instance learns the previous window total from Redis and weighs it
+	if _, _, _, err := second.EvalSlidingWindowCounter(ctx, "key", 10, 1, currentStart, window, 0.5, expireAt); err != nil {
+		t.Fatalf("EvalSlidingWindowCounter failed: %v", err)
+	}
+	if err := second.sync(ctx); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	allowed := 0
+	var previous int
+	for i := 0; i < 10; i++ {
+		ok, _, prev, err := second.EvalSlidingWindowCounter(ctx, "key", 10, 1, currentStart, window, 0.5, expireAt)
+		if err != nil {
+			t.Fatalf("EvalSlidingWindowCounter failed: %v", err)
+		}
+		previous = prev
+		if ok {
+			allowed++
+		}
+	}
+	if previous != 10 {
+		t.Errorf("Expected previous window count 10, got %d", previous)
+	}
+	// 10 * 0.5 + 1 already counted leaves room for 4 more
+	if allowed != 4 {
+		t.Errorf("Expected 4 requests allowed, got %d", allowed)
+	}
+}
+
+func TestHybridStorage_SyncFailureKeepsIncrements(t *testing.T) {
+	mr := miniredis.RunT(t)
+	storage := newTestHybridStorage(t, mr)
+	ctx := context.Background()
+
+	windowStart := time.Now().Truncate(time.Minute).UnixNano()
+	expireAt := time.Now().Add(time.Minute)
+	countFixedWindow(t, storage, 3, 10, windowStart, expireAt)
+
+	// Decisions keep working locally while Redis is unreachable
+	mr.SetError("connection refused")
+	if err := storage.sync(ctx); err == nil {
+		t.Fatal("Expected sync to fail")
+	}
+	if allowed := countFixedWindow(t, storage, 10, 10, windowStart, expireAt); allowed != 7 {
+		t.Errorf("Expected 7 requests allowed while Redis is down, got %d", allowed)
+	}
+
+	// Increments are pushed once Redis is back
+	mr.SetError("")
+	if err := storage.sync(ctx); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	total, err := mr.Get(storage.counterKey(hybridCounterID{key: "key", windowStart: windowStart}))
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if total != "10" {
+		t.Errorf("Expected 10 pushed increments, got %s", total)
+	}
+}
+
+func TestHybridStorage_ClosePushesIncrements(t *testing.T) {
+	mr := miniredis.RunT(t)
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	storage, err := NewHybridStorage(config.StorageConfig{RedisAddress: mr.Addr(), HybridSyncInterval: time.Hour}, nil, logger)
+	if err != nil {
+		t.Fatalf("NewHybridStorage failed: %v", err)
+	}
+
+	windowStart := time.Now().Truncate(time.Minute).UnixNano()
+	expireAt := time.Now().Add(time.Minute)
+	countFixedWindow(t, storage, 4, 10, windowStart, expireAt)
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	total, err := mr.Get(storage.counterKey(hybridCounterID{key: "key", windowStart: windowStart}))
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if total != "4" {
+		t.Errorf("Expected 4 pushed increments, got %s", total)
+	}
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Storage operations reported to StorageMetrics
+const (
+	OperationGet                      = "get"
+	OperationSet                      = "set"
+	OperationDelete                   = "delete"
+	OperationUpdate                   = "update"
+	OperationEvalTokenBucket          = "eval_token_bucket"
+	OperationEvalSlidingWindow        = "eval_sliding_window"
+	OperationEvalFixedWindow          = "eval_fixed_window"
+	OperationEvalSlidingWindowCounter = "eval_sliding_window_counter"
+	OperationEvalGCRA                 = "eval_gcra"
+	OperationEvalLeakyBucket          = "eval_leaky_bucket"
+	OperationEvalAcquireLease         = "eval_acquire_lease"
+	OperationEvalReleaseLease         = "eval_release_lease"
+)
+
+// StorageMetrics receives the outcome of every storage operation, e.g. to export them to Prometheus
+type StorageMetrics interface {
+	// ObserveStorageOperation records the latency of an operation, failed or not
+	ObserveStorageOperation(backend, operation string, duration time.Duration)
+	// IncStorageErrors counts a failed operation
+	IncStorageErrors(backend, operation string)
+	// ObserveStoragePayload records the approximate size in bytes of a value read or written
+	ObserveStoragePayload(backend, operation string, bytes int64)
+}
+
+// serverEvaluator is implemented by backends evaluating every algorithm on the server side
+type serverEvaluator interface {
+	TokenBucketEvaluator
+	SlidingWindowEvaluator
+	FixedWindowEvaluator
+	SlidingWindowCounterEvaluator
+	GCRAEvaluator
+	LeakyBucketEvaluator
+	LeaseEvaluator
+}
+
+// InstrumentedStorage reports the latency, errors and payload sizes of the operations
+// of a storage to StorageMetrics, labelled by backend and operation
+type InstrumentedStorage struct {
+	next    Storage
+	backend string
+	metrics StorageMetrics
+}
+
+// instrumentedEvaluatorStorage also forwards the server-side evaluators of the wrapped backend,
+// so that limiters keep evaluating atomically in it
+type instrumentedEvaluatorStorage struct {
+	*InstrumentedStorage
+	evaluator serverEvaluator
+}
+
+// NewInstrumentedStorage wraps next, reporting its operations to metrics under the backend label.
+// The wrapper implements the same evaluators as next. A backend implementing only some of them
+// cannot be wrapped without losing them and is returned as is.
+func NewInstrumentedStorage(next Storage, backend string, metrics StorageMetrics, logger *slog.Logger) Storage {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	instrumented := &InstrumentedStorage{
+		next:    next,
+		backend: backend,
+		metrics: metrics,
+	}
+
+	if evaluator, ok := next.(serverEvaluator); ok {
+		return &instrumentedEvaluatorStorage{InstrumentedStorage: instrumented, evaluator: evaluator}
+	}
+	if implementsAnyEvaluator(next) {
+		logger.Warn("Storage instrumentation disabled, the backend implements only some evaluators", "backend", backend)
+		return next
+	}
+	return instrumented
+}
+
+// implementsAnyEvaluator reports whether s evaluates any algorithm on the server side
+func implementsAnyEvaluator(s Storage) bool {
+	switch s.(type) {
+	case TokenBucketEvaluator, SlidingWindowEvaluator, FixedWindowEvaluator, SlidingWindowCounterEvaluator,
+		GCRAEvaluator, LeakyBucketEvaluator, LeaseEvaluator:
+		return true
+	default:
+		return false
+	}
+}
+
+// observe records the latency of an operation started at start and counts it as failed if err is set
+func (s *InstrumentedStorage) observe(operation string, start time.Time, err error) {
+	s.metrics.ObserveStorageOperation(s.backend, operation, time.Since(start))
+	if err != nil {
+		s.metrics.IncStorageErrors(s.backend, operation)
+	}
+}
+
+// Get retrieves a value from the wrapped storage
+func (s *InstrumentedStorage) Get(ctx context.Context, key string) (interface{}, error) {
+	start := time.Now()
+	value, err := s.next.Get(ctx, key)
+	s.observe(OperationGet, start, err)
+	if value != nil {
+		s.metrics.ObserveStoragePayload(s.backend, OperationGet, approximateSize(value))
+	}
+	return value, err
+}
+
+// Set stores a value in the wrapped storage
+func (s *InstrumentedStorage) Set(ctx context.Context, key string, value interface{}, expiration int64) error {
+	start := time.Now()
+	err := s.next.Set(ctx, key, value, expiration)
+	s.observe(OperationSet, start, err)
+	s.metrics.ObserveStoragePayload(s.backend, OperationSet, approximateSize(value))
+	return err
+}
+
+// Delete removes a value from the wrapped storage
+func (s *InstrumentedStorage) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := s.next.Delete(ctx, key)
+	s.observe(OperationDelete, start, err)
+	return err
+}
+
+// Update atomically replaces a value in the wrapped storage, the payload is the last value fn returned
+func (s *InstrumentedStorage) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	var written interface{}
+	start := time.Now()
+	err := s.next.Update(ctx, key, func(current interface{}) (interface{}, int64, error) {
+		value, expiration, err := fn(current)
+		written = value
+		return value, expiration, err
+	})
+	s.observe(OperationUpdate, start, err)
+	if err == nil && written != nil {
+		s.metrics.ObserveStoragePayload(s.backend, OperationUpdate, approximateSize(written))
+	}
+	return err
+}
+
+// Unwrap returns the wrapped storage
+func (s *InstrumentedStorage) Unwrap() Storage {
+	return s.next
+}
+
+// Close closes the wrapped storage
+func (s *InstrumentedStorage) Close() error {
+	return s.next.Close()
+}
+
+// EvalTokenBucket evaluates the Token Bucket algorithm in the wrapped storage
+func (s *instrumentedEvaluatorStorage) EvalTokenBucket(
+	ctx context.Context,
+	key string,
+	limit int,
+	window time.Duration,
+	burst int,
+	cost int,
+	now time.Time,
+) (bool, float64, int64, error) {
+	start := time.Now()
+	allowed, tokens, lastRefill, err := s.evaluator.EvalTokenBucket(ctx, key, limit, window, burst, cost, now)
+	s.observe(OperationEvalTokenBucket, start, err)
+	return allowed, tokens, lastRefill, err
+}
+
+// EvalSlidingWindow evaluates the Sliding Window Log algorithm in the wrapped storage
+func (s *instrumentedEvaluatorStorage) EvalSlidingWindow(
+	ctx context.Context,
+	key string,
+	limit int,
+	window time.Duration,
+	cost int,
+	now time.Time,
+) (bool, int, int64, int64, error) {
+	start := time.Now()
+	allowed, count, newest, blocking, err := s.evaluator.EvalSlidingWindow(ctx, key, limit, window, cost, now)
+	s.observe(OperationEvalSlidingWindow, start, err)
+	return allowed, count, newest, blocking, err
+}
+
+// EvalFixedWindow evaluates the Fixed Window Counter algorithm in the wrapped storage
+func (s *instrumentedEvaluatorStorage) EvalFixedWindow(
+	ctx context.Context,
+	key string,
+	limit int,
+	cost int,
+	windowStart int64,
+	expireAt time.Time,
+) (bool, int, error) {
+	start := time.Now()
+	allowed, count, err := s.evaluator.EvalFixedWindow(ctx, key, limit, cost, windowStart, expireAt)
+	s.observe(OperationEvalFixedWindow, start, err)
+	return allowed, count, err
+}
+
+// EvalSlidingWindowCounter evaluates the Sliding Window Counter algorithm in the wrapped storage
+func (s *instrumentedEvaluatorStorage) EvalSlidingWindowCounter(
+	ctx context.Context,
+	key string,
+	limit int,
+	cost int,
+	windowStart int64,
+	window int64,
+	previousWeight float64,
+	expireAt time.Time,
+) (bool, int, int, error) {
+	start := time.Now()
+	allowed, current, previous, err := s.evaluator.EvalSlidingWindowCounter(
+		ctx, key, limit, cost, windowStart, window, previousWeight, expireAt,
+	)
+	s.observe(OperationEvalSlidingWindowCounter, start, err)
+	return allowed, current, previous, err
+}
+
+// EvalGCRA evaluates the Generic Cell Rate Algorithm in the wrapped storage
+func (s *instrumentedEvaluatorStorage) EvalGCRA(
+	ctx context.Context,
+	key string,
+	emissionInterval time.Duration,
+	burstOffset time.Duration,
+	cost int,
+	now time.Time,
+) (bool, int64, error) {
+	start := time.Now()
+	allowed, tat, err := s.evaluator.EvalGCRA(ctx, key, emissionInterval, burstOffset, cost, now)
+	s.observe(OperationEvalGCRA, start, err)
+	return allowed, tat, err
+}
+
+// EvalLeakyBucket evaluates the Leaky Bucket algorithm in the wrapped storage
+func (s *instrumentedEvaluatorStorage) EvalLeakyBucket(
+	ctx context.Context,
+	key string,
+	drainInterval time.Duration,
+	capacity int,
+	cost int,
+	now time.Time,
+) (bool, int64, error) {
+	start := time.Now()
+	allowed, departure, err := s.evaluator.EvalLeakyBucket(ctx, key, drainInterval, capacity, cost, now)
+	s.observe(OperationEvalLeakyBucket, start, err)
+	return allowed, departure, err
+}
+
+// EvalAcquireLease acquires a concurrency lease in the wrapped storage
+func (s *instrumentedEvaluatorStorage) EvalAcquireLease(
+	ctx context.Context,
+	key string,
+	leaseID string,
+	limit int,
+	expireAt time.Time,
+	now time.Time,
+) (bool, error) {
+	start := time.Now()
+	acquired, err := s.evaluator.EvalAcquireLease(ctx, key, leaseID, limit, expireAt, now)
+	s.observe(OperationEvalAcquireLease, start, err)
+	return acquired, err
+}
+
+// EvalReleaseLease releases a concurrency lease in the wrapped storage
+func (s *instrumentedEvaluatorStorage) EvalReleaseLease(ctx context.Context, key string, leaseID string, now time.Time) (bool, error) {
+	start := time.Now()
+	released, err := s.evaluator.EvalReleaseLease(ctx, key, leaseID, now)
+	s.observe(OperationEvalReleaseLease, start, err)
+	return released, err
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// storageMetricsRecorder records storage operation metrics for assertions
+type storageMetricsRecorder struct {
+	mu         sync.Mutex
+	operations map[string]int
+	errors     map[string]int
+	payloads   map[string]int64
+}
+
+func newStorageMetricsRecorder() *storageMetricsRecorder {
+	return &storageMetricsRecorder{
+		operations: make(map[string]int),
+		errors:     make(map[string]int),
+		payloads:   make(map[string]int64),
+	}
+}
+
+func (r *storageMetricsRecorder) ObserveStorageOperation(backend, operation string, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.operations[backend+"/"+operation]++
+}
+
+func (r *storageMetricsRecorder) IncStorageErrors(backend, operation string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors[backend+"/"+operation]++
+}
+
+func (r *storageMetricsRecorder) ObserveStoragePayload(backend, operation string, bytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payloads[backend+"/"+operation] += bytes
+}
+
+func TestInstrumentedStorage_Operations(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	metrics := newStorageMetricsRecorder()
+	storage := NewInstrumentedStorage(NewMemoryStorage(nil, logger), "memory", metrics, logger)
+	ctx := context.Background()
+
+	if _, ok := storage.(TokenBucketEvaluator); ok {
+		t.Error("Memory storage should not gain evaluators when instrumented")
+	}
+
+	if err := storage.Set(ctx, "key", "value", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, err := storage.Get(ctx, "key"); err != nil || value != "value" {
+		t.Fatalf("Expected value, got %v (%v)", value, err)
+	}
+	err := storage.Update(ctx, "key", func(current interface{}) (interface{}, int64, error) {
+		return "longer value", 0, nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := storage.Delete(ctx, "key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := storage.Get(cancelled, "key"); err == nil {
+		t.Fatal("Expected Get to fail with a cancelled context")
+	}
+
+	expected := map[string]int{"memory/set": 1, "memory/get": 2, "memory/update": 1, "memory/delete": 1}
+	for operation, count := range expected {
+		if metrics.operations[operation] != count {
+			t.Errorf("Expected %d %s operations, got %d", count, operation, metrics.operations[operation])
+		}
+	}
+	if metrics.errors["memory/get"] != 1 || len(metrics.errors) != 1 {
+		t.Errorf("Expected a single failed get, got %v", metrics.errors)
+	}
+
+	payloads := map[string]int64{"memory/set": 5, "memory/get": 5, "memory/update": 12}
+	for operation, bytes := range payloads {
+		if metrics.payloads[operation] != bytes {
+			t.Errorf("Expected %d payload bytes for %s, got %d", bytes, operation, metrics.payloads[operation])
+		}
+	}
+}
+
+func TestInstrumentedStorage_Evaluators(t *testing.T) {
+	redisStorage, _ := newTestRedisStorage(t)
+	metrics := newStorageMetricsRecorder()
+	storage := NewInstrumentedStorage(redisStorage, "redis", metrics, nil)
+	ctx := context.Background()
+
+	// Limiters keep evaluating atomically in Redis through the wrapper
+	evaluator, ok := storage.(TokenBucketEvaluator)
+	if !ok {
+		t.Fatal("Instrumented Redis storage should implement TokenBucketEvaluator")
+	}
+	if _, ok := storage.(LeaseEvaluator); !ok {
+		t.Error("Instrumented Redis storage should implement LeaseEvaluator")
+	}
+
+	allowed, _, _, err := evaluator.EvalTokenBucket(ctx, "bucket", 1, time.Minute, 1, 1, time.Now())
+	if err != nil {
+		t.Fatalf("EvalTokenBucket failed: %v", err)
+	}
+	if !allowed {
+		t.Error("First request should be allowed")
+	}
+	if metrics.operations["redis/eval_token_bucket"] != 1 {
+		t.Errorf("Expected the evaluation to be recorded, got %v", metrics.operations)
+	}
+}
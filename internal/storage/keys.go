@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// KeySchemaVersion is the version of the key layout and of the state stored under it.
+// It is part of every namespaced key, so that a future layout can be rolled out next to this one.
+const KeySchemaVersion = 1
+
+// ReservedKeyPrefix starts the keys of state the service keeps next to limiter state, e.g. concurrency leases.
+// Limit checks reject keys starting with it, so a client cannot read or overwrite that state.
+const ReservedKeyPrefix = "_rl:"
+
+// KeyNamespace prefixes the keys written by a storage, so that several applications
+// or environments can share one Redis database or SQL table. The zero value leaves keys unchanged.
+type KeyNamespace struct {
+	prefix string
+}
+
+// NewKeyNamespace returns the namespace "<prefix>:<namespace>:v<KeySchemaVersion>:", omitting empty parts.
+// Without prefix and namespace keys are left unchanged, as they were stored before namespaces.
+// Braces are rejected: in a Redis Cluster they would pin every key to one hash slot.
+func NewKeyNamespace(prefix, namespace string) (KeyNamespace, error) {
+	if prefix == "" && namespace == "" {
+		return KeyNamespace{}, nil
+	}
+	if strings.ContainsAny(prefix+namespace, "{}") {
+		return KeyNamespace{}, fmt.Errorf("key prefix and namespace must not contain braces, got %q and %q", prefix, namespace)
+	}
+
+	var b strings.Builder
+	for _, part := range []string{prefix, namespace} {
+		if part != "" {
+			b.WriteString(part)
+			b.WriteByte(':')
+		}
+	}
+	b.WriteString("v")
+	b.WriteString(strconv.Itoa(KeySchemaVersion))
+	b.WriteByte(':')
+	return KeyNamespace{prefix: b.String()}, nil
+}
+
+// configuredKeyNamespace returns the namespace configured by cfg.KeyPrefix and cfg.Namespace
+func configuredKeyNamespace(cfg config.StorageConfig) (KeyNamespace, error) {
+	keys, err := NewKeyNamespace(cfg.KeyPrefix, cfg.Namespace)
+	if err != nil {
+		return KeyNamespace{}, fmt.Errorf("invalid key namespace: %w", err)
+	}
+	return keys, nil
+}
+
+// Key returns key inside the namespace
+func (n KeyNamespace) Key(key string) string {
+	if n.prefix == "" {
+		return key
+	}
+	return n.prefix + key
+}
+
+// Prefix returns the prefix of every key in the namespace, empty for the zero value
+func (n KeyNamespace) Prefix() string {
+	return n.prefix
+}
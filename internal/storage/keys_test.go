@@ -0,0 +1,41 @@
+package storage
+
+import "testing"
+
+func TestNewKeyNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		prefix    string
+		namespace string
+		want      string
+	}{
+		{"raw keys", "", "", "user:123"},
+		{"prefix", "rl", "", "rl:v1:user:123"},
+		{"namespace", "", "prod", "prod:v1:user:123"},
+		{"prefix and namespace", "rl", "prod", "rl:prod:v1:user:123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := NewKeyNamespace(tt.prefix, tt.namespace)
+			if err != nil {
+				t.Fatalf("NewKeyNamespace failed: %v", err)
+			}
+			if key := keys.Key("user:123"); key != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, key)
+			}
+		})
+	}
+
+	if key := (KeyNamespace{}).Key("user:123"); key != "user:123" {
+		t.Errorf("Expected the zero value to leave keys unchanged, got %s", key)
+	}
+}
+
+func TestNewKeyNamespace_Invalid(t *testing.T) {
+	for _, tt := range []struct{ prefix, namespace string }{{"{rl}", ""}, {"rl", "prod}"}} {
+		if _, err := NewKeyNamespace(tt.prefix, tt.namespace); err == nil {
+			t.Errorf("Expected error for prefix %q and namespace %q", tt.prefix, tt.namespace)
+		}
+	}
+}
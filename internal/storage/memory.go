@@ -1,30 +1,134 @@
 package storage
 
 import (
+	"container/heap"
 	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// Memory storage eviction policies selected by config.StorageConfig.MemoryEviction
+const (
+	// EvictionLRU evicts the least recently used key first
+	EvictionLRU = "lru"
+	// EvictionLFU evicts the least frequently used key first
+	EvictionLFU = "lfu"
+)
+
+// Eviction reasons reported to MemoryMetrics
+const (
+	// EvictionReasonExpired marks keys removed after their expiration
+	EvictionReasonExpired = "expired"
+	// EvictionReasonCapacity marks keys removed to stay within the entry or memory limit
+	EvictionReasonCapacity = "capacity"
 )
 
-// MemoryStorage implements in-memory storage using sync.Map
+// MemoryMetrics receives memory storage events, e.g. to export them to Prometheus
+type MemoryMetrics interface {
+	// IncMemoryEvictions counts a key removed by the storage itself
+	IncMemoryEvictions(reason string)
+	// SetMemoryKeys reports the number of stored keys
+	SetMemoryKeys(count int)
+}
+
+// memoryItemOverhead approximates the bookkeeping bytes of one entry on top of its key and value
+const memoryItemOverhead = 96
+
+// MemoryStorage implements in-memory storage
 // Suitable for single-instance deployments
 type MemoryStorage struct {
-	data   sync.Map
-	logger *slog.Logger
+	mu    sync.Mutex
+	items map[string]*memoryItem
+	usage evictionQueue
+	bytes int64  // Approximate memory used by all entries
+	tick  uint64 // Logical clock ordering accesses
+	locks keyLocks
+
+	maxEntries int
+	maxBytes   int64
+	keys       KeyNamespace
+	metrics    MemoryMetrics
+	clock      clock.Clock
+	logger     *slog.Logger
+
+	snapshotMu sync.Mutex // Serializes snapshot writes
+
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
-// NewMemoryStorage creates a new in-memory storage instance
-func NewMemoryStorage(logger *slog.Logger) *MemoryStorage {
+// NewMemoryStorage creates a new unbounded in-memory storage instance.
+// Expired entries are removed when they are read. A nil clock uses the system clock.
+func NewMemoryStorage(clk clock.Clock, logger *slog.Logger) *MemoryStorage {
 	if logger == nil {
 		logger = slog.Default()
 	}
+	if clk == nil {
+		clk = clock.System()
+	}
 	return &MemoryStorage{
-		data:   sync.Map{},
+		items:  make(map[string]*memoryItem),
+		clock:  clk,
 		logger: logger,
+		stop:   make(chan struct{}),
 	}
 }
 
+// NewMemoryStorageWithConfig creates an in-memory storage instance bounded by
+// cfg.MemoryMaxEntries and cfg.MemoryMaxBytes, evicting keys according to cfg.MemoryEviction.
+// Expired entries are removed in the background every cfg.MemoryCleanupInterval.
+// metrics may be nil.
+func NewMemoryStorageWithConfig(cfg config.StorageConfig, metrics MemoryMetrics, clk clock.Clock, logger *slog.Logger) (*MemoryStorage, error) {
+	if cfg.MemoryMaxEntries < 0 {
+		return nil, fmt.Errorf("memory max entries must not be negative, got %d", cfg.MemoryMaxEntries)
+	}
+	if cfg.MemoryMaxBytes < 0 {
+		return nil, fmt.Errorf("memory max bytes must not be negative, got %d", cfg.MemoryMaxBytes)
+	}
+	if cfg.MemoryCleanupInterval < 0 {
+		return nil, fmt.Errorf("memory cleanup interval must not be negative, got %v", cfg.MemoryCleanupInterval)
+	}
+	if cfg.MemorySnapshotInterval < 0 {
+		return nil, fmt.Errorf("memory snapshot interval must not be negative, got %v", cfg.MemorySnapshotInterval)
+	}
+
+	m := NewMemoryStorage(clk, logger)
+	switch cfg.MemoryEviction {
+	case "", EvictionLRU:
+	case EvictionLFU:
+		m.usage.lfu = true
+	default:
+		return nil, fmt.Errorf("unsupported memory eviction policy: %s", cfg.MemoryEviction)
+	}
+	keys, err := configuredKeyNamespace(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m.keys = keys
+	m.maxEntries = cfg.MemoryMaxEntries
+	m.maxBytes = cfg.MemoryMaxBytes
+	m.metrics = metrics
+
+	if cfg.MemoryCleanupInterval > 0 {
+		go m.cleanup(cfg.MemoryCleanupInterval)
+	}
+
+	m.logger.Info("Memory storage configured",
+		"max_entries", m.maxEntries,
+		"max_bytes", m.maxBytes,
+		"eviction", cfg.MemoryEviction,
+		"cleanup_interval", cfg.MemoryCleanupInterval,
+		"key_prefix", keys.Prefix(),
+	)
+	return m, nil
+}
+
 // Get retrieves a value from memory storage
 func (m *MemoryStorage) Get(ctx context.Context, key string) (interface{}, error) {
 	// Check context cancellation
@@ -34,23 +138,9 @@ func (m *MemoryStorage) Get(ctx context.Context, key string) (interface{}, error
 		return nil, ctx.Err()
 	default:
 	}
+	key = m.keys.Key(key)
 
-	value, ok := m.data.Load(key)
-	if !ok {
-		return nil, nil
-	}
-
-	// Check if the value has expired
-	if item, ok := value.(*memoryItem); ok {
-		if item.expiresAt > 0 && time.Now().Unix() >= item.expiresAt {
-			m.data.Delete(key)
-			m.logger.Debug("Item expired and removed", "key", key)
-			return nil, nil
-		}
-		return item.value, nil
-	}
-
-	return value, nil
+	return m.load(key), nil
 }
 
 // Set stores a value in memory storage with optional expiration
@@ -62,12 +152,12 @@ func (m *MemoryStorage) Set(ctx context.Context, key string, value interface{},
 		return ctx.Err()
 	default:
 	}
+	key = m.keys.Key(key)
 
-	item := &memoryItem{
-		value:     value,
-		expiresAt: expiration,
-	}
-	m.data.Store(key, item)
+	m.locks.lock(key)
+	defer m.locks.unlock(key)
+
+	m.store(key, value, expiration)
 	m.logger.Debug("Item stored", "key", key, "expiration", expiration)
 	return nil
 }
@@ -81,21 +171,351 @@ func (m *MemoryStorage) Delete(ctx context.Context, key string) error {
 		return ctx.Err()
 	default:
 	}
+	key = m.keys.Key(key)
+
+	m.locks.lock(key)
+	defer m.locks.unlock(key)
 
-	m.data.Delete(key)
+	m.mu.Lock()
+	if item, ok := m.items[key]; ok {
+		m.remove(item, "")
+	}
+	m.mu.Unlock()
 	m.logger.Debug("Item deleted", "key", key)
 	return nil
 }
 
-// Close closes the memory storage (no-op for in-memory storage)
+// Update atomically replaces a value in memory storage.
+// Updates of the same key are serialized with a per-key lock, different keys never contend.
+func (m *MemoryStorage) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		m.logger.Warn("Update operation cancelled", "key", key, "error", ctx.Err())
+		return ctx.Err()
+	default:
+	}
+	key = m.keys.Key(key)
+
+	m.locks.lock(key)
+	defer m.locks.unlock(key)
+
+	value, expiration, err := fn(m.load(key))
+	if err != nil {
+		return err
+	}
+
+	m.store(key, value, expiration)
+	m.logger.Debug("Item updated", "key", key, "expiration", expiration)
+	return nil
+}
+
+// Close stops the background cleanup and snapshots of the memory storage
 func (m *MemoryStorage) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.stop)
+	})
 	m.logger.Info("Memory storage closed")
 	return nil
 }
 
+// Len returns the number of stored keys, including expired keys not removed yet
+func (m *MemoryStorage) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.items)
+}
+
+// liveItems copies the entries not expired at now (Unix seconds), so they can be encoded without blocking checks.
+// Stored values are replaced on update, never modified in place.
+func (m *MemoryStorage) liveItems(now int64) []memoryItem {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]memoryItem, 0, len(m.items))
+	for _, item := range m.items {
+		if !item.expired(now) {
+			entries = append(entries, memoryItem{key: item.key, value: item.value, expiresAt: item.expiresAt})
+		}
+	}
+	return entries
+}
+
+// handOver passes the live value stored at key to transfer while holding the lock of the key,
+// and removes the key if transfer reports that it was taken over, so that no update is lost in between
+func (m *MemoryStorage) handOver(key string, now int64, transfer func(value interface{}, expiresAt int64) (bool, error)) (bool, error) {
+	m.locks.lock(key)
+	defer m.locks.unlock(key)
+
+	m.mu.Lock()
+	item, ok := m.items[key]
+	if !ok || item.expired(now) {
+		m.mu.Unlock()
+		return false, nil
+	}
+	value, expiresAt := item.value, item.expiresAt
+	m.mu.Unlock()
+
+	taken, err := transfer(value, expiresAt)
+	if err != nil || !taken {
+		return false, err
+	}
+
+	m.mu.Lock()
+	if item, ok := m.items[key]; ok {
+		m.remove(item, "")
+	}
+	m.mu.Unlock()
+	return true, nil
+}
+
+// load returns the live value stored at key, removing it if it has expired
+func (m *MemoryStorage) load(key string) interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[key]
+	if !ok {
+		return nil
+	}
+
+	// Check if the value has expired
+	if item.expired(m.clock.Now().Unix()) {
+		m.remove(item, EvictionReasonExpired)
+		m.logger.Debug("Item expired and removed", "key", key)
+		return nil
+	}
+
+	m.touch(item)
+	return item.value
+}
+
+// store saves value at key with the given expiration and evicts other keys beyond the limits
+func (m *MemoryStorage) store(key string, value interface{}, expiration int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Sizes are only needed to enforce the memory budget, measuring typed values is not free
+	var size int64
+	if m.maxBytes > 0 {
+		size = int64(len(key)) + approximateSize(value) + memoryItemOverhead
+	}
+	item, ok := m.items[key]
+	if ok {
+		m.bytes += size - item.size
+		item.value = value
+		item.expiresAt = expiration
+		item.size = size
+		m.touch(item)
+	} else {
+		item = &memoryItem{
+			key:       key,
+			value:     value,
+			expiresAt: expiration,
+			size:      size,
+		}
+		m.items[key] = item
+		m.bytes += size
+		m.tick++
+		item.lastUsed = m.tick
+		item.hits = 1
+		heap.Push(&m.usage, item)
+		m.reportKeys()
+	}
+
+	m.evict(item)
+}
+
+// touch records an access to item
+func (m *MemoryStorage) touch(item *memoryItem) {
+	m.tick++
+	item.lastUsed = m.tick
+	item.hits++
+	heap.Fix(&m.usage, item.index)
+}
+
+// evict removes the least recently or frequently used keys until the storage fits its limits.
+// The item just written is never evicted, even if it alone exceeds the memory budget.
+func (m *MemoryStorage) evict(written *memoryItem) {
+	if !m.overLimit() {
+		return
+	}
+
+	heap.Remove(&m.usage, written.index)
+	for m.usage.Len() > 0 && m.overLimit() {
+		victim := m.usage.items[0]
+		m.remove(victim, EvictionReasonCapacity)
+		m.logger.Debug("Item evicted", "key", victim.key, "entries", len(m.items), "bytes", m.bytes)
+	}
+	heap.Push(&m.usage, written)
+}
+
+// overLimit reports whether the storage holds more entries or bytes than allowed
+func (m *MemoryStorage) overLimit() bool {
+	return (m.maxEntries > 0 && len(m.items) > m.maxEntries) ||
+		(m.maxBytes > 0 && m.bytes > m.maxBytes)
+}
+
+// remove deletes item, reason is empty for deletions requested by the caller
+func (m *MemoryStorage) remove(item *memoryItem, reason string) {
+	heap.Remove(&m.usage, item.index)
+	delete(m.items, item.key)
+	m.bytes -= item.size
+	if m.metrics != nil && reason != "" {
+		m.metrics.IncMemoryEvictions(reason)
+	}
+	m.reportKeys()
+}
+
+// reportKeys publishes the number of stored keys
+func (m *MemoryStorage) reportKeys() {
+	if m.metrics != nil {
+		m.metrics.SetMemoryKeys(len(m.items))
+	}
+}
+
+// cleanup periodically removes expired items
+func (m *MemoryStorage) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.removeExpired(m.clock.Now().Unix())
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// removeExpired removes every item expired at now and returns how many were removed
+func (m *MemoryStorage) removeExpired(now int64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for _, item := range m.items {
+		if item.expired(now) {
+			m.remove(item, EvictionReasonExpired)
+			removed++
+		}
+	}
+	if removed > 0 {
+		m.logger.Debug("Expired items removed", "count", removed, "entries", len(m.items))
+	}
+	return removed
+}
+
+// approximateSize estimates the memory used by a stored value in bytes
+func approximateSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	default:
+		// Typed limiter state is small, its encoding is close enough to its footprint
+		data, err := json.Marshal(v)
+		if err != nil {
+			return 0
+		}
+		return int64(len(data))
+	}
+}
+
 // memoryItem represents a stored item with expiration
 type memoryItem struct {
+	key       string
 	value     interface{}
-	expiresAt int64 // Unix timestamp, 0 means no expiration
+	expiresAt int64  // Unix timestamp, 0 means no expiration
+	size      int64  // Approximate memory used by the entry in bytes
+	lastUsed  uint64 // Tick of the last access
+	hits      uint64 // Number of accesses
+	index     int    // Position in the eviction queue
+}
+
+// expired reports whether the item has expired at now (Unix seconds)
+func (i *memoryItem) expired(now int64) bool {
+	return i.expiresAt > 0 && now >= i.expiresAt
+}
+
+// evictionQueue is a min-heap of items ordered by eviction priority:
+// least recently used first, or least frequently used first with ties broken by recency
+type evictionQueue struct {
+	items []*memoryItem
+	lfu   bool
+}
+
+func (q evictionQueue) Len() int { return len(q.items) }
+
+func (q evictionQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if q.lfu && a.hits != b.hits {
+		return a.hits < b.hits
+	}
+	return a.lastUsed < b.lastUsed
+}
+
+func (q evictionQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.items[i].index = i
+	q.items[j].index = j
 }
 
+func (q *evictionQueue) Push(x interface{}) {
+	item := x.(*memoryItem)
+	item.index = len(q.items)
+	q.items = append(q.items, item)
+}
+
+func (q *evictionQueue) Pop() interface{} {
+	last := len(q.items) - 1
+	item := q.items[last]
+	q.items[last] = nil
+	q.items = q.items[:last]
+	item.index = -1
+	return item
+}
+
+// keyLocks hands out a mutex per key and forgets it once nobody holds or waits for it
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock is a mutex shared by all callers working on the same key
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock acquires the mutex for key
+func (k *keyLocks) lock(key string) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyLock)
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+}
+
+// unlock releases the mutex for key
+func (k *keyLocks) unlock(key string) {
+	k.mu.Lock()
+	l := k.locks[key]
+	l.refs--
+	if l.refs == 0 {
+		delete(k.locks, key)
+	}
+	k.mu.Unlock()
+
+	l.mu.Unlock()
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// memorySnapshotVersion identifies the layout of snapshot files
+const memorySnapshotVersion = 1
+
+// memorySnapshot is the file representation of the memory storage contents
+type memorySnapshot struct {
+	Version   int                  `json:"version"`
+	CreatedAt int64                `json:"created_at"` // Unix timestamp
+	Items     []memorySnapshotItem `json:"items"`
+}
+
+// memorySnapshotItem is a stored key with its JSON encoded value
+type memorySnapshotItem struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt int64           `json:"expires_at,omitempty"` // Unix timestamp, 0 means no expiration
+}
+
+// SaveSnapshot writes every live key with its expiration to path and returns how many were written.
+// The file is replaced atomically, so a crash while saving keeps the previous snapshot.
+func (m *MemoryStorage) SaveSnapshot(path string) (int, error) {
+	m.snapshotMu.Lock()
+	defer m.snapshotMu.Unlock()
+
+	now := m.clock.Now().Unix()
+	entries := m.liveItems(now)
+
+	snapshot := memorySnapshot{
+		Version:   memorySnapshotVersion,
+		CreatedAt: now,
+		Items:     make([]memorySnapshotItem, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		value, err := json.Marshal(entry.value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal value of %s: %w", entry.key, err)
+		}
+		snapshot.Items = append(snapshot.Items, memorySnapshotItem{
+			Key:       entry.key,
+			Value:     value,
+			ExpiresAt: entry.expiresAt,
+		})
+	}
+
+	if err := writeFileAtomic(path, snapshot); err != nil {
+		return 0, err
+	}
+
+	m.logger.Debug("Memory snapshot saved", "path", path, "keys", len(snapshot.Items))
+	return len(snapshot.Items), nil
+}
+
+// LoadSnapshot restores the keys saved to path, skipping those that expired in the meantime,
+// and returns how many were restored. A missing file restores nothing.
+// String values are restored as is, other values as their JSON encoding,
+// which limiters decode like state read from Redis.
+func (m *MemoryStorage) LoadSnapshot(path string) (int, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		m.logger.Info("No memory snapshot to restore", "path", path)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	var snapshot memorySnapshot
+	if err := json.NewDecoder(bufio.NewReader(file)).Decode(&snapshot); err != nil {
+		return 0, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	if snapshot.Version != memorySnapshotVersion {
+		return 0, fmt.Errorf("unsupported snapshot version: %d", snapshot.Version)
+	}
+
+	now := m.clock.Now().Unix()
+	restored := 0
+	for _, entry := range snapshot.Items {
+		if entry.ExpiresAt > 0 && now >= entry.ExpiresAt {
+			continue
+		}
+
+		var value interface{} = string(entry.Value)
+		var text string
+		if err := json.Unmarshal(entry.Value, &text); err == nil {
+			value = text
+		}
+
+		m.locks.lock(entry.Key)
+		m.store(entry.Key, value, entry.ExpiresAt)
+		m.locks.unlock(entry.Key)
+		restored++
+	}
+
+	m.logger.Info("Memory snapshot restored",
+		"path", path,
+		"keys", restored,
+		"age", m.clock.Now().Sub(time.Unix(snapshot.CreatedAt, 0)).Round(time.Second),
+	)
+	return restored, nil
+}
+
+// StartSnapshots saves a snapshot to path every interval until the storage is closed
+func (m *MemoryStorage) StartSnapshots(path string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := m.SaveSnapshot(path); err != nil {
+					m.logger.Error("Failed to save memory snapshot", "path", path, "error", err)
+				}
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// writeFileAtomic encodes v as JSON into a temporary file next to path and renames it over path
+func writeFileAtomic(path string, v interface{}) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	writer := bufio.NewWriter(file)
+	if err := json.NewEncoder(writer).Encode(v); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+	return nil
+}
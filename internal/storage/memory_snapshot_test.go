@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+)
+
+func TestMemoryStorage_Snapshot(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	path := filepath.Join(t.TempDir(), "memory.snapshot")
+	ctx := context.Background()
+
+	type state struct {
+		Count int `json:"count"`
+	}
+	expiration := time.Now().Add(time.Hour).Unix()
+
+	source := NewMemoryStorage(nil, logger)
+	source.Set(ctx, "text", "value", expiration)
+	source.Set(ctx, "typed", state{Count: 3}, 0)
+	source.Set(ctx, "expired", "value", time.Now().Add(-time.Second).Unix())
+
+	saved, err := source.SaveSnapshot(path)
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	if saved != 2 {
+		t.Errorf("Expected 2 keys saved, got %d", saved)
+	}
+	// No temporary files are left behind
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected only the snapshot file, got %d entries", len(entries))
+	}
+
+	target := NewMemoryStorage(nil, logger)
+	restored, err := target.LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if restored != 2 {
+		t.Errorf("Expected 2 keys restored, got %d", restored)
+	}
+
+	if value, _ := target.Get(ctx, "text"); value != "value" {
+		t.Errorf("Expected text value to be restored, got %v", value)
+	}
+	if item := target.items["text"]; item == nil || item.expiresAt != expiration {
+		t.Errorf("Expected text expiration %d to be restored", expiration)
+	}
+	// Typed values come back as their JSON encoding
+	if value, _ := target.Get(ctx, "typed"); value != `{"count":3}` {
+		t.Errorf("Expected typed value as JSON, got %v", value)
+	}
+	if value, _ := target.Get(ctx, "expired"); value != nil {
+		t.Errorf("Expected expired key not to be restored, got %v", value)
+	}
+}
+
+func TestMemoryStorage_SnapshotRestoresState(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	path := filepath.Join(t.TempDir(), "memory.snapshot")
+	ctx := context.Background()
+	clk := clock.NewFake(time.Now())
+
+	type bucketState struct {
+		Tokens     float64 `json:"tokens"`
+		LastRefill int64   `json:"last_refill"`
+	}
+	source := NewMemoryStorage(clk, logger)
+	err := source.Update(ctx, "bucket", func(current interface{}) (interface{}, int64, error) {
+		return bucketState{Tokens: 1.5, LastRefill: clk.Now().UnixNano()}, clk.Now().Add(time.Minute).Unix(), nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	source.Set(ctx, "short", "value", clk.Now().Add(2*time.Second).Unix())
+
+	if saved, err := source.SaveSnapshot(path); err != nil || saved != 2 {
+		t.Fatalf("Expected 2 keys saved, got %d (%v)", saved, err)
+	}
+
+	// The service restarts after short expired
+	clk.Advance(5 * time.Second)
+	target := NewMemoryStorage(clk, logger)
+	restored, err := target.LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if restored != 1 {
+		t.Errorf("Expected only the live key to be restored, got %d", restored)
+	}
+	if value, _ := target.Get(ctx, "short"); value != nil {
+		t.Errorf("Expected key expired since the snapshot to be skipped, got %v", value)
+	}
+
+	// Limiters continue from the restored state instead of a fresh one
+	err = target.Update(ctx, "bucket", func(current interface{}) (interface{}, int64, error) {
+		text, ok := current.(string)
+		if !ok {
+			t.Fatalf("Expected restored state as JSON, got %T", current)
+		}
+		var state bucketState
+		if err := json.Unmarshal([]byte(text), &state); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		if state.Tokens != 1.5 {
+			t.Errorf("Expected 1.5 restored tokens, got %v", state.Tokens)
+		}
+		return current, clk.Now().Add(time.Minute).Unix(), nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+}
+
+func TestMemoryStorage_LoadSnapshotMissingOrInvalid(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	dir := t.TempDir()
+	storage := NewMemoryStorage(nil, logger)
+
+	restored, err := storage.LoadSnapshot(filepath.Join(dir, "missing.snapshot"))
+	if err != nil {
+		t.Fatalf("Expected missing snapshot to be ignored, got %v", err)
+	}
+	if restored != 0 {
+		t.Errorf("Expected nothing restored, got %d", restored)
+	}
+
+	invalid := map[string]string{
+		"corrupted":           `{"version":1,"items":[`,
+		"not json":            "memory snapshot",
+		"unsupported version": `{"version":99,"items":[]}`,
+		"missing version":     `{"items":[{"key":"key","value":"\"value\""}]}`,
+	}
+	for name, content := range invalid {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			if _, err := storage.LoadSnapshot(path); err == nil {
+				t.Error("Expected error for invalid snapshot")
+			}
+		})
+	}
+}
+
+func TestMemoryStorage_PeriodicSnapshots(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	path := filepath.Join(t.TempDir(), "memory.snapshot")
+	storage := NewMemoryStorage(nil, logger)
+	defer storage.Close()
+
+	storage.Set(context.Background(), "key", "value", 0)
+	storage.StartSnapshots(path, 10*time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	restored, err := NewMemoryStorage(nil, logger).LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if restored != 1 {
+		t.Errorf("Expected 1 key restored, got %d", restored)
+	}
+}
@@ -2,15 +2,20 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
 )
 
 func TestMemoryStorage_GetSetDelete(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	storage := NewMemoryStorage(logger)
+	storage := NewMemoryStorage(nil, logger)
 	ctx := context.Background()
 
 	key := "test-key"
@@ -49,14 +54,14 @@ func TestMemoryStorage_GetSetDelete(t *testing.T) {
 
 func TestMemoryStorage_Expiration(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	storage := NewMemoryStorage(logger)
+	clk := clock.NewFake(time.Now())
+	storage := NewMemoryStorage(clk, logger)
 	ctx := context.Background()
 
 	key := "expiring-key"
 	value := "expiring-value"
-	// Expiration is stored as Unix timestamp in seconds, so we use
-	// second-level precision in the test to avoid flakiness.
-	expiration := time.Now().Add(1 * time.Second).Unix()
+	// Expiration is stored as Unix timestamp in seconds
+	expiration := clk.Now().Add(1 * time.Second).Unix()
 
 	// Set with expiration
 	err := storage.Set(ctx, key, value, expiration)
@@ -73,8 +78,8 @@ func TestMemoryStorage_Expiration(t *testing.T) {
 		t.Errorf("Expected %v, got %v", value, result)
 	}
 
-	// Wait for expiration (slightly more than 1 second)
-	time.Sleep(1100 * time.Millisecond)
+	// Move past the expiration
+	clk.Advance(1 * time.Second)
 
 	// Get after expiration
 	result, err = storage.Get(ctx, key)
@@ -88,7 +93,7 @@ func TestMemoryStorage_Expiration(t *testing.T) {
 
 func TestMemoryStorage_ContextCancellation(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	storage := NewMemoryStorage(logger)
+	storage := NewMemoryStorage(nil, logger)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
@@ -114,7 +119,7 @@ func TestMemoryStorage_ContextCancellation(t *testing.T) {
 
 func TestMemoryStorage_Close(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	storage := NewMemoryStorage(logger)
+	storage := NewMemoryStorage(nil, logger)
 
 	err := storage.Close()
 	if err != nil {
@@ -122,3 +127,295 @@ func TestMemoryStorage_Close(t *testing.T) {
 	}
 }
 
+func TestMemoryStorage_Update(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	storage := NewMemoryStorage(nil, logger)
+	ctx := context.Background()
+
+	// Absent key is passed as nil
+	err := storage.Update(ctx, "key", func(current interface{}) (interface{}, int64, error) {
+		if current != nil {
+			t.Errorf("Expected nil for absent key, got %v", current)
+		}
+		return "first", 0, nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	err = storage.Update(ctx, "key", func(current interface{}) (interface{}, int64, error) {
+		if current != "first" {
+			t.Errorf("Expected first, got %v", current)
+		}
+		return "second", 0, nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	result, err := storage.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if result != "second" {
+		t.Errorf("Expected second, got %v", result)
+	}
+
+	// An error from fn leaves the value untouched
+	errAbort := errors.New("abort")
+	err = storage.Update(ctx, "key", func(current interface{}) (interface{}, int64, error) {
+		return "third", 0, errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("Expected abort error, got %v", err)
+	}
+	result, _ = storage.Get(ctx, "key")
+	if result != "second" {
+		t.Errorf("Expected second after aborted update, got %v", result)
+	}
+}
+
+func TestMemoryStorage_UpdateConcurrent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	storage := NewMemoryStorage(nil, logger)
+	ctx := context.Background()
+
+	const goroutines = 100
+	const increments = 100
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				err := storage.Update(ctx, "counter", func(current interface{}) (interface{}, int64, error) {
+					count, _ := current.(int)
+					return count + 1, 0, nil
+				})
+				if err != nil {
+					t.Errorf("Update failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result, err := storage.Get(ctx, "counter")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if result != goroutines*increments {
+		t.Errorf("Expected %d, got %v", goroutines*increments, result)
+	}
+	if len(storage.locks.locks) != 0 {
+		t.Errorf("Expected key locks to be released, got %d", len(storage.locks.locks))
+	}
+}
+
+// memoryMetricsRecorder records memory storage metrics for assertions
+type memoryMetricsRecorder struct {
+	mu        sync.Mutex
+	evictions map[string]int
+	keys      int
+}
+
+func (r *memoryMetricsRecorder) IncMemoryEvictions(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.evictions == nil {
+		r.evictions = make(map[string]int)
+	}
+	r.evictions[reason]++
+}
+
+func (r *memoryMetricsRecorder) SetMemoryKeys(count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = count
+}
+
+func (r *memoryMetricsRecorder) snapshot() (map[string]int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	evictions := make(map[string]int, len(r.evictions))
+	for reason, count := range r.evictions {
+		evictions[reason] = count
+	}
+	return evictions, r.keys
+}
+
+// assertKeys checks which of the keys are still stored
+func assertKeys(t *testing.T, storage *MemoryStorage, present []string, evicted []string) {
+	t.Helper()
+	ctx := context.Background()
+	for _, key := range present {
+		if value, _ := storage.Get(ctx, key); value == nil {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+	for _, key := range evicted {
+		if value, _ := storage.Get(ctx, key); value != nil {
+			t.Errorf("Expected %s to be evicted", key)
+		}
+	}
+}
+
+func TestMemoryStorage_EvictLRU(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	metrics := &memoryMetricsRecorder{}
+	storage, err := NewMemoryStorageWithConfig(config.StorageConfig{MemoryMaxEntries: 2, MemoryEviction: EvictionLRU}, metrics, nil, logger)
+	if err != nil {
+		t.Fatalf("NewMemoryStorageWithConfig failed: %v", err)
+	}
+	defer storage.Close()
+	ctx := context.Background()
+
+	storage.Set(ctx, "a", "1", 0)
+	storage.Set(ctx, "b", "2", 0)
+	// Reading a makes b the least recently used key
+	storage.Get(ctx, "a")
+	storage.Set(ctx, "c", "3", 0)
+
+	if storage.Len() != 2 {
+		t.Errorf("Expected 2 keys, got %d", storage.Len())
+	}
+	assertKeys(t, storage, []string{"a", "c"}, []string{"b"})
+
+	evictions, keys := metrics.snapshot()
+	if evictions[EvictionReasonCapacity] != 1 {
+		t.Errorf("Expected 1 capacity eviction, got %d", evictions[EvictionReasonCapacity])
+	}
+	if keys != 2 {
+		t.Errorf("Expected 2 keys reported, got %d", keys)
+	}
+}
+
+func TestMemoryStorage_EvictLFU(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	storage, err := NewMemoryStorageWithConfig(config.StorageConfig{MemoryMaxEntries: 2, MemoryEviction: EvictionLFU}, nil, nil, logger)
+	if err != nil {
+		t.Fatalf("NewMemoryStorageWithConfig failed: %v", err)
+	}
+	defer storage.Close()
+	ctx := context.Background()
+
+	storage.Set(ctx, "a", "1", 0)
+	storage.Set(ctx, "b", "2", 0)
+	// a is used more often, even though b was used last
+	storage.Get(ctx, "a")
+	storage.Get(ctx, "a")
+	storage.Get(ctx, "b")
+
+	// The key just written is never the victim, even with the fewest hits
+	storage.Set(ctx, "c", "3", 0)
+	assertKeys(t, storage, []string{"a", "c"}, []string{"b"})
+}
+
+func TestMemoryStorage_EvictMaxBytes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	// Room for two entries of a one byte key and a 100 byte value
+	budget := int64(2 * (1 + 100 + memoryItemOverhead))
+	storage, err := NewMemoryStorageWithConfig(config.StorageConfig{MemoryMaxBytes: budget}, nil, nil, logger)
+	if err != nil {
+		t.Fatalf("NewMemoryStorageWithConfig failed: %v", err)
+	}
+	defer storage.Close()
+	ctx := context.Background()
+
+	value := string(make([]byte, 100))
+	storage.Set(ctx, "a", value, 0)
+	storage.Set(ctx, "b", value, 0)
+	assertKeys(t, storage, []string{"a", "b"}, nil)
+
+	storage.Set(ctx, "c", value, 0)
+	assertKeys(t, storage, []string{"b", "c"}, []string{"a"})
+
+	// Growing a value also counts against the budget
+	storage.Update(ctx, "c", func(interface{}) (interface{}, int64, error) {
+		return value + value, 0, nil
+	})
+	assertKeys(t, storage, []string{"c"}, []string{"b"})
+}
+
+func TestMemoryStorage_BackgroundCleanup(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	metrics := &memoryMetricsRecorder{}
+	storage, err := NewMemoryStorageWithConfig(config.StorageConfig{MemoryCleanupInterval: 10 * time.Millisecond}, metrics, nil, logger)
+	if err != nil {
+		t.Fatalf("NewMemoryStorageWithConfig failed: %v", err)
+	}
+	defer storage.Close()
+	ctx := context.Background()
+
+	// Expired keys that are never read again are removed by the janitor
+	past := time.Now().Add(-time.Second).Unix()
+	for _, key := range []string{"a", "b", "c"} {
+		storage.Set(ctx, key, "value", past)
+	}
+	storage.Set(ctx, "live", "value", 0)
+
+	deadline := time.Now().Add(time.Second)
+	for storage.Len() > 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if storage.Len() != 1 {
+		t.Fatalf("Expected only the live key to remain, got %d keys", storage.Len())
+	}
+
+	evictions, keys := metrics.snapshot()
+	if evictions[EvictionReasonExpired] != 3 {
+		t.Errorf("Expected 3 expired evictions, got %d", evictions[EvictionReasonExpired])
+	}
+	if keys != 1 {
+		t.Errorf("Expected 1 key reported, got %d", keys)
+	}
+}
+
+func TestMemoryStorage_KeyNamespace(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	storage, err := NewMemoryStorageWithConfig(config.StorageConfig{KeyPrefix: "rl", Namespace: "prod"}, nil, nil, logger)
+	if err != nil {
+		t.Fatalf("NewMemoryStorageWithConfig failed: %v", err)
+	}
+	defer storage.Close()
+	ctx := context.Background()
+
+	if err := storage.Set(ctx, "key", "value", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, ok := storage.items["rl:prod:v1:key"]; !ok {
+		t.Error("Expected the key to be stored inside the namespace")
+	}
+	if value, _ := storage.Get(ctx, "key"); value != "value" {
+		t.Errorf("Expected value, got %v", value)
+	}
+	if err := storage.Delete(ctx, "key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if storage.Len() != 0 {
+		t.Errorf("Expected empty storage after delete, got %d entries", storage.Len())
+	}
+}
+
+func TestNewMemoryStorageWithConfig_Invalid(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	configs := map[string]config.StorageConfig{
+		"negative max entries":       {MemoryMaxEntries: -1},
+		"negative max bytes":         {MemoryMaxBytes: -1},
+		"negative cleanup interval":  {MemoryCleanupInterval: -time.Second},
+		"negative snapshot interval": {MemorySnapshotInterval: -time.Second},
+		"unknown eviction policy":    {MemoryEviction: "fifo"},
+		"invalid key namespace":      {Namespace: "{prod}"},
+	}
+
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewMemoryStorageWithConfig(cfg, nil, nil, logger); err == nil {
+				t.Error("Expected error for invalid memory storage configuration")
+			}
+		})
+	}
+}
@@ -2,9 +2,10 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -12,10 +13,23 @@ import (
 	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
 )
 
+// Redis deployment modes selected by config.StorageConfig.RedisMode
+const (
+	// RedisModeSingle connects to a single Redis node
+	RedisModeSingle = "single"
+	// RedisModeSentinel connects to the primary of a Sentinel-managed group
+	RedisModeSentinel = "sentinel"
+	// RedisModeCluster connects to a Redis Cluster
+	RedisModeCluster = "cluster"
+)
+
 // RedisStorage implements Redis storage for distributed rate limiting
 // Suitable for multi-instance deployments
 type RedisStorage struct {
-	client *redis.Client
+	client redis.UniversalClient
+	codec  StateCodec
+	keys   KeyNamespace
+	tls    *tlsMonitor
 	logger *slog.Logger
 }
 
@@ -25,48 +39,160 @@ func NewRedisStorage(cfg config.StorageConfig, logger *slog.Logger) (*RedisStora
 		logger = slog.Default()
 	}
 
-	poolSize := cfg.RedisPoolSize
-	if poolSize == 0 {
-		poolSize = 10
+	codec, err := NewStateCodec(cfg.StateCodec)
+	if err != nil {
+		return nil, err
 	}
-	minIdle := cfg.RedisMinIdle
-	if minIdle == 0 {
-		minIdle = 5
+	keys, err := configuredKeyNamespace(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	client := redis.NewClient(&redis.Options{
-		Addr:         cfg.RedisAddress,
-		Password:     cfg.RedisPassword,
-		DB:           cfg.RedisDB,
-		PoolSize:     poolSize,        // Connection pool size
-		MinIdleConns: minIdle,         // Minimum idle connections
-		MaxRetries:   3,               // Retry failed commands
-		DialTimeout:  5 * time.Second, // Connection timeout
-		ReadTimeout:  3 * time.Second, // Read timeout
-		WriteTimeout: 3 * time.Second, // Write timeout
-		PoolTimeout:  4 * time.Second, // Pool timeout
-	})
+	monitor := &tlsMonitor{}
+	tlsConfig, err := newRedisTLSConfig(cfg, monitor)
+	if err != nil {
+		logger.Error("Invalid Redis TLS configuration", "error", err)
+		return nil, err
+	}
+
+	client, err := newRedisClient(cfg, tlsConfig)
+	if err != nil {
+		logger.Error("Invalid Redis configuration", "error", err, "mode", cfg.RedisMode)
+		return nil, err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// Test connection
 	if err := client.Ping(ctx).Err(); err != nil {
-		logger.Error("Failed to connect to Redis", "error", err, "address", cfg.RedisAddress)
+		client.Close()
+		logger.Error("Failed to connect to Redis", "error", err, "mode", cfg.RedisMode, "address", cfg.RedisAddress)
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	logger.Info("Connected to Redis", "address", cfg.RedisAddress, "db", cfg.RedisDB)
+	tlsState := monitor.TLSState()
+	logger.Info("Connected to Redis", "mode", cfg.RedisMode, "address", cfg.RedisAddress, "db", cfg.RedisDB,
+		"username", cfg.RedisUsername, "tls", tlsState.Enabled, "tls_version", tlsState.Version,
+		"state_codec", codec.Name(), "key_prefix", keys.Prefix())
 
 	return &RedisStorage{
 		client: client,
+		codec:  codec,
+		keys:   keys,
+		tls:    monitor,
 		logger: logger,
 	}, nil
 }
 
-// Get retrieves a value from Redis storage
+// newRedisClient creates the client for the configured deployment mode, tlsConfig is nil for plaintext
+func newRedisClient(cfg config.StorageConfig, tlsConfig *tls.Config) (redis.UniversalClient, error) {
+	poolSize := cfg.RedisPoolSize
+	if poolSize == 0 {
+		poolSize = 10
+	}
+	minIdle := cfg.RedisMinIdle
+	if minIdle == 0 {
+		minIdle = 5
+	}
+
+	switch cfg.RedisMode {
+	case "", RedisModeSingle:
+		return redis.NewClient(&redis.Options{
+			Addr:         cfg.RedisAddress,
+			Username:     cfg.RedisUsername,
+			Password:     cfg.RedisPassword,
+			DB:           cfg.RedisDB,
+			TLSConfig:    tlsConfig,
+			PoolSize:     poolSize,        // Connection pool size
+			MinIdleConns: minIdle,         // Minimum idle connections
+			MaxRetries:   3,               // Retry failed commands
+			DialTimeout:  5 * time.Second, // Connection timeout
+			ReadTimeout:  3 * time.Second, // Read timeout
+			WriteTimeout: 3 * time.Second, // Write timeout
+			PoolTimeout:  4 * time.Second, // Pool timeout
+		}), nil
+	case RedisModeSentinel:
+		if cfg.RedisSentinelMaster == "" {
+			return nil, fmt.Errorf("redis sentinel master name is required")
+		}
+		if len(cfg.RedisSentinelAddresses) == 0 {
+			return nil, fmt.Errorf("redis sentinel addresses are required")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.RedisSentinelMaster,
+			SentinelAddrs:    cfg.RedisSentinelAddresses,
+			SentinelUsername: cfg.RedisSentinelUsername,
+			SentinelPassword: cfg.RedisSentinelPassword,
+			Username:         cfg.RedisUsername,
+			Password:         cfg.RedisPassword,
+			DB:               cfg.RedisDB,
+			TLSConfig:        tlsConfig,
+			PoolSize:         poolSize,
+			MinIdleConns:     minIdle,
+			MaxRetries:       3,
+			DialTimeout:      5 * time.Second,
+			ReadTimeout:      3 * time.Second,
+			WriteTimeout:     3 * time.Second,
+			PoolTimeout:      4 * time.Second,
+		}), nil
+	case RedisModeCluster:
+		if cfg.RedisDB != 0 {
+			return nil, fmt.Errorf("redis cluster supports only database 0, got %d", cfg.RedisDB)
+		}
+		// Any reachable node is enough to discover the cluster
+		addrs := cfg.RedisClusterAddresses
+		if len(addrs) == 0 && cfg.RedisAddress != "" {
+			addrs = []string{cfg.RedisAddress}
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("redis cluster addresses are required")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        addrs,
+			Username:     cfg.RedisUsername,
+			Password:     cfg.RedisPassword,
+			TLSConfig:    tlsConfig,
+			PoolSize:     poolSize,
+			MinIdleConns: minIdle,
+			MaxRetries:   3,
+			DialTimeout:  5 * time.Second,
+			ReadTimeout:  3 * time.Second,
+			WriteTimeout: 3 * time.Second,
+			PoolTimeout:  4 * time.Second,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unsupported redis mode: %s", cfg.RedisMode)
+	}
+}
+
+// HashTag wraps key in a Redis Cluster hash tag, so that every Redis key derived from it,
+// e.g. ReservedKeyPrefix + "concurrency:" + HashTag(key), is stored in the same slot as the key itself
+func HashTag(key string) string {
+	return "{" + key + "}"
+}
+
+// redisKey returns the Redis key for a storage key.
+// Keys already carrying a hash tag are used as is, all others become their own hash tag,
+// so that multi-key operations for one limiter key stay on a single cluster slot.
+func redisKey(key string) string {
+	if open := strings.IndexByte(key, '{'); open >= 0 {
+		if end := strings.IndexByte(key[open+1:], '}'); end > 0 {
+			return key
+		}
+	}
+	return HashTag(key)
+}
+
+// key returns the Redis key for a storage key inside the namespace of the storage.
+// The namespace stays outside the hash tag, so it does not change the cluster slot.
+func (r *RedisStorage) key(key string) string {
+	return r.keys.Key(redisKey(key))
+}
+
+// Get retrieves a value from Redis storage as the stored string, see DecodeState
 func (r *RedisStorage) Get(ctx context.Context, key string) (interface{}, error) {
-	val, err := r.client.Get(ctx, key).Result()
+	val, err := r.client.Get(ctx, r.key(key)).Result()
 	if err == redis.Nil {
 		r.logger.Debug("Key not found in Redis", "key", key)
 		return nil, nil
@@ -76,39 +202,19 @@ func (r *RedisStorage) Get(ctx context.Context, key string) (interface{}, error)
 		return nil, fmt.Errorf("failed to get value from Redis: %w", err)
 	}
 
-	// Try to unmarshal as JSON, if fails return as string
-	var result interface{}
-	if err := json.Unmarshal([]byte(val), &result); err != nil {
-		return val, nil
-	}
-	return result, nil
+	return val, nil
 }
 
 // Set stores a value in Redis storage with optional expiration
 func (r *RedisStorage) Set(ctx context.Context, key string, value interface{}, expiration int64) error {
-	// Marshal value to JSON if it's not a string
-	var val string
-	switch v := value.(type) {
-	case string:
-		val = v
-	default:
-		data, err := json.Marshal(value)
-		if err != nil {
-			r.logger.Error("Failed to marshal value", "key", key, "error", err)
-			return fmt.Errorf("failed to marshal value: %w", err)
-		}
-		val = string(data)
-	}
-
-	var expirationDuration time.Duration
-	if expiration > 0 {
-		expirationDuration = time.Until(time.Unix(expiration, 0))
-		if expirationDuration < 0 {
-			expirationDuration = 0
-		}
+	val, err := r.codec.Encode(value)
+	if err != nil {
+		r.logger.Error("Failed to marshal value", "key", key, "error", err)
+		return err
 	}
 
-	err := r.client.Set(ctx, key, val, expirationDuration).Err()
+	expirationDuration := redisExpiration(expiration)
+	err = r.client.Set(ctx, r.key(key), val, expirationDuration).Err()
 	if err != nil {
 		r.logger.Error("Failed to set value in Redis", "key", key, "error", err)
 		return fmt.Errorf("failed to set value in Redis: %w", err)
@@ -120,7 +226,7 @@ func (r *RedisStorage) Set(ctx context.Context, key string, value interface{}, e
 
 // Delete removes a value from Redis storage
 func (r *RedisStorage) Delete(ctx context.Context, key string) error {
-	err := r.client.Del(ctx, key).Err()
+	err := r.client.Del(ctx, r.key(key)).Err()
 	if err != nil {
 		r.logger.Error("Failed to delete value from Redis", "key", key, "error", err)
 		return fmt.Errorf("failed to delete value from Redis: %w", err)
@@ -130,6 +236,60 @@ func (r *RedisStorage) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+// Update atomically replaces a value in Redis storage using an optimistic WATCH/MULTI transaction.
+// The transaction is retried when the key is modified concurrently.
+func (r *RedisStorage) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	storedKey := r.key(key)
+	txf := func(tx *redis.Tx) error {
+		var current interface{}
+		val, err := tx.Get(ctx, storedKey).Result()
+		switch {
+		case err == redis.Nil:
+		case err != nil:
+			return fmt.Errorf("failed to get value from Redis: %w", err)
+		default:
+			current = val
+		}
+
+		value, expiration, err := fn(current)
+		if err != nil {
+			return err
+		}
+
+		newVal, err := r.codec.Encode(value)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, storedKey, newVal, redisExpiration(expiration))
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < redisUpdateMaxRetries; attempt++ {
+		err := r.client.Watch(ctx, txf, storedKey)
+		if err == nil {
+			r.logger.Debug("Value updated in Redis", "key", key, "attempts", attempt+1)
+			return nil
+		}
+		if err != redis.TxFailedErr {
+			r.logger.Error("Failed to update value in Redis", "key", key, "error", err)
+			return fmt.Errorf("failed to update value in Redis: %w", err)
+		}
+		// Optimistic lock lost, retry with fresh state
+	}
+
+	r.logger.Warn("Update retries exhausted", "key", key, "retries", redisUpdateMaxRetries)
+	return ErrUpdateConflict
+}
+
+// TLSState returns the TLS state negotiated on the last connection to Redis
+func (r *RedisStorage) TLSState() TLSState {
+	return r.tls.TLSState()
+}
+
 // Close closes the Redis connection
 func (r *RedisStorage) Close() error {
 	if err := r.client.Close(); err != nil {
@@ -139,3 +299,19 @@ func (r *RedisStorage) Close() error {
 	r.logger.Info("Redis connection closed")
 	return nil
 }
+
+// redisUpdateMaxRetries bounds the optimistic transaction retries of Update
+const redisUpdateMaxRetries = 1000
+
+// redisExpiration converts a Unix timestamp expiration into a TTL, 0 means no expiration
+func redisExpiration(expiration int64) time.Duration {
+	if expiration <= 0 {
+		return 0
+	}
+	ttl := time.Until(time.Unix(expiration, 0))
+	if ttl < time.Millisecond {
+		// Already expired: keep the value only for the shortest TTL Redis accepts
+		ttl = time.Millisecond
+	}
+	return ttl
+}
@@ -0,0 +1,652 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// tokenBucketScript evaluates the Token Bucket algorithm atomically.
+// State is kept in a hash with fractional "tokens" and "last_refill" (Unix nanoseconds) fields.
+//
+// KEYS[1] - bucket key
+// ARGV[1] - bucket capacity (burst)
+// ARGV[2] - time to refill one token in nanoseconds
+// ARGV[3] - current time in Unix nanoseconds
+// ARGV[4] - number of tokens the request consumes (cost), at least 1
+//
+// Returns {allowed, tokens, last_refill}: allowed is 1 if the request is allowed, 0 otherwise,
+// tokens and last_refill are the bucket state after evaluation.
+// The key expires once the bucket would be full again.
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+if not cost or cost < 1 then
+	return redis.error_reply('ERR invalid cost')
+end
+
+local key_type = redis.call('TYPE', key)['ok']
+if key_type ~= 'none' and key_type ~= 'hash' then
+	redis.call('DEL', key)
+end
+
+local state = redis.call('HMGET', key, 'tokens', 'last_refill')
+local tokens = tonumber(state[1])
+local last_refill = state[2]
+
+if not tokens or not last_refill then
+	tokens = burst
+	last_refill = ARGV[3]
+else
+	local elapsed = now - tonumber(last_refill)
+	if elapsed > 0 then
+		tokens = math.min(tokens + elapsed / interval, burst)
+		last_refill = ARGV[3]
+	end
+end
+
+-- Refills adding up to a whole token may fall short of it by floating point error
+local allowed = 0
+if tokens + 1e-9 >= cost then
+	tokens = math.max(tokens - cost, 0)
+	allowed = 1
+end
+
+-- Lua numbers are truncated to integers in replies, fractional tokens travel as strings
+local tokens_str = string.format('%.17g', tokens)
+redis.call('HSET', key, 'tokens', tokens_str, 'last_refill', last_refill)
+redis.call('PEXPIRE', key, math.max(math.ceil((burst - tokens) * interval / 1000000), 1))
+return {allowed, tokens_str, last_refill}
+`)
+
+// slidingWindowScript evaluates the Sliding Window Log algorithm atomically.
+// State is kept in a sorted set of request members scored by Unix nanoseconds.
+//
+// KEYS[1] - log key
+// ARGV[1] - maximum number of requests in the window (limit)
+// ARGV[2] - window start in Unix nanoseconds (inclusive)
+// ARGV[3] - current time in Unix nanoseconds
+// ARGV[4] - unique member prefix for the current request
+// ARGV[5] - key TTL in milliseconds
+// ARGV[6] - number of log entries the request takes (cost), at least 1
+//
+// Returns {allowed, count, newest, blocking}: allowed is 1 if the request is allowed, 0 otherwise,
+// count is the number of entries in the window after evaluation, newest is the score of the latest
+// entry and blocking the score of the entry that has to leave the window before a denied request
+// fits, both "0" if there is no such entry.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local cost = tonumber(ARGV[6])
+if not cost or cost < 1 then
+	return redis.error_reply('ERR invalid cost')
+end
+
+local key_type = redis.call('TYPE', key)['ok']
+if key_type ~= 'none' and key_type ~= 'zset' then
+	redis.call('DEL', key)
+end
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', '(' .. ARGV[2])
+
+local allowed = 0
+if redis.call('ZCARD', key) + cost <= limit then
+	for i = 1, cost do
+		redis.call('ZADD', key, ARGV[3], ARGV[4] .. '-' .. i)
+	end
+	allowed = 1
+end
+
+local count = redis.call('ZCARD', key)
+local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')[2] or '0'
+local blocking = '0'
+local needed = count + cost - limit
+if allowed == 0 and needed <= count then
+	blocking = redis.call('ZRANGE', key, needed - 1, needed - 1, 'WITHSCORES')[2]
+end
+
+redis.call('PEXPIRE', key, ARGV[5])
+return {allowed, count, newest, blocking}
+`)
+
+// fixedWindowScript evaluates the Fixed Window Counter algorithm atomically.
+// State is kept in a hash with "window_start" (Unix nanoseconds) and "count" fields.
+//
+// KEYS[1] - counter key
+// ARGV[1] - maximum number of requests in the window (limit)
+// ARGV[2] - current window start in Unix nanoseconds
+// ARGV[3] - expiration as Unix timestamp in milliseconds
+// ARGV[4] - number of requests the request counts as (cost), at least 1
+//
+// Returns {allowed, count}: allowed is 1 if the request is allowed, 0 otherwise,
+// count is the window counter after evaluation.
+var fixedWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local cost = tonumber(ARGV[4])
+if not cost or cost < 1 then
+	return redis.error_reply('ERR invalid cost')
+end
+
+local key_type = redis.call('TYPE', key)['ok']
+if key_type ~= 'none' and key_type ~= 'hash' then
+	redis.call('DEL', key)
+end
+
+local count = 0
+if redis.call('HGET', key, 'window_start') == ARGV[2] then
+	count = tonumber(redis.call('HGET', key, 'count')) or 0
+end
+
+local allowed = 0
+if count + cost <= limit then
+	count = count + cost
+	allowed = 1
+end
+
+redis.call('HSET', key, 'window_start', ARGV[2], 'count', count)
+redis.call('PEXPIREAT', key, ARGV[3])
+return {allowed, count}
+`)
+
+// slidingWindowCounterScript evaluates the Sliding Window Counter algorithm atomically.
+// State is kept in a hash with "window_start" (Unix nanoseconds), "current" and "previous" fields.
+//
+// KEYS[1] - counter key
+// ARGV[1] - maximum number of requests in the sliding window (limit)
+// ARGV[2] - current window start in Unix nanoseconds
+// ARGV[3] - previous window start in Unix nanoseconds
+// ARGV[4] - weight of the previous window count
+// ARGV[5] - expiration as Unix timestamp in milliseconds
+// ARGV[6] - number of requests the request counts as (cost), at least 1
+//
+// Returns {allowed, current, previous}: allowed is 1 if the request is allowed, 0 otherwise,
+// current and previous are the window counters after evaluation.
+var slidingWindowCounterScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[4])
+local cost = tonumber(ARGV[6])
+if not cost or cost < 1 then
+	return redis.error_reply('ERR invalid cost')
+end
+
+local key_type = redis.call('TYPE', key)['ok']
+if key_type ~= 'none' and key_type ~= 'hash' then
+	redis.call('DEL', key)
+end
+
+local state = redis.call('HMGET', key, 'window_start', 'current', 'previous')
+local current = 0
+local previous = 0
+if state[1] == ARGV[2] then
+	current = tonumber(state[2]) or 0
+	previous = tonumber(state[3]) or 0
+elseif state[1] == ARGV[3] then
+	previous = tonumber(state[2]) or 0
+end
+
+local allowed = 0
+if previous * weight + current + cost - 1 < limit then
+	current = current + cost
+	allowed = 1
+end
+
+redis.call('HSET', key, 'window_start', ARGV[2], 'current', current, 'previous', previous)
+redis.call('PEXPIREAT', key, ARGV[5])
+return {allowed, current, previous}
+`)
+
+// gcraScript evaluates the Generic Cell Rate Algorithm atomically.
+// State is kept in a plain string holding the theoretical arrival time (TAT) in Unix microseconds.
+// Microseconds keep current timestamps exactly representable as Lua numbers.
+//
+// KEYS[1] - TAT key
+// ARGV[1] - emission interval in microseconds
+// ARGV[2] - burst offset in microseconds
+// ARGV[3] - current time in Unix microseconds
+// ARGV[4] - number of emission intervals the request takes (cost), at least 1
+//
+// Returns {allowed, tat}: allowed is 1 if the request is allowed, 0 otherwise,
+// tat is the TAT after evaluation in Unix microseconds.
+var gcraScript = redis.NewScript(`
+local key = KEYS[1]
+local interval = tonumber(ARGV[1])
+local burst_offset = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+if not cost or cost < 1 then
+	return redis.error_reply('ERR invalid cost')
+end
+
+local key_type = redis.call('TYPE', key)['ok']
+if key_type ~= 'none' and key_type ~= 'string' then
+	redis.call('DEL', key)
+end
+
+local tat = tonumber(redis.call('GET', key)) or now
+if tat < now then
+	tat = now
+end
+
+local allowed = 0
+local new_tat = tat + interval * cost
+if new_tat - burst_offset <= now then
+	tat = new_tat
+	allowed = 1
+	local ttl = math.max(1, math.ceil((tat - now) / 1000))
+	redis.call('SET', key, string.format('%.3f', tat), 'PX', ttl)
+end
+
+return {allowed, string.format('%.3f', tat)}
+`)
+
+// leakyBucketScript evaluates the Leaky Bucket queue atomically.
+// State is kept in a plain string holding the departure time of the next queued request
+// in Unix microseconds.
+//
+// KEYS[1] - queue key
+// ARGV[1] - drain interval in microseconds
+// ARGV[2] - queue capacity
+// ARGV[3] - current time in Unix microseconds
+// ARGV[4] - number of queue places the request takes (cost), at least 1
+//
+// Returns {allowed, departure}: allowed is 1 if the request is queued, 0 otherwise,
+// departure is the time in Unix microseconds at which the queue will have drained.
+var leakyBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local interval = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+if not cost or cost < 1 then
+	return redis.error_reply('ERR invalid cost')
+end
+
+local key_type = redis.call('TYPE', key)['ok']
+if key_type ~= 'none' and key_type ~= 'string' then
+	redis.call('DEL', key)
+end
+
+local departure = tonumber(redis.call('GET', key)) or now
+if departure < now then
+	departure = now
+end
+
+if departure - now > interval * (capacity - cost) then
+	return {0, string.format('%.3f', departure)}
+end
+
+local next_departure = departure + interval * cost
+local ttl = math.max(1, math.ceil((next_departure - now) / 1000))
+redis.call('SET', key, string.format('%.3f', next_departure), 'PX', ttl)
+return {1, string.format('%.3f', next_departure)}
+`)
+
+// acquireLeaseScript acquires a concurrency lease atomically.
+// State is kept in a sorted set of lease IDs scored by their expiration in Unix milliseconds.
+//
+// KEYS[1] - lease set key
+// ARGV[1] - maximum number of leases held at once (limit)
+// ARGV[2] - lease ID
+// ARGV[3] - lease expiration in Unix milliseconds
+// ARGV[4] - current time in Unix milliseconds
+//
+// Returns 1 if the lease is acquired, 0 otherwise.
+var acquireLeaseScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+
+local key_type = redis.call('TYPE', key)['ok']
+if key_type ~= 'none' and key_type ~= 'zset' then
+	redis.call('DEL', key)
+end
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', ARGV[4])
+
+if redis.call('ZCARD', key) >= limit then
+	return 0
+end
+
+redis.call('ZADD', key, ARGV[3], ARGV[2])
+local last = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+redis.call('PEXPIREAT', key, last[2])
+return 1
+`)
+
+// releaseLeaseScript releases a concurrency lease atomically.
+//
+// KEYS[1] - lease set key
+// ARGV[1] - lease ID
+// ARGV[2] - current time in Unix milliseconds
+//
+// Returns 1 if the lease was held, 0 if it is unknown or has expired.
+var releaseLeaseScript = redis.NewScript(`
+local key = KEYS[1]
+
+if redis.call('TYPE', key)['ok'] ~= 'zset' then
+	return 0
+end
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', ARGV[2])
+return redis.call('ZREM', key, ARGV[1])
+`)
+
+// EvalTokenBucket evaluates the Token Bucket algorithm for key in a single Lua script
+func (r *RedisStorage) EvalTokenBucket(
+	ctx context.Context,
+	key string,
+	limit int,
+	window time.Duration,
+	burst int,
+	cost int,
+	now time.Time,
+) (bool, float64, int64, error) {
+	if err := validateCost(cost); err != nil {
+		return false, 0, 0, err
+	}
+	tokenInterval := float64(window) / float64(limit)
+	result, err := tokenBucketScript.Run(ctx, r.client, []string{r.key(key)},
+		burst,
+		strconv.FormatFloat(tokenInterval, 'f', -1, 64),
+		now.UnixNano(),
+		cost,
+	).Slice()
+	if err != nil {
+		r.logger.Error("Failed to evaluate token bucket in Redis", "key", key, "error", err)
+		return false, 0, 0, fmt.Errorf("failed to evaluate token bucket in Redis: %w", err)
+	}
+
+	allowed, ok := result[0].(int64)
+	tokensStr, ok2 := result[1].(string)
+	lastRefillStr, ok3 := result[2].(string)
+	if !ok || !ok2 || !ok3 {
+		return false, 0, 0, fmt.Errorf("unexpected token bucket script result: %v", result)
+	}
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("invalid tokens returned by token bucket script: %w", err)
+	}
+	lastRefill, err := strconv.ParseInt(lastRefillStr, 10, 64)
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("invalid last refill returned by token bucket script: %w", err)
+	}
+
+	return allowed == 1, tokens, lastRefill, nil
+}
+
+// EvalSlidingWindow evaluates the Sliding Window Log algorithm for key in a single Lua script
+func (r *RedisStorage) EvalSlidingWindow(
+	ctx context.Context,
+	key string,
+	limit int,
+	window time.Duration,
+	cost int,
+	now time.Time,
+) (bool, int, int64, int64, error) {
+	if err := validateCost(cost); err != nil {
+		return false, 0, 0, 0, err
+	}
+	// Members must be unique across replicas, otherwise two requests
+	// recorded at the same nanosecond would collapse into one entry.
+	member := strconv.FormatInt(now.UnixNano(), 10) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+
+	result, err := slidingWindowScript.Run(ctx, r.client, []string{r.key(key)},
+		limit,
+		now.Add(-window).UnixNano(),
+		now.UnixNano(),
+		member,
+		ttlMilliseconds(window),
+		cost,
+	).Slice()
+	if err != nil {
+		r.logger.Error("Failed to evaluate sliding window in Redis", "key", key, "error", err)
+		return false, 0, 0, 0, fmt.Errorf("failed to evaluate sliding window in Redis: %w", err)
+	}
+
+	allowed, ok := result[0].(int64)
+	count, ok2 := result[1].(int64)
+	newestStr, ok3 := result[2].(string)
+	blockingStr, ok4 := result[3].(string)
+	if !ok || !ok2 || !ok3 || !ok4 {
+		return false, 0, 0, 0, fmt.Errorf("unexpected sliding window script result: %v", result)
+	}
+	// Scores are doubles, precise enough to tell when an entry leaves the window
+	newest, err := strconv.ParseFloat(newestStr, 64)
+	if err != nil {
+		return false, 0, 0, 0, fmt.Errorf("invalid newest entry returned by sliding window script: %w", err)
+	}
+	blocking, err := strconv.ParseFloat(blockingStr, 64)
+	if err != nil {
+		return false, 0, 0, 0, fmt.Errorf("invalid blocking entry returned by sliding window script: %w", err)
+	}
+
+	return allowed == 1, int(count), int64(newest), int64(blocking), nil
+}
+
+// EvalFixedWindow evaluates the Fixed Window Counter algorithm for key in a single Lua script
+func (r *RedisStorage) EvalFixedWindow(
+	ctx context.Context,
+	key string,
+	limit int,
+	cost int,
+	windowStart int64,
+	expireAt time.Time,
+) (bool, int, error) {
+	if err := validateCost(cost); err != nil {
+		return false, 0, err
+	}
+	result, err := fixedWindowScript.Run(ctx, r.client, []string{r.key(key)},
+		limit,
+		windowStart,
+		expireAt.UnixMilli(),
+		cost,
+	).Int64Slice()
+	if err != nil {
+		r.logger.Error("Failed to evaluate fixed window in Redis", "key", key, "error", err)
+		return false, 0, fmt.Errorf("failed to evaluate fixed window in Redis: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected fixed window script result: %v", result)
+	}
+
+	return result[0] == 1, int(result[1]), nil
+}
+
+// EvalSlidingWindowCounter evaluates the Sliding Window Counter algorithm for key in a single Lua script
+func (r *RedisStorage) EvalSlidingWindowCounter(
+	ctx context.Context,
+	key string,
+	limit int,
+	cost int,
+	windowStart int64,
+	window int64,
+	previousWeight float64,
+	expireAt time.Time,
+) (bool, int, int, error) {
+	if err := validateCost(cost); err != nil {
+		return false, 0, 0, err
+	}
+	result, err := slidingWindowCounterScript.Run(ctx, r.client, []string{r.key(key)},
+		limit,
+		windowStart,
+		windowStart-window,
+		strconv.FormatFloat(previousWeight, 'f', -1, 64),
+		expireAt.UnixMilli(),
+		cost,
+	).Int64Slice()
+	if err != nil {
+		r.logger.Error("Failed to evaluate sliding window counter in Redis", "key", key, "error", err)
+		return false, 0, 0, fmt.Errorf("failed to evaluate sliding window counter in Redis: %w", err)
+	}
+	if len(result) != 3 {
+		return false, 0, 0, fmt.Errorf("unexpected sliding window counter script result: %v", result)
+	}
+
+	return result[0] == 1, int(result[1]), int(result[2]), nil
+}
+
+// EvalGCRA evaluates the Generic Cell Rate Algorithm for key in a single Lua script
+func (r *RedisStorage) EvalGCRA(
+	ctx context.Context,
+	key string,
+	emissionInterval time.Duration,
+	burstOffset time.Duration,
+	cost int,
+	now time.Time,
+) (bool, int64, error) {
+	if err := validateCost(cost); err != nil {
+		return false, 0, err
+	}
+	result, err := gcraScript.Run(ctx, r.client, []string{r.key(key)},
+		microseconds(emissionInterval),
+		microseconds(burstOffset),
+		now.UnixMicro(),
+		cost,
+	).Slice()
+	if err != nil {
+		r.logger.Error("Failed to evaluate GCRA in Redis", "key", key, "error", err)
+		return false, 0, fmt.Errorf("failed to evaluate GCRA in Redis: %w", err)
+	}
+
+	allowed, ok := result[0].(int64)
+	tatStr, ok2 := result[1].(string)
+	if !ok || !ok2 {
+		return false, 0, fmt.Errorf("unexpected GCRA script result: %v", result)
+	}
+	tat, err := parseMicroseconds(tatStr)
+	if err != nil {
+		return false, 0, fmt.Errorf("invalid TAT returned by GCRA script: %w", err)
+	}
+
+	return allowed == 1, tat, nil
+}
+
+// EvalLeakyBucket evaluates the Leaky Bucket queue for key in a single Lua script
+func (r *RedisStorage) EvalLeakyBucket(
+	ctx context.Context,
+	key string,
+	drainInterval time.Duration,
+	capacity int,
+	cost int,
+	now time.Time,
+) (bool, int64, error) {
+	if err := validateCost(cost); err != nil {
+		return false, 0, err
+	}
+	result, err := leakyBucketScript.Run(ctx, r.client, []string{r.key(key)},
+		microseconds(drainInterval),
+		capacity,
+		now.UnixMicro(),
+		cost,
+	).Slice()
+	if err != nil {
+		r.logger.Error("Failed to evaluate leaky bucket in Redis", "key", key, "error", err)
+		return false, 0, fmt.Errorf("failed to evaluate leaky bucket in Redis: %w", err)
+	}
+
+	allowed, ok := result[0].(int64)
+	departureStr, ok2 := result[1].(string)
+	if !ok || !ok2 {
+		return false, 0, fmt.Errorf("unexpected leaky bucket script result: %v", result)
+	}
+	departure, err := parseMicroseconds(departureStr)
+	if err != nil {
+		return false, 0, fmt.Errorf("invalid departure returned by leaky bucket script: %w", err)
+	}
+
+	return allowed == 1, departure, nil
+}
+
+// EvalAcquireLease acquires a concurrency lease for key in a single Lua script
+func (r *RedisStorage) EvalAcquireLease(
+	ctx context.Context,
+	key string,
+	leaseID string,
+	limit int,
+	expireAt time.Time,
+	now time.Time,
+) (bool, error) {
+	result, err := acquireLeaseScript.Run(ctx, r.client, []string{r.key(key)},
+		limit,
+		leaseID,
+		expireAt.UnixMilli(),
+		now.UnixMilli(),
+	).Int64()
+	if err != nil {
+		r.logger.Error("Failed to acquire lease in Redis", "key", key, "error", err)
+		return false, fmt.Errorf("failed to acquire lease in Redis: %w", err)
+	}
+
+	return result == 1, nil
+}
+
+// EvalReleaseLease releases a concurrency lease for key in a single Lua script
+func (r *RedisStorage) EvalReleaseLease(ctx context.Context, key string, leaseID string, now time.Time) (bool, error) {
+	result, err := releaseLeaseScript.Run(ctx, r.client, []string{r.key(key)},
+		leaseID,
+		now.UnixMilli(),
+	).Int64()
+	if err != nil {
+		r.logger.Error("Failed to release lease in Redis", "key", key, "error", err)
+		return false, fmt.Errorf("failed to release lease in Redis: %w", err)
+	}
+
+	return result == 1, nil
+}
+
+// microseconds formats a duration as a possibly fractional number of microseconds
+func microseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Microsecond), 'f', -1, 64)
+}
+
+// parseMicroseconds converts microseconds formatted with %.3f by a script into nanoseconds.
+// Parsing the digits keeps current timestamps exact, a float64 would round them to 256ns.
+func parseMicroseconds(s string) (int64, error) {
+	whole, fraction, _ := strings.Cut(s, ".")
+	if len(fraction) > 3 {
+		return 0, fmt.Errorf("more than nanosecond precision: %s", s)
+	}
+	micros, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	nanos := int64(0)
+	if fraction != "" {
+		if nanos, err = strconv.ParseInt(fraction+strings.Repeat("0", 3-len(fraction)), 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	if strings.HasPrefix(whole, "-") {
+		nanos = -nanos
+	}
+	return micros*1000 + nanos, nil
+}
+
+// ttlMilliseconds converts a window into a key TTL, rounding up to a whole millisecond
+func ttlMilliseconds(window time.Duration) int64 {
+	ms := int64((window + time.Millisecond - 1) / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	return ms
+}
+
+// Ensure RedisStorage implements the server-side evaluators
+var (
+	_ TokenBucketEvaluator          = (*RedisStorage)(nil)
+	_ SlidingWindowEvaluator        = (*RedisStorage)(nil)
+	_ FixedWindowEvaluator          = (*RedisStorage)(nil)
+	_ SlidingWindowCounterEvaluator = (*RedisStorage)(nil)
+	_ GCRAEvaluator                 = (*RedisStorage)(nil)
+	_ LeakyBucketEvaluator          = (*RedisStorage)(nil)
+	_ LeaseEvaluator                = (*RedisStorage)(nil)
+)
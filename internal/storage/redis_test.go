@@ -0,0 +1,436 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+func newTestRedisStorage(t *testing.T) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	mr := miniredis.RunT(t)
+
+	storage, err := NewRedisStorage(config.StorageConfig{RedisAddress: mr.Addr()}, logger)
+	if err != nil {
+		t.Fatalf("NewRedisStorage failed: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	return storage, mr
+}
+
+func TestRedisStorage_EvalTokenBucket(t *testing.T) {
+	storage, mr := newTestRedisStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		allowed, _, _, err := storage.EvalTokenBucket(ctx, "bucket", 3, time.Minute, 3, 1, now)
+		if err != nil {
+			t.Fatalf("EvalTokenBucket failed: %v", err)
+		}
+		if !allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+
+	allowed, tokens, lastRefill, err := storage.EvalTokenBucket(ctx, "bucket", 3, time.Minute, 3, 1, now)
+	if err != nil {
+		t.Fatalf("EvalTokenBucket failed: %v", err)
+	}
+	if allowed {
+		t.Error("4th request should be denied")
+	}
+	if tokens != 0 || lastRefill != now.UnixNano() {
+		t.Errorf("Expected 0 tokens refilled at %d, got %v at %d", now.UnixNano(), tokens, lastRefill)
+	}
+
+	// State must be stored as a native hash
+	if keyType := mr.Type("{bucket}"); keyType != "hash" {
+		t.Errorf("Expected hash, got %s", keyType)
+	}
+	if tokens := mr.HGet("{bucket}", "tokens"); tokens != "0" {
+		t.Errorf("Expected 0 tokens, got %s", tokens)
+	}
+	if ttl := mr.TTL("{bucket}"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected TTL within window, got %v", ttl)
+	}
+
+	// One token is refilled after window/limit
+	allowed, _, _, err = storage.EvalTokenBucket(ctx, "bucket", 3, time.Minute, 3, 1, now.Add(20*time.Second))
+	if err != nil {
+		t.Fatalf("EvalTokenBucket failed: %v", err)
+	}
+	if !allowed {
+		t.Error("Request should be allowed after refill")
+	}
+}
+
+func TestRedisStorage_EvalSlidingWindow(t *testing.T) {
+	storage, mr := newTestRedisStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		allowed, _, _, _, err := storage.EvalSlidingWindow(ctx, "log", 3, time.Second, 1, now)
+		if err != nil {
+			t.Fatalf("EvalSlidingWindow failed: %v", err)
+		}
+		if !allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+
+	allowed, count, newest, blocking, err := storage.EvalSlidingWindow(ctx, "log", 3, time.Second, 1, now)
+	if err != nil {
+		t.Fatalf("EvalSlidingWindow failed: %v", err)
+	}
+	if allowed {
+		t.Error("4th request should be denied")
+	}
+	if count != 3 {
+		t.Errorf("Expected count 3, got %d", count)
+	}
+	// Sorted set scores are doubles, nanosecond timestamps come back rounded
+	if d := time.Duration(newest - now.UnixNano()).Abs(); d > time.Microsecond {
+		t.Errorf("Expected newest entry at %d, got %d", now.UnixNano(), newest)
+	}
+	if d := time.Duration(blocking - now.UnixNano()).Abs(); d > time.Microsecond {
+		t.Errorf("Expected blocking entry at %d, got %d", now.UnixNano(), blocking)
+	}
+
+	// State must be stored as a native sorted set with one member per allowed request
+	if keyType := mr.Type("{log}"); keyType != "zset" {
+		t.Errorf("Expected zset, got %s", keyType)
+	}
+	members, err := mr.ZMembers("{log}")
+	if err != nil {
+		t.Fatalf("ZMembers failed: %v", err)
+	}
+	if len(members) != 3 {
+		t.Errorf("Expected 3 members, got %d", len(members))
+	}
+
+	// Old entries are trimmed once the window slides
+	allowed, _, _, _, err = storage.EvalSlidingWindow(ctx, "log", 3, time.Second, 1, now.Add(1100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("EvalSlidingWindow failed: %v", err)
+	}
+	if !allowed {
+		t.Error("Request should be allowed after window slides")
+	}
+	members, _ = mr.ZMembers("{log}")
+	if len(members) != 1 {
+		t.Errorf("Expected 1 member after trimming, got %d", len(members))
+	}
+}
+
+func TestRedisStorage_EvalFixedWindow(t *testing.T) {
+	storage, mr := newTestRedisStorage(t)
+	ctx := context.Background()
+	windowStart := time.Now().Truncate(time.Minute)
+	expireAt := windowStart.Add(time.Minute)
+
+	for i := 0; i < 2; i++ {
+		allowed, _, err := storage.EvalFixedWindow(ctx, "counter", 2, 1, windowStart.UnixNano(), expireAt)
+		if err != nil {
+			t.Fatalf("EvalFixedWindow failed: %v", err)
+		}
+		if !allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+
+	allowed, count, err := storage.EvalFixedWindow(ctx, "counter", 2, 1, windowStart.UnixNano(), expireAt)
+	if err != nil {
+		t.Fatalf("EvalFixedWindow failed: %v", err)
+	}
+	if allowed {
+		t.Error("3rd request should be denied")
+	}
+	if count != 2 {
+		t.Errorf("Expected reported count 2, got %d", count)
+	}
+	if count := mr.HGet("{counter}", "count"); count != "2" {
+		t.Errorf("Expected count 2, got %s", count)
+	}
+
+	// The next window starts from scratch
+	next := windowStart.Add(time.Minute)
+	allowed, _, err = storage.EvalFixedWindow(ctx, "counter", 2, 1, next.UnixNano(), next.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("EvalFixedWindow failed: %v", err)
+	}
+	if !allowed {
+		t.Error("Request should be allowed in a new window")
+	}
+	if count := mr.HGet("{counter}", "count"); count != "1" {
+		t.Errorf("Expected count 1, got %s", count)
+	}
+}
+
+func TestRedisStorage_EvalResetsForeignState(t *testing.T) {
+	storage, mr := newTestRedisStorage(t)
+	ctx := context.Background()
+
+	// Legacy JSON state stored as a plain string must not break evaluation
+	if err := mr.Set("{legacy}", `{"tokens":0,"last_refill":0}`); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	allowed, _, _, err := storage.EvalTokenBucket(ctx, "legacy", 1, time.Minute, 1, 1, time.Now())
+	if err != nil {
+		t.Fatalf("EvalTokenBucket failed: %v", err)
+	}
+	if !allowed {
+		t.Error("Request should be allowed on a reset bucket")
+	}
+	if keyType := mr.Type("{legacy}"); keyType != "hash" {
+		t.Errorf("Expected hash, got %s", keyType)
+	}
+}
+
+func TestRedisStorage_EvalInvalidCost(t *testing.T) {
+	storage, mr := newTestRedisStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	evaluations := map[string]func(cost int) error{
+		"token_bucket": func(cost int) error {
+			_, _, _, err := storage.EvalTokenBucket(ctx, "key", 5, time.Minute, 5, cost, now)
+			return err
+		},
+		"sliding_window": func(cost int) error {
+			_, _, _, _, err := storage.EvalSlidingWindow(ctx, "key", 5, time.Minute, cost, now)
+			return err
+		},
+		"fixed_window": func(cost int) error {
+			_, _, err := storage.EvalFixedWindow(ctx, "key", 5, cost, now.UnixNano(), now.Add(time.Minute))
+			return err
+		},
+		"sliding_window_counter": func(cost int) error {
+			_, _, _, err := storage.EvalSlidingWindowCounter(ctx, "key", 5, cost, now.UnixNano(), int64(time.Minute), 0, now.Add(time.Minute))
+			return err
+		},
+		"gcra": func(cost int) error {
+			_, _, err := storage.EvalGCRA(ctx, "key", time.Second, time.Second, cost, now)
+			return err
+		},
+		"leaky_bucket": func(cost int) error {
+			_, _, err := storage.EvalLeakyBucket(ctx, "key", time.Second, 5, cost, now)
+			return err
+		},
+	}
+	for name, evaluate := range evaluations {
+		for _, cost := range []int{-10, 0} {
+			if err := evaluate(cost); !errors.Is(err, ErrInvalidCost) {
+				t.Errorf("%s: expected ErrInvalidCost for cost %d, got %v", name, cost, err)
+			}
+		}
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("Expected no state for rejected costs, got %v", keys)
+	}
+
+	// The scripts reject invalid costs on their own as well
+	if err := fixedWindowScript.Run(ctx, storage.client, []string{"{key}"}, 5, now.UnixNano(), now.Add(time.Minute).UnixMilli(), -10).Err(); err == nil {
+		t.Error("Expected the fixed window script to reject a negative cost")
+	}
+	if err := tokenBucketScript.Run(ctx, storage.client, []string{"{key}"}, 5, "1000", now.UnixNano(), -10).Err(); err == nil {
+		t.Error("Expected the token bucket script to reject a negative cost")
+	}
+}
+
+func TestRedisStorage_UpdateConcurrent(t *testing.T) {
+	storage, _ := newTestRedisStorage(t)
+	ctx := context.Background()
+
+	const goroutines = 20
+	const increments = 20
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				err := storage.Update(ctx, "counter", func(current interface{}) (interface{}, int64, error) {
+					// Values are returned as the stored string
+					count := 0
+					if current != nil {
+						count, _ = strconv.Atoi(current.(string))
+					}
+					return strconv.Itoa(count + 1), time.Now().Add(time.Minute).Unix(), nil
+				})
+				if err != nil {
+					t.Errorf("Update failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result, err := storage.Get(ctx, "counter")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if result != strconv.Itoa(goroutines*increments) {
+		t.Errorf("Expected %d, got %v", goroutines*increments, result)
+	}
+}
+
+func TestRedisStorage_HashTags(t *testing.T) {
+	storage, mr := newTestRedisStorage(t)
+	ctx := context.Background()
+
+	if err := storage.Set(ctx, "user:123", "state", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !mr.Exists("{user:123}") {
+		t.Error("Expected the key to be stored as its own hash tag")
+	}
+
+	// Derived keys pin themselves to the slot of the limiter key
+	derived := "concurrency:" + HashTag("user:123")
+	if err := storage.Set(ctx, derived, "leases", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !mr.Exists("concurrency:{user:123}") {
+		t.Error("Expected a hash tagged key to be stored as is")
+	}
+
+	value, err := storage.Get(ctx, derived)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if value != "leases" {
+		t.Errorf("Expected leases, got %v", value)
+	}
+
+	// Empty braces are not a hash tag
+	if key := redisKey("a{}b"); key != "{a{}b}" {
+		t.Errorf("Expected {a{}b}, got %s", key)
+	}
+}
+
+func TestRedisStorage_KeyNamespace(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+
+	// Two environments sharing one Redis database
+	var storages []*RedisStorage
+	for _, namespace := range []string{"prod", "staging"} {
+		storage, err := NewRedisStorage(config.StorageConfig{
+			RedisAddress: mr.Addr(),
+			KeyPrefix:    "rl",
+			Namespace:    namespace,
+		}, logger)
+		if err != nil {
+			t.Fatalf("NewRedisStorage failed: %v", err)
+		}
+		t.Cleanup(func() { storage.Close() })
+		storages = append(storages, storage)
+	}
+
+	if err := storages[0].Set(ctx, "user:123", "state", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	// The namespace stays outside the hash tag, so derived keys keep sharing a slot
+	if !mr.Exists("rl:prod:v1:{user:123}") {
+		t.Errorf("Expected the key to be namespaced, got keys %v", mr.Keys())
+	}
+	if value, _ := storages[1].Get(ctx, "user:123"); value != nil {
+		t.Errorf("Expected namespaces to be isolated, got %v", value)
+	}
+
+	if _, _, _, err := storages[1].EvalTokenBucket(ctx, "bucket", 1, time.Minute, 1, 1, time.Now()); err != nil {
+		t.Fatalf("EvalTokenBucket failed: %v", err)
+	}
+	if keyType := mr.Type("rl:staging:v1:{bucket}"); keyType != "hash" {
+		t.Errorf("Expected namespaced hash, got %q", keyType)
+	}
+
+	_, err := NewRedisStorage(config.StorageConfig{RedisAddress: mr.Addr(), Namespace: "{prod}"}, logger)
+	if err == nil {
+		t.Error("Expected error for a namespace with braces")
+	}
+}
+
+func TestNewRedisStorage_Cluster(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	mr := miniredis.RunT(t)
+
+	// miniredis serves all slots from a single node
+	storage, err := NewRedisStorage(config.StorageConfig{
+		RedisMode:             RedisModeCluster,
+		RedisClusterAddresses: []string{mr.Addr()},
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewRedisStorage failed: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	ctx := context.Background()
+	allowed, _, _, err := storage.EvalTokenBucket(ctx, "bucket", 1, time.Minute, 1, 1, time.Now())
+	if err != nil {
+		t.Fatalf("EvalTokenBucket failed: %v", err)
+	}
+	if !allowed {
+		t.Error("Request should be allowed")
+	}
+	if keyType := mr.Type("{bucket}"); keyType != "hash" {
+		t.Errorf("Expected hash, got %s", keyType)
+	}
+}
+
+func TestNewRedisStorage_InvalidMode(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	configs := map[string]config.StorageConfig{
+		"unknown mode":               {RedisMode: "replicated", RedisAddress: "localhost:6379"},
+		"sentinel without master":    {RedisMode: RedisModeSentinel, RedisSentinelAddresses: []string{"localhost:26379"}},
+		"sentinel without sentinels": {RedisMode: RedisModeSentinel, RedisSentinelMaster: "mymaster"},
+		"cluster with database":      {RedisMode: RedisModeCluster, RedisAddress: "localhost:6379", RedisDB: 1},
+	}
+
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewRedisStorage(cfg, logger); err == nil {
+				t.Error("Expected error for invalid Redis configuration")
+			}
+		})
+	}
+}
+
+func TestParseMicroseconds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"1760000000123456.789", 1760000000123456789},
+		{"1760000000123456.7", 1760000000123456700},
+		{"1760000000123456", 1760000000123456000},
+		{"-0.500", -500},
+	}
+
+	for _, tt := range tests {
+		if got, err := parseMicroseconds(tt.input); err != nil || got != tt.expected {
+			t.Errorf("parseMicroseconds(%q) = %d (%v), expected %d", tt.input, got, err, tt.expected)
+		}
+	}
+	if _, err := parseMicroseconds("1.2345"); err == nil {
+		t.Error("Expected error for sub-nanosecond precision")
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// TLSState describes the TLS session negotiated with a storage server
+type TLSState struct {
+	Enabled     bool   // Whether the storage connects over TLS
+	Version     string // Negotiated protocol version, e.g. "TLS 1.3", empty until a connection was made
+	CipherSuite string // Negotiated cipher suite
+	ServerName  string // Server name verified against the server certificate
+	ClientCert  bool   // Whether a client certificate is presented
+}
+
+// TLSReporter is implemented by storages connecting to a server, reporting the TLS state of the connections
+type TLSReporter interface {
+	// TLSState returns the state negotiated on the last connection
+	TLSState() TLSState
+}
+
+// ReportedTLSState returns the TLS state of s, or of the storage it wraps.
+// It reports false if the storage does not connect to a server.
+func ReportedTLSState(s Storage) (TLSState, bool) {
+	for s != nil {
+		if reporter, ok := s.(TLSReporter); ok {
+			return reporter.TLSState(), true
+		}
+		wrapper, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			break
+		}
+		s = wrapper.Unwrap()
+	}
+	return TLSState{}, false
+}
+
+// tlsMonitor records the state of the last TLS handshake of a client
+type tlsMonitor struct {
+	mu         sync.Mutex
+	enabled    bool
+	clientCert bool
+	state      *tls.ConnectionState
+}
+
+// record is installed as tls.Config.VerifyConnection, after the certificates were verified
+func (m *tlsMonitor) record(state tls.ConnectionState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = &state
+	return nil
+}
+
+// TLSState returns the state negotiated on the last connection
+func (m *tlsMonitor) TLSState() TLSState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := TLSState{Enabled: m.enabled, ClientCert: m.clientCert}
+	if m.state != nil {
+		state.Version = tls.VersionName(m.state.Version)
+		state.CipherSuite = tls.CipherSuiteName(m.state.CipherSuite)
+		state.ServerName = m.state.ServerName
+	}
+	return state
+}
+
+// newRedisTLSConfig builds the TLS configuration of the Redis connections, nil if TLS is disabled.
+// Every handshake is recorded by monitor.
+func newRedisTLSConfig(cfg config.StorageConfig, monitor *tlsMonitor) (*tls.Config, error) {
+	if !cfg.RedisTLS {
+		if cfg.RedisTLSCAFile != "" || cfg.RedisTLSCertFile != "" || cfg.RedisTLSKeyFile != "" {
+			return nil, fmt.Errorf("redis TLS files are configured but redis_tls is disabled")
+		}
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.RedisTLSServerName,
+		InsecureSkipVerify: cfg.RedisTLSInsecureSkipVerify,
+		VerifyConnection:   monitor.record,
+	}
+
+	if cfg.RedisTLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.RedisTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Redis TLS CA file %s", cfg.RedisTLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.RedisTLSCertFile != "" || cfg.RedisTLSKeyFile != "" {
+		if cfg.RedisTLSCertFile == "" || cfg.RedisTLSKeyFile == "" {
+			return nil, fmt.Errorf("redis TLS client certificate and key must be configured together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.RedisTLSCertFile, cfg.RedisTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	monitor.enabled = true
+	monitor.clientCert = len(tlsConfig.Certificates) > 0
+	return tlsConfig, nil
+}
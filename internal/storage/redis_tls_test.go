@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// testCertificate is a certificate with its key, signed by a test CA
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCertificate issues a certificate for template, self-signed if parent is nil
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate failed: %v", err)
+	}
+	return &testCertificate{cert: cert, key: key, der: der}
+}
+
+// tlsCertificate returns the certificate for a tls.Config
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// writePEM writes the certificate and its key as PEM files into dir
+func (c *testCertificate) writePEM(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %v", err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestRedisStorage_TLS(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	dir := t.TempDir()
+	notAfter := time.Now().Add(time.Hour)
+
+	ca := newTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil)
+	server := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "redis.internal"},
+		DNSNames:     []string{"redis.internal"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	client := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "rate-limiter"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	caFile, _ := ca.writePEM(t, dir, "ca")
+	certFile, keyFile := client.writePEM(t, dir, "client")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	mr, err := miniredis.RunTLS(&tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate()},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("RunTLS failed: %v", err)
+	}
+	t.Cleanup(mr.Close)
+	mr.RequireUserAuth("limiter", "secret")
+
+	cfg := config.StorageConfig{
+		RedisAddress:       mr.Addr(),
+		RedisUsername:      "limiter",
+		RedisPassword:      "secret",
+		RedisTLS:           true,
+		RedisTLSCAFile:     caFile,
+		RedisTLSCertFile:   certFile,
+		RedisTLSKeyFile:    keyFile,
+		RedisTLSServerName: "redis.internal",
+	}
+	storage, err := NewRedisStorage(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewRedisStorage failed: %v", err)
+	}
+	defer storage.Close()
+
+	ctx := context.Background()
+	if err := storage.Set(ctx, "key", "value", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, err := storage.Get(ctx, "key"); err != nil || value != "value" {
+		t.Errorf("Expected value over TLS, got %v (%v)", value, err)
+	}
+
+	state, ok := ReportedTLSState(NewInstrumentedStorage(storage, "redis", newStorageMetricsRecorder(), logger))
+	if !ok {
+		t.Fatal("Expected Redis storage to report its TLS state through the instrumentation")
+	}
+	if !state.Enabled || state.Version == "" || state.CipherSuite == "" || !state.ClientCert {
+		t.Errorf("Expected a negotiated TLS session with a client certificate, got %+v", state)
+	}
+	if state.ServerName != "redis.internal" {
+		t.Errorf("Expected server name redis.internal, got %q", state.ServerName)
+	}
+
+	// A client that does not trust the CA is rejected
+	untrusted := cfg
+	untrusted.RedisTLSCAFile = ""
+	if _, err := NewRedisStorage(untrusted, logger); err == nil {
+		t.Error("Expected the connection to fail without the custom CA")
+	}
+
+	// The ACL user is required
+	anonymous := cfg
+	anonymous.RedisUsername = ""
+	if _, err := NewRedisStorage(anonymous, logger); err == nil {
+		t.Error("Expected the connection to fail without the ACL username")
+	}
+}
+
+func TestRedisStorage_TLSConfigErrors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  config.StorageConfig
+	}{
+		{"files without tls", config.StorageConfig{RedisTLSCAFile: notPEM}},
+		{"missing ca file", config.StorageConfig{RedisTLS: true, RedisTLSCAFile: filepath.Join(dir, "missing.crt")}},
+		{"ca file without certificates", config.StorageConfig{RedisTLS: true, RedisTLSCAFile: notPEM}},
+		{"certificate without key", config.StorageConfig{RedisTLS: true, RedisTLSCertFile: notPEM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.RedisAddress = "localhost:0"
+			if _, err := NewRedisStorage(tt.cfg, logger); err == nil {
+				t.Error("Expected an invalid TLS configuration to be rejected")
+			}
+		})
+	}
+
+	// Plaintext storages report TLS as disabled
+	storage, _ := newTestRedisStorage(t)
+	if state, ok := ReportedTLSState(storage); !ok || state.Enabled {
+		t.Errorf("Expected TLS to be reported as disabled, got %+v", state)
+	}
+	if _, ok := ReportedTLSState(NewMemoryStorage(nil, logger)); ok {
+		t.Error("Memory storage should not report a TLS state")
+	}
+}
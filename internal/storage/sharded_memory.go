@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// DefaultMemoryShards is the number of shards used when none is configured
+const DefaultMemoryShards = 64
+
+// ShardedMemoryStorage implements in-memory storage tuned for throughput.
+// Keys are spread over shards with their own lock, so keys in different shards never contend.
+// Values are kept as the Go values passed to Set and Update, which lets limiters
+// store their typed state without encoding it.
+// Unlike MemoryStorage it enforces no entry or memory limits.
+type ShardedMemoryStorage struct {
+	shards  []memoryShard
+	mask    uint64
+	keys    KeyNamespace
+	metrics MemoryMetrics
+	clock   clock.Clock
+	logger  *slog.Logger
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// memoryShard is a lock-protected part of the sharded key space
+type memoryShard struct {
+	mu    sync.Mutex
+	items map[string]shardedItem
+	_     [48]byte // Keeps the locks of neighbouring shards on separate cache lines
+}
+
+// shardedItem represents a value stored in a shard
+type shardedItem struct {
+	value     interface{}
+	expiresAt int64 // Unix timestamp, 0 means no expiration
+}
+
+// NewShardedMemoryStorage creates a new unbounded in-memory storage split into shards,
+// rounded up to a power of two. shards <= 0 selects DefaultMemoryShards.
+// Expired entries are removed when they are read. A nil clock uses the system clock.
+func NewShardedMemoryStorage(shards int, clk clock.Clock, logger *slog.Logger) *ShardedMemoryStorage {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if clk == nil {
+		clk = clock.System()
+	}
+	if shards <= 0 {
+		shards = DefaultMemoryShards
+	}
+
+	count := 1
+	for count < shards {
+		count <<= 1
+	}
+	s := &ShardedMemoryStorage{
+		shards: make([]memoryShard, count),
+		mask:   uint64(count - 1),
+		clock:  clk,
+		logger: logger,
+	}
+	for i := range s.shards {
+		s.shards[i].items = make(map[string]shardedItem)
+	}
+	return s
+}
+
+// NewShardedMemoryStorageWithConfig creates a sharded in-memory storage with cfg.MemoryShards shards.
+// Expired entries are removed in the background every cfg.MemoryCleanupInterval.
+// metrics may be nil.
+func NewShardedMemoryStorageWithConfig(cfg config.StorageConfig, metrics MemoryMetrics, clk clock.Clock, logger *slog.Logger) (*ShardedMemoryStorage, error) {
+	if cfg.MemoryShards < 0 {
+		return nil, fmt.Errorf("memory shards must not be negative, got %d", cfg.MemoryShards)
+	}
+	if cfg.MemoryCleanupInterval < 0 {
+		return nil, fmt.Errorf("memory cleanup interval must not be negative, got %v", cfg.MemoryCleanupInterval)
+	}
+
+	keys, err := configuredKeyNamespace(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewShardedMemoryStorage(cfg.MemoryShards, clk, logger)
+	s.keys = keys
+	s.metrics = metrics
+
+	if cfg.MemoryCleanupInterval > 0 {
+		s.stop = make(chan struct{})
+		go s.cleanup(cfg.MemoryCleanupInterval)
+	}
+
+	s.logger.Info("Sharded memory storage configured",
+		"shards", len(s.shards),
+		"cleanup_interval", cfg.MemoryCleanupInterval,
+		"key_prefix", keys.Prefix(),
+	)
+	return s, nil
+}
+
+// Get retrieves a value from sharded memory storage
+func (s *ShardedMemoryStorage) Get(ctx context.Context, key string) (interface{}, error) {
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Get operation cancelled", "key", key, "error", ctx.Err())
+		return nil, ctx.Err()
+	default:
+	}
+	key = s.keys.Key(key)
+
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	return shard.load(key, s.clock.Now().Unix()), nil
+}
+
+// Set stores a value in sharded memory storage with optional expiration
+func (s *ShardedMemoryStorage) Set(ctx context.Context, key string, value interface{}, expiration int64) error {
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Set operation cancelled", "key", key, "error", ctx.Err())
+		return ctx.Err()
+	default:
+	}
+	key = s.keys.Key(key)
+
+	shard := s.shard(key)
+	shard.mu.Lock()
+	shard.items[key] = shardedItem{value: value, expiresAt: expiration}
+	shard.mu.Unlock()
+
+	s.logger.Debug("Item stored", "key", key, "expiration", expiration)
+	return nil
+}
+
+// Delete removes a value from sharded memory storage
+func (s *ShardedMemoryStorage) Delete(ctx context.Context, key string) error {
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Delete operation cancelled", "key", key, "error", ctx.Err())
+		return ctx.Err()
+	default:
+	}
+	key = s.keys.Key(key)
+
+	shard := s.shard(key)
+	shard.mu.Lock()
+	delete(shard.items, key)
+	shard.mu.Unlock()
+
+	s.logger.Debug("Item deleted", "key", key)
+	return nil
+}
+
+// Update atomically replaces a value in sharded memory storage.
+// fn runs under the lock of the key's shard, so it must not call back into the storage.
+func (s *ShardedMemoryStorage) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Update operation cancelled", "key", key, "error", ctx.Err())
+		return ctx.Err()
+	default:
+	}
+	key = s.keys.Key(key)
+
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	value, expiration, err := fn(shard.load(key, s.clock.Now().Unix()))
+	if err != nil {
+		return err
+	}
+
+	shard.items[key] = shardedItem{value: value, expiresAt: expiration}
+	return nil
+}
+
+// Close stops the background cleanup of the sharded memory storage
+func (s *ShardedMemoryStorage) Close() error {
+	s.closeOnce.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+		}
+	})
+	s.logger.Info("Sharded memory storage closed")
+	return nil
+}
+
+// Len returns the number of stored keys, including expired keys not removed yet
+func (s *ShardedMemoryStorage) Len() int {
+	count := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		count += len(shard.items)
+		shard.mu.Unlock()
+	}
+	return count
+}
+
+// shard returns the shard holding key, chosen by the FNV-1a hash of the key
+func (s *ShardedMemoryStorage) shard(key string) *memoryShard {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= 1099511628211
+	}
+	return &s.shards[hash&s.mask]
+}
+
+// load returns the value stored at key if it is live at now, removing it if it has expired.
+// The shard lock must be held.
+func (m *memoryShard) load(key string, now int64) interface{} {
+	item, ok := m.items[key]
+	if !ok {
+		return nil
+	}
+	if item.expiresAt > 0 && now >= item.expiresAt {
+		delete(m.items, key)
+		return nil
+	}
+	return item.value
+}
+
+// cleanup periodically removes expired items
+func (s *ShardedMemoryStorage) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.removeExpired(s.clock.Now().Unix())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// removeExpired removes every item expired at now, one shard at a time,
+// and returns how many were removed
+func (s *ShardedMemoryStorage) removeExpired(now int64) int {
+	removed, remaining := 0, 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		for key, item := range shard.items {
+			if item.expiresAt > 0 && now >= item.expiresAt {
+				delete(shard.items, key)
+				removed++
+			}
+		}
+		remaining += len(shard.items)
+		shard.mu.Unlock()
+	}
+
+	if s.metrics != nil {
+		s.metrics.SetMemoryKeys(remaining)
+		for i := 0; i < removed; i++ {
+			s.metrics.IncMemoryEvictions(EvictionReasonExpired)
+		}
+	}
+	if removed > 0 {
+		s.logger.Debug("Expired items removed", "count", removed, "entries", remaining)
+	}
+	return removed
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+func TestShardedMemoryStorage_GetSetDelete(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	storage := NewShardedMemoryStorage(8, nil, logger)
+	ctx := context.Background()
+
+	// Typed values are kept as is
+	type state struct{ Count int }
+	if err := storage.Set(ctx, "typed", state{Count: 3}, 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	result, err := storage.Get(ctx, "typed")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if result != (state{Count: 3}) {
+		t.Errorf("Expected %v, got %v", state{Count: 3}, result)
+	}
+
+	if err := storage.Delete(ctx, "typed"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	result, err = storage.Get(ctx, "typed")
+	if err != nil {
+		t.Fatalf("Get after delete failed: %v", err)
+	}
+	if result != nil {
+		t.Errorf("Expected nil after delete, got %v", result)
+	}
+
+	// Expired values are not returned
+	storage.Set(ctx, "expired", "value", time.Now().Add(-time.Second).Unix())
+	if result, _ := storage.Get(ctx, "expired"); result != nil {
+		t.Errorf("Expected nil for expired key, got %v", result)
+	}
+}
+
+func TestShardedMemoryStorage_Shards(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	tests := []struct {
+		shards   int
+		expected int
+	}{
+		{shards: 0, expected: DefaultMemoryShards},
+		{shards: 1, expected: 1},
+		{shards: 5, expected: 8},
+		{shards: 64, expected: 64},
+	}
+
+	for _, tt := range tests {
+		storage := NewShardedMemoryStorage(tt.shards, nil, logger)
+		if len(storage.shards) != tt.expected {
+			t.Errorf("Expected %d shards for %d, got %d", tt.expected, tt.shards, len(storage.shards))
+		}
+	}
+
+	// Keys are spread over the shards
+	storage := NewShardedMemoryStorage(4, nil, logger)
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		storage.Set(ctx, fmt.Sprintf("key:%d", i), i, 0)
+	}
+	for i := range storage.shards {
+		if len(storage.shards[i].items) == 0 {
+			t.Errorf("Expected shard %d to hold keys", i)
+		}
+	}
+	if storage.Len() != 100 {
+		t.Errorf("Expected 100 keys, got %d", storage.Len())
+	}
+}
+
+func TestShardedMemoryStorage_UpdateConcurrent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	storage := NewShardedMemoryStorage(4, nil, logger)
+	ctx := context.Background()
+
+	const goroutines = 100
+	const increments = 100
+	keys := []string{"a", "b", "c"}
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				for _, key := range keys {
+					err := storage.Update(ctx, key, func(current interface{}) (interface{}, int64, error) {
+						count, _ := current.(int)
+						return count + 1, 0, nil
+					})
+					if err != nil {
+						t.Errorf("Update failed: %v", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		result, err := storage.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if result != goroutines*increments {
+			t.Errorf("Expected %d for %s, got %v", goroutines*increments, key, result)
+		}
+	}
+}
+
+func TestShardedMemoryStorage_BackgroundCleanup(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	metrics := &memoryMetricsRecorder{}
+	storage, err := NewShardedMemoryStorageWithConfig(config.StorageConfig{MemoryCleanupInterval: 10 * time.Millisecond}, metrics, nil, logger)
+	if err != nil {
+		t.Fatalf("NewShardedMemoryStorageWithConfig failed: %v", err)
+	}
+	defer storage.Close()
+	ctx := context.Background()
+
+	// Expired keys that are never read again are removed by the janitor
+	past := time.Now().Add(-time.Second).Unix()
+	for _, key := range []string{"a", "b", "c"} {
+		storage.Set(ctx, key, "value", past)
+	}
+	storage.Set(ctx, "live", "value", 0)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if evictions, _ := metrics.snapshot(); evictions[EvictionReasonExpired] == 3 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if storage.Len() != 1 {
+		t.Fatalf("Expected only the live key to remain, got %d keys", storage.Len())
+	}
+
+	evictions, keys := metrics.snapshot()
+	if evictions[EvictionReasonExpired] != 3 {
+		t.Errorf("Expected 3 expired evictions, got %d", evictions[EvictionReasonExpired])
+	}
+	if keys != 1 {
+		t.Errorf("Expected 1 key reported, got %d", keys)
+	}
+}
+
+func TestNewShardedMemoryStorageWithConfig_Invalid(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	configs := map[string]config.StorageConfig{
+		"negative shards":           {MemoryShards: -1},
+		"negative cleanup interval": {MemoryCleanupInterval: -time.Second},
+		"invalid key namespace":     {KeyPrefix: "rl{"},
+	}
+
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewShardedMemoryStorageWithConfig(cfg, nil, nil, logger); err == nil {
+				t.Error("Expected error for invalid sharded memory storage configuration")
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// DefaultSQLTable is the table used when none is configured
+const DefaultSQLTable = "rate_limiter_state"
+
+// sqlUpdateMaxRetries bounds the optimistic retries of Update
+const sqlUpdateMaxRetries = 100
+
+// sqlMigrationTimeout bounds the migration of an existing table, which may rewrite every row
+const sqlMigrationTimeout = 5 * time.Minute
+
+// sqlTableName restricts table names, which cannot be passed as query parameters
+var sqlTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sqlDialect holds the SQL that differs between databases
+type sqlDialect struct {
+	// placeholder returns the n-th (1-based) query parameter
+	placeholder func(n int) string
+	// schema creates the table and its indexes, %s is the table name
+	schema []string
+	// insert adds a row unless the key exists, %s is the table name
+	insert string
+	// valueType returns the declared type of the value column, %s is the table name
+	valueType string
+	// migrate converts a text value column, created before the state codec, to binary; %s is the table name
+	migrate []string
+	// maxOpenConns limits the connection pool, 0 means unlimited
+	maxOpenConns int
+}
+
+// sqlDialects maps the supported database/sql driver names to their dialect.
+// Only SQLite is supported, as it is the database the binary embeds and the tests run against.
+var sqlDialects = map[string]sqlDialect{
+	"sqlite": {
+		placeholder: questionPlaceholder,
+		schema: []string{
+			"CREATE TABLE IF NOT EXISTS %s (limiter_key TEXT PRIMARY KEY, value BLOB NOT NULL, expires_at BIGINT NOT NULL, version BIGINT NOT NULL)",
+			"CREATE INDEX IF NOT EXISTS %[1]s_expires_at ON %[1]s (expires_at)",
+		},
+		insert:    "INSERT INTO %s (limiter_key, value, expires_at, version) VALUES (?, ?, ?, 1) ON CONFLICT (limiter_key) DO NOTHING",
+		valueType: "SELECT type FROM pragma_table_info('%s') WHERE name = 'value'",
+		// SQLite cannot change the type of a column, the table is copied instead
+		migrate: []string{
+			"CREATE TABLE %[1]s_migration (limiter_key TEXT PRIMARY KEY, value BLOB NOT NULL, expires_at BIGINT NOT NULL, version BIGINT NOT NULL)",
+			"INSERT INTO %[1]s_migration SELECT limiter_key, CAST(value AS BLOB), expires_at, version FROM %[1]s",
+			"DROP TABLE %[1]s",
+			"ALTER TABLE %[1]s_migration RENAME TO %[1]s",
+			"CREATE INDEX IF NOT EXISTS %[1]s_expires_at ON %[1]s (expires_at)",
+		},
+		// Writers would only wait for each other on the database lock, and every
+		// connection to ":memory:" would open a separate database
+		maxOpenConns: 1,
+	},
+}
+
+func init() {
+	sqlDialects["sqlite3"] = sqlDialects["sqlite"]
+}
+
+func questionPlaceholder(int) string {
+	return "?"
+}
+
+// SQLStorage implements storage over database/sql for deployments without Redis.
+// Values are kept as encoded by the state codec next to their expiration and a row version:
+// Update is atomic per row by only writing over the version it read,
+// and expired rows are deleted in the background.
+// Values are returned as the stored string, see DecodeState.
+type SQLStorage struct {
+	db     *sql.DB
+	codec  StateCodec
+	keys   KeyNamespace
+	clock  clock.Clock
+	logger *slog.Logger
+
+	getQuery     string
+	insertQuery  string
+	updateQuery  string
+	deleteQuery  string
+	cleanupQuery string
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSQLStorage opens cfg.SQLDSN with the database/sql driver cfg.SQLDriver, which must be
+// registered by the binary, and creates cfg.SQLTable if it does not exist.
+// Expired rows are removed in the background every cfg.SQLCleanupInterval.
+// Expiration is checked against clk, the system clock if nil.
+func NewSQLStorage(cfg config.StorageConfig, clk clock.Clock, logger *slog.Logger) (*SQLStorage, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if clk == nil {
+		clk = clock.System()
+	}
+
+	dialect, ok := sqlDialects[cfg.SQLDriver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported SQL driver: %s", cfg.SQLDriver)
+	}
+	table := cfg.SQLTable
+	if table == "" {
+		table = DefaultSQLTable
+	}
+	if !sqlTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid SQL table name: %q", table)
+	}
+	if cfg.SQLCleanupInterval < 0 {
+		return nil, fmt.Errorf("SQL cleanup interval must not be negative, got %v", cfg.SQLCleanupInterval)
+	}
+	codec, err := NewStateCodec(cfg.StateCodec)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := configuredKeyNamespace(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(cfg.SQLDriver, cfg.SQLDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQL database: %w", err)
+	}
+	if dialect.maxOpenConns > 0 {
+		db.SetMaxOpenConns(dialect.maxOpenConns)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Test connection
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		logger.Error("Failed to connect to SQL database", "error", err, "driver", cfg.SQLDriver)
+		return nil, fmt.Errorf("failed to connect to SQL database: %w", err)
+	}
+	for _, statement := range dialect.schema {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(statement, table)); err != nil {
+			db.Close()
+			logger.Error("Failed to create SQL schema", "error", err, "table", table)
+			return nil, fmt.Errorf("failed to create SQL schema: %w", err)
+		}
+	}
+	if err := migrateSQLValueColumn(db, dialect, table, logger); err != nil {
+		db.Close()
+		logger.Error("Failed to migrate SQL schema", "error", err, "table", table)
+		return nil, err
+	}
+
+	p := dialect.placeholder
+	s := &SQLStorage{
+		db:           db,
+		codec:        codec,
+		keys:         keys,
+		clock:        clk,
+		logger:       logger,
+		getQuery:     fmt.Sprintf("SELECT value, expires_at, version FROM %s WHERE limiter_key = %s", table, p(1)),
+		insertQuery:  fmt.Sprintf(dialect.insert, table),
+		updateQuery:  fmt.Sprintf("UPDATE %s SET value = %s, expires_at = %s, version = version + 1 WHERE limiter_key = %s AND version = %s", table, p(1), p(2), p(3), p(4)),
+		deleteQuery:  fmt.Sprintf("DELETE FROM %s WHERE limiter_key = %s", table, p(1)),
+		cleanupQuery: fmt.Sprintf("DELETE FROM %s WHERE expires_at > 0 AND expires_at <= %s", table, p(1)),
+	}
+	if cfg.SQLCleanupInterval > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.cleanup(cfg.SQLCleanupInterval)
+	}
+
+	logger.Info("Connected to SQL database",
+		"driver", cfg.SQLDriver,
+		"table", table,
+		"cleanup_interval", cfg.SQLCleanupInterval,
+		"state_codec", codec.Name(),
+		"key_prefix", keys.Prefix(),
+	)
+	return s, nil
+}
+
+// migrateSQLValueColumn converts the value column of a table created before the state codec
+// from text to binary, so that binary state can be stored. JSON values are kept as they are.
+func migrateSQLValueColumn(db *sql.DB, dialect sqlDialect, table string, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlMigrationTimeout)
+	defer cancel()
+
+	var valueType string
+	if err := db.QueryRowContext(ctx, fmt.Sprintf(dialect.valueType, table)).Scan(&valueType); err != nil {
+		return fmt.Errorf("failed to read SQL value column type: %w", err)
+	}
+	if !strings.HasSuffix(strings.ToLower(valueType), "text") {
+		return nil
+	}
+
+	logger.Info("Migrating SQL value column to binary", "table", table, "type", valueType)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin SQL migration: %w", err)
+	}
+	defer tx.Rollback()
+	for _, statement := range dialect.migrate {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(statement, table)); err != nil {
+			return fmt.Errorf("failed to migrate SQL value column: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit SQL migration: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a value from SQL storage
+func (s *SQLStorage) Get(ctx context.Context, key string) (interface{}, error) {
+	key = s.keys.Key(key)
+	row, err := s.load(ctx, key)
+	if err != nil {
+		s.logger.Error("Failed to get value from SQL database", "key", key, "error", err)
+		return nil, fmt.Errorf("failed to get value from SQL database: %w", err)
+	}
+	if row == nil || row.expired(s.clock.Now().Unix()) {
+		s.logger.Debug("Key not found in SQL database", "key", key)
+		return nil, nil
+	}
+
+	return string(row.value), nil
+}
+
+// Set stores a value in SQL storage with optional expiration
+func (s *SQLStorage) Set(ctx context.Context, key string, value interface{}, expiration int64) error {
+	return s.Update(ctx, key, func(interface{}) (interface{}, int64, error) {
+		return value, expiration, nil
+	})
+}
+
+// Delete removes a value from SQL storage
+func (s *SQLStorage) Delete(ctx context.Context, key string) error {
+	key = s.keys.Key(key)
+	if _, err := s.db.ExecContext(ctx, s.deleteQuery, key); err != nil {
+		s.logger.Error("Failed to delete value from SQL database", "key", key, "error", err)
+		return fmt.Errorf("failed to delete value from SQL database: %w", err)
+	}
+
+	s.logger.Debug("Value deleted from SQL database", "key", key)
+	return nil
+}
+
+// Update atomically replaces a value in SQL storage.
+// The row is only written if its version is still the one fn was given, otherwise
+// the update is retried with fresh state.
+func (s *SQLStorage) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	key = s.keys.Key(key)
+	for attempt := 0; attempt < sqlUpdateMaxRetries; attempt++ {
+		updated, err := s.tryUpdate(ctx, key, fn)
+		if err != nil {
+			s.logger.Error("Failed to update value in SQL database", "key", key, "error", err)
+			return fmt.Errorf("failed to update value in SQL database: %w", err)
+		}
+		if updated {
+			s.logger.Debug("Value updated in SQL database", "key", key, "attempts", attempt+1)
+			return nil
+		}
+		// Row changed concurrently, retry with fresh state
+	}
+
+	s.logger.Warn("Update retries exhausted", "key", key, "retries", sqlUpdateMaxRetries)
+	return ErrUpdateConflict
+}
+
+// Close stops the background cleanup and closes the database
+func (s *SQLStorage) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+			<-s.done
+		}
+		if err = s.db.Close(); err != nil {
+			s.logger.Error("Failed to close SQL database", "error", err)
+			return
+		}
+		s.logger.Info("SQL database closed")
+	})
+	return err
+}
+
+// sqlRow is a stored value with its expiration and version
+type sqlRow struct {
+	value     []byte
+	expiresAt int64 // Unix timestamp, 0 means no expiration
+	version   int64
+}
+
+func (r *sqlRow) expired(now int64) bool {
+	return r.expiresAt > 0 && now >= r.expiresAt
+}
+
+// load reads the row of key, nil if there is none
+func (s *SQLStorage) load(ctx context.Context, key string) (*sqlRow, error) {
+	var row sqlRow
+	err := s.db.QueryRowContext(ctx, s.getQuery, key).Scan(&row.value, &row.expiresAt, &row.version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// tryUpdate applies fn once and reports whether the result was stored,
+// false means another writer changed the row first
+func (s *SQLStorage) tryUpdate(ctx context.Context, key string, fn UpdateFunc) (bool, error) {
+	row, err := s.load(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to get value: %w", err)
+	}
+
+	var current interface{}
+	if row != nil && !row.expired(s.clock.Now().Unix()) {
+		current = string(row.value)
+	}
+
+	value, expiration, err := fn(current)
+	if err != nil {
+		return false, err
+	}
+	newVal, err := s.codec.Encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	var result sql.Result
+	if row == nil {
+		result, err = s.db.ExecContext(ctx, s.insertQuery, key, newVal, expiration)
+	} else {
+		// An expired row is overwritten in place, the cleanup may still delete it first
+		result, err = s.db.ExecContext(ctx, s.updateQuery, newVal, expiration, key, row.version)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to store value: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to store value: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// cleanup removes expired rows every interval until the storage is closed
+func (s *SQLStorage) cleanup(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.deleteExpired(context.Background()); err != nil {
+				s.logger.Error("Failed to delete expired rows", "error", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// deleteExpired removes the rows that have expired and returns how many were removed
+func (s *SQLStorage) deleteExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, s.cleanupQuery, s.clock.Now().Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired rows: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired rows: %w", err)
+	}
+	if removed > 0 {
+		s.logger.Debug("Expired rows deleted", "rows", removed)
+	}
+	return removed, nil
+}
@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// newTestSQLStorage opens SQL storage on an SQLite database in path
+func newTestSQLStorage(t *testing.T, path string, clk clock.Clock) *SQLStorage {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	storage, err := NewSQLStorage(config.StorageConfig{
+		SQLDriver: "sqlite",
+		// Instances sharing the file wait for each other's writes
+		SQLDSN: "file:" + path + "?_pragma=busy_timeout(5000)",
+	}, clk, logger)
+	if err != nil {
+		t.Fatalf("NewSQLStorage failed: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	return storage
+}
+
+func TestSQLStorage_GetSetDelete(t *testing.T) {
+	storage := newTestSQLStorage(t, filepath.Join(t.TempDir(), "state.db"), nil)
+	ctx := context.Background()
+
+	if value, err := storage.Get(ctx, "missing"); err != nil || value != nil {
+		t.Errorf("Expected nil for missing key, got %v (%v)", value, err)
+	}
+
+	if err := storage.Set(ctx, "key", map[string]interface{}{"count": 3}, 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	value, err := storage.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if value != `{"count":3}` {
+		t.Errorf("Expected stored JSON state, got %v", value)
+	}
+
+	// Overwriting keeps a single row
+	if err := storage.Set(ctx, "key", "plain", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, _ := storage.Get(ctx, "key"); value != "plain" {
+		t.Errorf("Expected overwritten value, got %v", value)
+	}
+
+	if err := storage.Delete(ctx, "key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if value, _ := storage.Get(ctx, "key"); value != nil {
+		t.Errorf("Expected nil after delete, got %v", value)
+	}
+
+	// Expired values are not returned and are replaced by Update
+	if err := storage.Set(ctx, "expired", "old", time.Now().Add(-time.Second).Unix()); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, _ := storage.Get(ctx, "expired"); value != nil {
+		t.Errorf("Expected nil for expired key, got %v", value)
+	}
+	err = storage.Update(ctx, "expired", func(current interface{}) (interface{}, int64, error) {
+		if current != nil {
+			t.Errorf("Expected Update to see no value for expired key, got %v", current)
+		}
+		return "new", 0, nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if value, _ := storage.Get(ctx, "expired"); value != "new" {
+		t.Errorf("Expected updated value, got %v", value)
+	}
+}
+
+func TestSQLStorage_UpdateConcurrent(t *testing.T) {
+	// Two storages on one database act as two service instances
+	path := filepath.Join(t.TempDir(), "state.db")
+	instances := []*SQLStorage{newTestSQLStorage(t, path, nil), newTestSQLStorage(t, path, nil)}
+	ctx := context.Background()
+
+	const goroutines = 20
+	const increments = 10
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(storage *SQLStorage) {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				err := storage.Update(ctx, "counter", func(current interface{}) (interface{}, int64, error) {
+					count := 0
+					if current != nil {
+						count, _ = strconv.Atoi(current.(string))
+					}
+					return count + 1, 0, nil
+				})
+				if err != nil {
+					t.Errorf("Update failed: %v", err)
+					return
+				}
+			}
+		}(instances[i%len(instances)])
+	}
+	wg.Wait()
+
+	value, err := instances[0].Get(ctx, "counter")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if value != strconv.Itoa(goroutines*increments) {
+		t.Errorf("Expected %d increments, got %v", goroutines*increments, value)
+	}
+}
+
+func TestSQLStorage_DeleteExpired(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	storage := newTestSQLStorage(t, filepath.Join(t.TempDir(), "state.db"), clk)
+	ctx := context.Background()
+
+	soon := clk.Now().Add(time.Second).Unix()
+	later := clk.Now().Add(time.Hour).Unix()
+	for i, expiration := range []int64{soon, soon, later, 0} {
+		if err := storage.Set(ctx, fmt.Sprintf("key%d", i), "value", expiration); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	clk.Advance(time.Second)
+
+	removed, err := storage.deleteExpired(ctx)
+	if err != nil {
+		t.Fatalf("deleteExpired failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 expired rows removed, got %d", removed)
+	}
+
+	var rows int
+	if err := storage.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+DefaultSQLTable).Scan(&rows); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if rows != 2 {
+		t.Errorf("Expected 2 rows left, got %d", rows)
+	}
+}
+
+func TestSQLStorage_SchemaReused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	first := newTestSQLStorage(t, path, nil)
+	if err := first.Set(context.Background(), "key", "value", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	first.Close()
+
+	// Reopening finds the existing table and its rows
+	second := newTestSQLStorage(t, path, nil)
+	if value, _ := second.Get(context.Background(), "key"); value != "value" {
+		t.Errorf("Expected value to survive reopening, got %v", value)
+	}
+}
+
+func TestSQLStorage_MigratesTextValueColumn(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	dsn := "file:" + filepath.Join(t.TempDir(), "state.db") + "?_pragma=busy_timeout(5000)"
+	ctx := context.Background()
+
+	keys, err := configuredKeyNamespace(config.StorageConfig{})
+	if err != nil {
+		t.Fatalf("configuredKeyNamespace failed: %v", err)
+	}
+
+	// A table created before the state codec, with JSON state in a text column
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for _, statement := range []string{
+		"CREATE TABLE " + DefaultSQLTable + " (limiter_key TEXT PRIMARY KEY, value TEXT NOT NULL, expires_at BIGINT NOT NULL, version BIGINT NOT NULL)",
+		"INSERT INTO " + DefaultSQLTable + " VALUES ('" + keys.Key("key") + "', '{\"tokens\":3}', 0, 7)",
+	} {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			t.Fatalf("Exec failed: %v", err)
+		}
+	}
+	db.Close()
+
+	storage, err := NewSQLStorage(config.StorageConfig{SQLDriver: "sqlite", SQLDSN: dsn, StateCodec: "binary"}, nil, logger)
+	if err != nil {
+		t.Fatalf("NewSQLStorage failed: %v", err)
+	}
+	defer storage.Close()
+
+	var valueType string
+	if err := storage.db.QueryRowContext(ctx, fmt.Sprintf(sqlDialects["sqlite"].valueType, DefaultSQLTable)).Scan(&valueType); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if valueType != "BLOB" {
+		t.Errorf("Expected the value column to be migrated to BLOB, got %s", valueType)
+	}
+	if value, err := storage.Get(ctx, "key"); err != nil || value != `{"tokens":3}` {
+		t.Errorf("Expected the existing row to be kept, got %v (%v)", value, err)
+	}
+
+	// Binary state is stored in the migrated column
+	if err := storage.Set(ctx, "other", string([]byte{0x00, 0xff, 0x01}), 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, _ := storage.Get(ctx, "other"); value != string([]byte{0x00, 0xff, 0x01}) {
+		t.Errorf("Expected binary value to round trip, got %q", value)
+	}
+}
+
+func TestSQLStorage_KeyNamespace(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	dsn := "file:" + filepath.Join(t.TempDir(), "state.db") + "?_pragma=busy_timeout(5000)"
+	ctx := context.Background()
+
+	// Two applications sharing one table
+	var storages []*SQLStorage
+	for _, prefix := range []string{"billing", "search"} {
+		storage, err := NewSQLStorage(config.StorageConfig{SQLDriver: "sqlite", SQLDSN: dsn, KeyPrefix: prefix}, nil, logger)
+		if err != nil {
+			t.Fatalf("NewSQLStorage failed: %v", err)
+		}
+		t.Cleanup(func() { storage.Close() })
+		storages = append(storages, storage)
+	}
+
+	for i, storage := range storages {
+		if err := storage.Set(ctx, "key", strconv.Itoa(i), 0); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	for i, storage := range storages {
+		if value, _ := storage.Get(ctx, "key"); value != strconv.Itoa(i) {
+			t.Errorf("Expected namespaces to be isolated, got %v for storage %d", value, i)
+		}
+	}
+
+	var key string
+	if err := storages[0].db.QueryRowContext(ctx, "SELECT limiter_key FROM "+DefaultSQLTable+" ORDER BY limiter_key").Scan(&key); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if key != "billing:v1:key" {
+		t.Errorf("Expected billing:v1:key, got %s", key)
+	}
+
+	if err := storages[0].Delete(ctx, "key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if value, _ := storages[1].Get(ctx, "key"); value != "1" {
+		t.Errorf("Expected delete to stay inside its namespace, got %v", value)
+	}
+}
+
+func TestNewSQLStorage_Invalid(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	dsn := filepath.Join(t.TempDir(), "state.db")
+
+	tests := []struct {
+		name string
+		cfg  config.StorageConfig
+	}{
+		{"unsupported driver", config.StorageConfig{SQLDriver: "oracle", SQLDSN: dsn}},
+		{"untested dialect", config.StorageConfig{SQLDriver: "postgres", SQLDSN: dsn}},
+		{"invalid table name", config.StorageConfig{SQLDriver: "sqlite", SQLDSN: dsn, SQLTable: "state; DROP TABLE users"}},
+		{"negative cleanup interval", config.StorageConfig{SQLDriver: "sqlite", SQLDSN: dsn, SQLCleanupInterval: -time.Second}},
+		{"invalid key prefix", config.StorageConfig{SQLDriver: "sqlite", SQLDSN: dsn, KeyPrefix: "{rl}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSQLStorage(tt.cfg, nil, logger); err == nil {
+				t.Error("Expected error for invalid configuration")
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 )
 
 // Storage defines the interface for rate limiter storage backends
@@ -12,7 +15,142 @@ type Storage interface {
 	Set(ctx context.Context, key string, value interface{}, expiration int64) error
 	// Delete removes a value from storage
 	Delete(ctx context.Context, key string) error
+	// Update atomically replaces the value stored at key with the result of fn
+	Update(ctx context.Context, key string, fn UpdateFunc) error
 	// Close closes the storage connection
 	Close() error
 }
 
+// UpdateFunc computes a new value from the current one, which is nil if the key is absent.
+// It returns the value to store and its expiration (Unix timestamp, 0 means no expiration).
+// Backends with optimistic concurrency may call fn several times, so it must not have side effects
+// beyond the last call.
+type UpdateFunc func(current interface{}) (value interface{}, expiration int64, err error)
+
+// ErrUpdateConflict is returned by Update when the value kept changing concurrently
+var ErrUpdateConflict = errors.New("storage: too many concurrent updates")
+
+// ErrInvalidCost is returned by limiters and evaluators for a request costing less than one unit
+var ErrInvalidCost = errors.New("cost must be at least 1")
+
+// validateCost rejects costs below one unit, which would create capacity instead of using it
+func validateCost(cost int) error {
+	if cost < 1 {
+		return fmt.Errorf("%w, got %d", ErrInvalidCost, cost)
+	}
+	return nil
+}
+
+// TokenBucketEvaluator is implemented by storage backends that can evaluate
+// the Token Bucket algorithm atomically on the server side
+type TokenBucketEvaluator interface {
+	// EvalTokenBucket refills the bucket of burst tokens for key at limit tokens per window
+	// and consumes cost tokens if they are available.
+	// It returns the tokens left and the last refill time in Unix nanoseconds.
+	EvalTokenBucket(
+		ctx context.Context,
+		key string,
+		limit int,
+		window time.Duration,
+		burst int,
+		cost int,
+		now time.Time,
+	) (allowed bool, tokens float64, lastRefill int64, err error)
+}
+
+// SlidingWindowEvaluator is implemented by storage backends that can evaluate
+// the Sliding Window Log algorithm atomically on the server side
+type SlidingWindowEvaluator interface {
+	// EvalSlidingWindow trims the log for key and records cost entries if they fit into the window.
+	// It returns the number of entries in the window, the newest entry and, for a denied request,
+	// the entry that has to leave the window before it fits (Unix nanoseconds, 0 if none).
+	EvalSlidingWindow(
+		ctx context.Context,
+		key string,
+		limit int,
+		window time.Duration,
+		cost int,
+		now time.Time,
+	) (allowed bool, count int, newest int64, blocking int64, err error)
+}
+
+// FixedWindowEvaluator is implemented by storage backends that can evaluate
+// the Fixed Window Counter algorithm atomically on the server side
+type FixedWindowEvaluator interface {
+	// EvalFixedWindow adds cost to the counter of the window starting at windowStart (Unix nanoseconds)
+	// if the result does not exceed limit. The state expires at expireAt. It returns the counter.
+	EvalFixedWindow(
+		ctx context.Context,
+		key string,
+		limit int,
+		cost int,
+		windowStart int64,
+		expireAt time.Time,
+	) (allowed bool, count int, err error)
+}
+
+// SlidingWindowCounterEvaluator is implemented by storage backends that can evaluate
+// the Sliding Window Counter algorithm atomically on the server side
+type SlidingWindowCounterEvaluator interface {
+	// EvalSlidingWindowCounter rolls the counters to the window starting at windowStart (Unix nanoseconds)
+	// and counts the request as cost requests if the previous count weighted by previousWeight plus
+	// the current count leaves room for them below limit. The state expires at expireAt.
+	// It returns both counters after evaluation.
+	EvalSlidingWindowCounter(
+		ctx context.Context,
+		key string,
+		limit int,
+		cost int,
+		windowStart int64,
+		window int64,
+		previousWeight float64,
+		expireAt time.Time,
+	) (allowed bool, current int, previous int, err error)
+}
+
+// GCRAEvaluator is implemented by storage backends that can evaluate
+// the Generic Cell Rate Algorithm atomically on the server side
+type GCRAEvaluator interface {
+	// EvalGCRA advances the theoretical arrival time of key by cost emission intervals if the request
+	// conforms to the burstOffset tolerance. It returns the TAT after evaluation in Unix nanoseconds.
+	EvalGCRA(
+		ctx context.Context,
+		key string,
+		emissionInterval time.Duration,
+		burstOffset time.Duration,
+		cost int,
+		now time.Time,
+	) (allowed bool, tat int64, err error)
+}
+
+// LeakyBucketEvaluator is implemented by storage backends that can evaluate
+// the Leaky Bucket algorithm atomically on the server side
+type LeakyBucketEvaluator interface {
+	// EvalLeakyBucket queues a request taking cost places for key if they are free among capacity.
+	// It returns the time at which the queue will have drained in Unix nanoseconds.
+	EvalLeakyBucket(
+		ctx context.Context,
+		key string,
+		drainInterval time.Duration,
+		capacity int,
+		cost int,
+		now time.Time,
+	) (allowed bool, departure int64, err error)
+}
+
+// LeaseEvaluator is implemented by storage backends that can manage
+// concurrency leases atomically on the server side
+type LeaseEvaluator interface {
+	// EvalAcquireLease drops the leases of key that expired by now and records leaseID
+	// until expireAt if fewer than limit leases are held
+	EvalAcquireLease(
+		ctx context.Context,
+		key string,
+		leaseID string,
+		limit int,
+		expireAt time.Time,
+		now time.Time,
+	) (bool, error)
+	// EvalReleaseLease removes leaseID from key and reports whether it was still held
+	EvalReleaseLease(ctx context.Context, key string, leaseID string, now time.Time) (bool, error)
+}
@@ -15,9 +15,15 @@ func NewStorage(storageType string, cfg config.StorageConfig, logger *slog.Logge
 
 	switch storageType {
 	case "memory":
-		return NewMemoryStorage(logger), nil
+		return NewMemoryStorage(nil, logger), nil
+	case "sharded_memory":
+		return NewShardedMemoryStorage(cfg.MemoryShards, nil, logger), nil
 	case "redis":
 		return NewRedisStorage(cfg, logger)
+	case "hybrid":
+		return NewHybridStorage(cfg, nil, logger)
+	case "sql":
+		return NewSQLStorage(cfg, nil, logger)
 	default:
 		return nil, fmt.Errorf("unsupported storage type: %s", storageType)
 	}
@@ -30,19 +30,83 @@ type ServerConfig struct {
 
 // StorageConfig holds storage configuration
 type StorageConfig struct {
-	Type          string `mapstructure:"type"` // "memory" or "redis"
-	RedisAddress  string `mapstructure:"redis_address"`
-	RedisDB       int    `mapstructure:"redis_db"`
-	RedisPassword string `mapstructure:"redis_password"`
-	RedisPoolSize int    `mapstructure:"redis_pool_size"`
-	RedisMinIdle  int    `mapstructure:"redis_min_idle"`
+	Type                   string   `mapstructure:"type"`       // "memory", "sharded_memory", "redis", "hybrid" or "sql"
+	RedisMode              string   `mapstructure:"redis_mode"` // "single", "sentinel" or "cluster"
+	RedisAddress           string   `mapstructure:"redis_address"`
+	RedisDB                int      `mapstructure:"redis_db"`
+	RedisUsername          string   `mapstructure:"redis_username"` // ACL user, empty authenticates with the password only
+	RedisPassword          string   `mapstructure:"redis_password"`
+	RedisPoolSize          int      `mapstructure:"redis_pool_size"`
+	RedisMinIdle           int      `mapstructure:"redis_min_idle"`
+	RedisSentinelMaster    string   `mapstructure:"redis_sentinel_master"`    // Master name monitored by the sentinels
+	RedisSentinelAddresses []string `mapstructure:"redis_sentinel_addresses"` // Sentinel host:port list
+	RedisSentinelUsername  string   `mapstructure:"redis_sentinel_username"`  // ACL user of the sentinels themselves
+	RedisSentinelPassword  string   `mapstructure:"redis_sentinel_password"`  // Password of the sentinels themselves
+	RedisClusterAddresses  []string `mapstructure:"redis_cluster_addresses"`  // Cluster seed nodes, defaults to redis_address
+
+	RedisTLS                   bool   `mapstructure:"redis_tls"`                      // Connect to Redis and the sentinels over TLS
+	RedisTLSCAFile             string `mapstructure:"redis_tls_ca_file"`              // PEM CA bundle verifying the server, empty uses the system roots
+	RedisTLSCertFile           string `mapstructure:"redis_tls_cert_file"`            // PEM client certificate for mutual TLS
+	RedisTLSKeyFile            string `mapstructure:"redis_tls_key_file"`             // PEM private key of the client certificate
+	RedisTLSServerName         string `mapstructure:"redis_tls_server_name"`          // Name verified in the server certificate, defaults to the host
+	RedisTLSInsecureSkipVerify bool   `mapstructure:"redis_tls_insecure_skip_verify"` // Skip server certificate verification, for testing only
+
+	HybridSyncInterval time.Duration `mapstructure:"hybrid_sync_interval"` // How often hybrid storage reconciles local counts with Redis
+
+	SQLDriver          string        `mapstructure:"sql_driver"`           // database/sql driver: "sqlite"
+	SQLDSN             string        `mapstructure:"sql_dsn"`              // Data source name passed to the driver
+	SQLTable           string        `mapstructure:"sql_table"`            // Table holding limiter state, created if missing
+	SQLCleanupInterval time.Duration `mapstructure:"sql_cleanup_interval"` // Background removal of expired rows, 0 disables it
+
+	MemoryMaxEntries      int           `mapstructure:"memory_max_entries"`      // Keys kept in memory storage, 0 means unlimited
+	MemoryMaxBytes        int64         `mapstructure:"memory_max_bytes"`        // Approximate memory budget, 0 means unlimited
+	MemoryEviction        string        `mapstructure:"memory_eviction"`         // "lru" or "lfu"
+	MemoryCleanupInterval time.Duration `mapstructure:"memory_cleanup_interval"` // Background removal of expired keys, 0 disables it
+	MemoryShards          int           `mapstructure:"memory_shards"`           // Shards of sharded_memory storage, rounded up to a power of two
+
+	MemorySnapshotPath     string        `mapstructure:"memory_snapshot_path"`     // File restoring memory storage across restarts, empty disables snapshots
+	MemorySnapshotInterval time.Duration `mapstructure:"memory_snapshot_interval"` // Periodic snapshots, 0 only saves on shutdown
+
+	ClusterAdvertiseAddress string        `mapstructure:"cluster_advertise_address"` // host:port the other replicas reach this one at
+	ClusterPeers            []string      `mapstructure:"cluster_peers"`             // Static host:port list of the replicas, enables the memory cluster
+	ClusterDNS              string        `mapstructure:"cluster_dns"`               // host:port resolving to every replica, instead of cluster_peers
+	ClusterRefreshInterval  time.Duration `mapstructure:"cluster_refresh_interval"`  // How often peers are probed and the ring is rebuilt
+	ClusterForwardTimeout   time.Duration `mapstructure:"cluster_forward_timeout"`   // Timeout of an operation forwarded to the owner of a key
+	ClusterSecret           string        `mapstructure:"cluster_secret"`            // Shared secret authenticating forwarded operations
+
+	StateCodec string `mapstructure:"state_codec"` // "json" or "binary": how Redis and SQL storages serialize limiter state
+
+	KeyPrefix string `mapstructure:"key_prefix"` // Prefix of every stored key, e.g. the application name
+	Namespace string `mapstructure:"namespace"`  // Namespace inside the prefix, e.g. the environment
+
+	Timeout          time.Duration `mapstructure:"timeout"`           // Per-check storage timeout, 0 disables it
+	FailurePolicy    string        `mapstructure:"failure_policy"`    // "error", "open", "closed" or "local"
+	BreakerThreshold int           `mapstructure:"breaker_threshold"` // Consecutive failures opening the circuit breaker, 0 disables it
+	BreakerCooldown  time.Duration `mapstructure:"breaker_cooldown"`  // Time an open breaker rejects checks before probing the storage
+
+	Instrumentation bool `mapstructure:"instrumentation"` // Export per-operation storage latency, error and payload metrics
 }
 
 // LimiterConfig holds rate limiter configuration
 type LimiterConfig struct {
-	DefaultAlgorithm string        `mapstructure:"default_algorithm"` // "token_bucket" or "sliding_window"
-	DefaultLimit     int           `mapstructure:"default_limit"`
-	DefaultWindow    time.Duration `mapstructure:"default_window"`
+	DefaultAlgorithm   string        `mapstructure:"default_algorithm"` // "token_bucket", "sliding_window", "fixed_window", "sliding_window_counter", "gcra" or "leaky_bucket"
+	DefaultLimit       int           `mapstructure:"default_limit"`
+	DefaultWindow      time.Duration `mapstructure:"default_window"`
+	FixedWindowJitter  bool          `mapstructure:"fixed_window_jitter"` // Per-key window offset for fixed_window
+	DefaultConcurrency int           `mapstructure:"default_concurrency"` // Leases held at once per key
+	LeaseTTL           time.Duration `mapstructure:"lease_ttl"`           // Lifetime of an unreleased lease
+
+	Policies        map[string]PolicyConfig `mapstructure:"policies"`         // Named policies referenced by the "policy" field of limit checks
+	ForbidOverrides bool                    `mapstructure:"forbid_overrides"` // Reject limit checks setting their own algorithm, limit, window, burst or queue capacity
+}
+
+// PolicyConfig holds a named rate limit policy, unset fields default to the limiter defaults
+type PolicyConfig struct {
+	Algorithm     string        `mapstructure:"algorithm"`
+	Limit         int           `mapstructure:"limit"`
+	Window        time.Duration `mapstructure:"window"`
+	Burst         int           `mapstructure:"burst"`          // Requests allowed at once (token_bucket, gcra)
+	QueueCapacity int           `mapstructure:"queue_capacity"` // Requests allowed to wait (leaky_bucket)
 }
 
 // CORSConfig holds CORS configuration
@@ -75,13 +139,41 @@ func Load() (*Config, error) {
 	viper.SetDefault("server.write_timeout", "15s")
 	viper.SetDefault("server.idle_timeout", "60s")
 	viper.SetDefault("storage.type", "memory")
+	viper.SetDefault("storage.redis_mode", "single")
 	viper.SetDefault("storage.redis_address", "localhost:6379")
 	viper.SetDefault("storage.redis_db", 0)
 	viper.SetDefault("storage.redis_pool_size", 10)
 	viper.SetDefault("storage.redis_min_idle", 5)
+	viper.SetDefault("storage.redis_tls", false)
+	viper.SetDefault("storage.hybrid_sync_interval", "100ms")
+	viper.SetDefault("storage.sql_driver", "sqlite")
+	viper.SetDefault("storage.sql_dsn", "rate_limiter.db")
+	viper.SetDefault("storage.sql_table", "rate_limiter_state")
+	viper.SetDefault("storage.sql_cleanup_interval", "1m")
+	viper.SetDefault("storage.memory_max_entries", 0)
+	viper.SetDefault("storage.memory_max_bytes", 0)
+	viper.SetDefault("storage.memory_eviction", "lru")
+	viper.SetDefault("storage.memory_cleanup_interval", "1m")
+	viper.SetDefault("storage.memory_shards", 64)
+	viper.SetDefault("storage.memory_snapshot_path", "")
+	viper.SetDefault("storage.memory_snapshot_interval", "30s")
+	viper.SetDefault("storage.cluster_refresh_interval", "5s")
+	viper.SetDefault("storage.cluster_forward_timeout", "1s")
+	viper.SetDefault("storage.state_codec", "json")
+	viper.SetDefault("storage.key_prefix", "")
+	viper.SetDefault("storage.namespace", "")
+	viper.SetDefault("storage.timeout", 0)
+	viper.SetDefault("storage.failure_policy", "error")
+	viper.SetDefault("storage.breaker_threshold", 5)
+	viper.SetDefault("storage.breaker_cooldown", "10s")
+	viper.SetDefault("storage.instrumentation", true)
 	viper.SetDefault("limiter.default_algorithm", "token_bucket")
 	viper.SetDefault("limiter.default_limit", 100)
 	viper.SetDefault("limiter.default_window", "1m")
+	viper.SetDefault("limiter.fixed_window_jitter", false)
+	viper.SetDefault("limiter.default_concurrency", 10)
+	viper.SetDefault("limiter.lease_ttl", "30s")
+	viper.SetDefault("limiter.forbid_overrides", false)
 	viper.SetDefault("cors.allowed_origins", []string{"*"})
 	viper.SetDefault("webhook.enabled", false)
 	viper.SetDefault("webhook.timeout", "5s")
@@ -120,14 +212,57 @@ func bindEnvVars() {
 	viper.BindEnv("storage.type", "RL_STORAGE_TYPE")
 	viper.BindEnv("storage.redis_address", "RL_REDIS_ADDRESS")
 	viper.BindEnv("storage.redis_db", "RL_REDIS_DB")
+	viper.BindEnv("storage.redis_username", "RL_REDIS_USERNAME")
 	viper.BindEnv("storage.redis_password", "RL_REDIS_PASSWORD")
 	viper.BindEnv("storage.redis_pool_size", "RL_REDIS_POOL_SIZE")
 	viper.BindEnv("storage.redis_min_idle", "RL_REDIS_MIN_IDLE")
+	viper.BindEnv("storage.redis_mode", "RL_REDIS_MODE")
+	viper.BindEnv("storage.redis_sentinel_master", "RL_REDIS_SENTINEL_MASTER")
+	viper.BindEnv("storage.redis_sentinel_addresses", "RL_REDIS_SENTINEL_ADDRESSES")
+	viper.BindEnv("storage.redis_sentinel_username", "RL_REDIS_SENTINEL_USERNAME")
+	viper.BindEnv("storage.redis_sentinel_password", "RL_REDIS_SENTINEL_PASSWORD")
+	viper.BindEnv("storage.redis_cluster_addresses", "RL_REDIS_CLUSTER_ADDRESSES")
+	viper.BindEnv("storage.redis_tls", "RL_REDIS_TLS")
+	viper.BindEnv("storage.redis_tls_ca_file", "RL_REDIS_TLS_CA_FILE")
+	viper.BindEnv("storage.redis_tls_cert_file", "RL_REDIS_TLS_CERT_FILE")
+	viper.BindEnv("storage.redis_tls_key_file", "RL_REDIS_TLS_KEY_FILE")
+	viper.BindEnv("storage.redis_tls_server_name", "RL_REDIS_TLS_SERVER_NAME")
+	viper.BindEnv("storage.redis_tls_insecure_skip_verify", "RL_REDIS_TLS_INSECURE_SKIP_VERIFY")
+	viper.BindEnv("storage.hybrid_sync_interval", "RL_HYBRID_SYNC_INTERVAL")
+	viper.BindEnv("storage.sql_driver", "RL_SQL_DRIVER")
+	viper.BindEnv("storage.sql_dsn", "RL_SQL_DSN")
+	viper.BindEnv("storage.sql_table", "RL_SQL_TABLE")
+	viper.BindEnv("storage.sql_cleanup_interval", "RL_SQL_CLEANUP_INTERVAL")
+	viper.BindEnv("storage.memory_max_entries", "RL_MEMORY_MAX_ENTRIES")
+	viper.BindEnv("storage.memory_max_bytes", "RL_MEMORY_MAX_BYTES")
+	viper.BindEnv("storage.memory_eviction", "RL_MEMORY_EVICTION")
+	viper.BindEnv("storage.memory_cleanup_interval", "RL_MEMORY_CLEANUP_INTERVAL")
+	viper.BindEnv("storage.memory_shards", "RL_MEMORY_SHARDS")
+	viper.BindEnv("storage.memory_snapshot_path", "RL_MEMORY_SNAPSHOT_PATH")
+	viper.BindEnv("storage.memory_snapshot_interval", "RL_MEMORY_SNAPSHOT_INTERVAL")
+	viper.BindEnv("storage.cluster_advertise_address", "RL_CLUSTER_ADVERTISE_ADDRESS")
+	viper.BindEnv("storage.cluster_peers", "RL_CLUSTER_PEERS")
+	viper.BindEnv("storage.cluster_dns", "RL_CLUSTER_DNS")
+	viper.BindEnv("storage.cluster_refresh_interval", "RL_CLUSTER_REFRESH_INTERVAL")
+	viper.BindEnv("storage.cluster_forward_timeout", "RL_CLUSTER_FORWARD_TIMEOUT")
+	viper.BindEnv("storage.cluster_secret", "RL_CLUSTER_SECRET")
+	viper.BindEnv("storage.state_codec", "RL_STATE_CODEC")
+	viper.BindEnv("storage.key_prefix", "RL_KEY_PREFIX")
+	viper.BindEnv("storage.namespace", "RL_NAMESPACE")
+	viper.BindEnv("storage.timeout", "RL_STORAGE_TIMEOUT")
+	viper.BindEnv("storage.failure_policy", "RL_STORAGE_FAILURE_POLICY")
+	viper.BindEnv("storage.breaker_threshold", "RL_STORAGE_BREAKER_THRESHOLD")
+	viper.BindEnv("storage.breaker_cooldown", "RL_STORAGE_BREAKER_COOLDOWN")
+	viper.BindEnv("storage.instrumentation", "RL_STORAGE_INSTRUMENTATION")
 
 	// Limiter
 	viper.BindEnv("limiter.default_algorithm", "RL_DEFAULT_ALGORITHM")
 	viper.BindEnv("limiter.default_limit", "RL_DEFAULT_LIMIT")
 	viper.BindEnv("limiter.default_window", "RL_DEFAULT_WINDOW")
+	viper.BindEnv("limiter.fixed_window_jitter", "RL_FIXED_WINDOW_JITTER")
+	viper.BindEnv("limiter.default_concurrency", "RL_DEFAULT_CONCURRENCY")
+	viper.BindEnv("limiter.lease_ttl", "RL_LEASE_TTL")
+	viper.BindEnv("limiter.forbid_overrides", "RL_FORBID_OVERRIDES")
 
 	// CORS
 	viper.BindEnv("cors.allowed_origins", "RL_CORS_ALLOWED_ORIGINS")
@@ -160,11 +295,28 @@ func bindEnvVars() {
 	}
 
 	if origins := os.Getenv("RL_CORS_ALLOWED_ORIGINS"); origins != "" {
-		originsList := strings.Split(origins, ",")
-		for i := range originsList {
-			originsList[i] = strings.TrimSpace(originsList[i])
-		}
-		viper.Set("cors.allowed_origins", originsList)
+		viper.Set("cors.allowed_origins", splitList(origins))
+	}
+
+	if addresses := os.Getenv("RL_REDIS_SENTINEL_ADDRESSES"); addresses != "" {
+		viper.Set("storage.redis_sentinel_addresses", splitList(addresses))
+	}
+
+	if addresses := os.Getenv("RL_REDIS_CLUSTER_ADDRESSES"); addresses != "" {
+		viper.Set("storage.redis_cluster_addresses", splitList(addresses))
+	}
+
+	if peers := os.Getenv("RL_CLUSTER_PEERS"); peers != "" {
+		viper.Set("storage.cluster_peers", splitList(peers))
+	}
+}
+
+// splitList splits a comma-separated environment variable into trimmed items
+func splitList(value string) []string {
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
 	}
+	return items
 }
 
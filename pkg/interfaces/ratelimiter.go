@@ -2,9 +2,44 @@ package interfaces
 
 import (
 	"context"
+	"time"
 )
 
 // RateLimiter описывает контракт для алгоритмов ограничения скорости.
 type RateLimiter interface {
 	Allow(ctx context.Context, key string) (bool, error)
+	// AllowN проверяет запрос, который расходует n единиц лимита вместо одной.
+	AllowN(ctx context.Context, key string, n int) (bool, error)
+	// Decide проверяет запрос стоимостью n единиц и возвращает решение с состоянием лимита.
+	Decide(ctx context.Context, key string, n int) (Decision, error)
+}
+
+// Decision описывает результат проверки лимита.
+type Decision struct {
+	// Allowed сообщает, допущен ли запрос.
+	Allowed bool
+	// Limit — емкость, относительно которой считается Remaining (limit, burst или размер очереди).
+	Limit int
+	// Remaining — сколько единиц можно израсходовать сразу после этой проверки.
+	Remaining int
+	// ResetAt — момент, когда лимит полностью восстановится.
+	ResetAt time.Time
+	// RetryAfter — через сколько будет допущен отклоненный запрос той же стоимости, 0 для допущенного.
+	RetryAfter time.Duration
+	// Delay — через сколько допущенный запрос может выполняться (алгоритмы со сглаживанием трафика).
+	Delay time.Duration
+}
+
+// Lease описывает занятый слот ограничителя конкурентности.
+type Lease struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// ConcurrencyLimiter описывает контракт для ограничения числа одновременно выполняемых операций.
+type ConcurrencyLimiter interface {
+	// Acquire занимает слот для ключа и возвращает аренду, которая освобождается сама по истечении срока.
+	Acquire(ctx context.Context, key string) (Lease, bool, error)
+	// Release освобождает слот и сообщает, была ли аренда еще действительна.
+	Release(ctx context.Context, key string, leaseID string) (bool, error)
 }
@@ -1,3 +1,7 @@
+// Package limiter provides context-free Token Bucket and Sliding Window limiters over pkg/storage.
+//
+// Deprecated: use pkg/ratelimit, which takes a context.Context on every check, keeps state
+// with nanosecond precision and offers every algorithm and storage backend of the service.
 package limiter
 
 import (
@@ -3,37 +3,60 @@ package limiter
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/storage"
 )
 
 // TokenBucketLimiter implements the Token Bucket algorithm
+// Tokens are refilled at limit per window into a bucket holding up to burst tokens
 type TokenBucketLimiter struct {
 	storage storage.Storage
 	limit   int
 	window  time.Duration
+	burst   int
 }
 
-// NewTokenBucketLimiter creates a new Token Bucket limiter
+// NewTokenBucketLimiter creates a new Token Bucket limiter holding limit tokens
 func NewTokenBucketLimiter(storage storage.Storage, limit int, window time.Duration) *TokenBucketLimiter {
+	return NewTokenBucketLimiterWithBurst(storage, limit, window, limit)
+}
+
+// NewTokenBucketLimiterWithBurst creates a new Token Bucket limiter refilling limit tokens per window
+// into a bucket of burst tokens, e.g. 10 requests per second bursting to 50.
+// A burst of 0 makes the bucket hold limit tokens.
+func NewTokenBucketLimiterWithBurst(storage storage.Storage, limit int, window time.Duration, burst int) *TokenBucketLimiter {
+	if burst <= 0 {
+		burst = limit
+	}
 	return &TokenBucketLimiter{
 		storage: storage,
 		limit:   limit,
 		window:  window,
+		burst:   burst,
 	}
 }
 
+// tokenEpsilon absorbs floating point error of fractional refills,
+// so that refills adding up to a whole token are counted as one
+const tokenEpsilon = 1e-9
+
+// legacyRefillCutoff separates refill times stored in Unix seconds by earlier versions from nanoseconds:
+// seconds stay below it for millennia, nanoseconds passed it in 1970
+const legacyRefillCutoff = 1e12
+
 // tokenBucketState represents the state of a token bucket
 type tokenBucketState struct {
-	Tokens     int   `json:"tokens"`
-	LastRefill int64 `json:"last_refill"` // Unix timestamp
+	Tokens     float64 `json:"tokens"`      // Fractional, so that slow refill rates do not lose partial tokens
+	LastRefill int64   `json:"last_refill"` // Unix timestamp in nanoseconds, in seconds before fractional refills
 }
 
 // Allow checks if a request should be allowed using Token Bucket algorithm
 func (t *TokenBucketLimiter) Allow(key string) (bool, error) {
-	now := time.Now().Unix()
-	refillRate := float64(t.limit) / t.window.Seconds()
+	now := time.Now()
+	// Time to refill a single token in nanoseconds
+	tokenInterval := float64(t.window) / float64(t.limit)
 
 	// Get current state
 	stateData, err := t.storage.Get(key)
@@ -45,8 +68,8 @@ func (t *TokenBucketLimiter) Allow(key string) (bool, error) {
 	if stateData == nil {
 		// Initialize bucket with full tokens
 		state = tokenBucketState{
-			Tokens:     t.limit,
-			LastRefill: now,
+			Tokens:     float64(t.burst),
+			LastRefill: now.UnixNano(),
 		}
 	} else {
 		// Parse state
@@ -65,56 +88,40 @@ func (t *TokenBucketLimiter) Allow(key string) (bool, error) {
 		if err := json.Unmarshal([]byte(stateJSON), &state); err != nil {
 			// If unmarshal fails, reset bucket
 			state = tokenBucketState{
-				Tokens:     t.limit,
-				LastRefill: now,
+				Tokens:     float64(t.burst),
+				LastRefill: now.UnixNano(),
 			}
 		} else {
-			// Refill tokens based on time elapsed since last refill/emptying
-			elapsed := now - state.LastRefill
+			if state.LastRefill < legacyRefillCutoff {
+				state.LastRefill *= int64(time.Second)
+			}
+			// Refill tokens based on time elapsed since last refill, keeping the fraction of a token
+			elapsed := now.UnixNano() - state.LastRefill
 			if elapsed > 0 {
-				tokensToAdd := int(float64(elapsed) * refillRate)
-				if tokensToAdd > 0 {
-					state.Tokens = min(state.Tokens+tokensToAdd, t.limit)
-					state.LastRefill = now
-				}
+				state.Tokens = math.Min(state.Tokens+float64(elapsed)/tokenInterval, float64(t.burst))
+				state.LastRefill = now.UnixNano()
 			}
 		}
 	}
 
-	// Check if we have tokens available
-	if state.Tokens <= 0 {
-		// Save state even if request is denied
-		stateJSON, _ := json.Marshal(state)
-		expiration := now + int64(t.window.Seconds())
-		t.storage.Set(key, string(stateJSON), expiration)
-		return false, nil
+	// Check if we have a token available and consume it
+	allowed := state.Tokens+tokenEpsilon >= 1
+	if allowed {
+		state.Tokens = math.Max(state.Tokens-1, 0)
 	}
 
-	// Consume a token
-	state.Tokens--
-	// When the bucket becomes empty, move the refill reference point
-	// to the moment of emptying so that new tokens start accumulating
-	// from this time, not from the initial creation time.
-	if state.Tokens == 0 {
-		state.LastRefill = now
-	}
+	// Save state even if request is denied, it expires once the bucket would be full again
+	refillDuration := time.Duration((float64(t.burst) - state.Tokens) * tokenInterval)
+	expiration := now.Add(refillDuration).Unix() + 1
 	stateJSON, _ := json.Marshal(state)
-	expiration := now + int64(t.window.Seconds())
 	if err := t.storage.Set(key, string(stateJSON), expiration); err != nil {
 		return false, fmt.Errorf("failed to save bucket state: %w", err)
 	}
 
-	return true, nil
+	return allowed, nil
 }
 
 // Reset resets the token bucket for a key
 func (t *TokenBucketLimiter) Reset(key string) error {
 	return t.storage.Delete(key)
 }
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
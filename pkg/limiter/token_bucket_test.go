@@ -0,0 +1,36 @@
+package limiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/storage"
+)
+
+func TestTokenBucketLimiter_LegacySecondsState(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	limiter := NewTokenBucketLimiter(store, 10, time.Hour)
+
+	// State written by earlier versions: whole tokens, last refill in Unix seconds a second ago
+	now := time.Now()
+	legacy := fmt.Sprintf(`{"tokens":2,"last_refill":%d}`, now.Add(-time.Second).Unix())
+	if err := store.Set("key", legacy, now.Add(time.Hour).Unix()); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// Read as nanoseconds, the bucket would look decades old and refill completely
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		ok, err := limiter.Allow("key")
+		if err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+		if ok {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Expected the 2 tokens of the legacy state, got %d allowed", allowed)
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimit_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/ratelimit"
+)
+
+func ExampleNew() {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	store := ratelimit.NewMemoryStorage(nil, logger)
+	defer store.Close()
+
+	limiter, err := ratelimit.New(ratelimit.Config{
+		Algorithm: ratelimit.TokenBucket,
+		Limit:     2,
+		Window:    time.Minute,
+		Storage:   store,
+		Logger:    logger,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		decision, err := limiter.Decide(ctx, "user:123", 1)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(decision.Allowed, decision.Remaining)
+	}
+	// Output:
+	// true 1
+	// true 0
+	// false 0
+}
+
+func ExampleNewConcurrencyLimiter() {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	store := ratelimit.NewMemoryStorage(nil, logger)
+	defer store.Close()
+
+	limiter, err := ratelimit.NewConcurrencyLimiter(ratelimit.ConcurrencyConfig{
+		Limit:    1,
+		LeaseTTL: time.Minute,
+		Storage:  store,
+		Logger:   logger,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	ctx := context.Background()
+	lease, acquired, _ := limiter.Acquire(ctx, "export")
+	_, second, _ := limiter.Acquire(ctx, "export")
+	released, _ := limiter.Release(ctx, "export", lease.ID)
+	fmt.Println(acquired, second, released)
+	// Output: true false true
+}
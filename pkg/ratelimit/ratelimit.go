@@ -0,0 +1,92 @@
+// Package ratelimit is the public API for embedding the rate limiter in Go services.
+// It exposes the algorithms, storage interface and storage backends the service itself uses:
+// every check takes a context.Context and state is kept with nanosecond precision.
+//
+// A limiter is created from a Config with a Storage:
+//
+//	store := ratelimit.NewMemoryStorage(nil, nil)
+//	defer store.Close()
+//
+//	limiter, err := ratelimit.New(ratelimit.Config{
+//		Algorithm: ratelimit.TokenBucket,
+//		Limit:     100,
+//		Window:    time.Minute,
+//		Storage:   store,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	decision, err := limiter.Decide(ctx, "user:123", 1)
+//
+// Limiters sharing a Redis storage enforce one limit across all instances of a service.
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/clock"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/interfaces"
+)
+
+// Limiter checks requests against a rate limit, see interfaces.RateLimiter
+type Limiter = interfaces.RateLimiter
+
+// Decision is the result of a check with the state of the limit
+type Decision = interfaces.Decision
+
+// ErrInvalidCost is returned by Limiter.AllowN and Limiter.Decide for a cost below 1
+var ErrInvalidCost = storage.ErrInvalidCost
+
+// ConcurrencyLimiter caps the operations in flight per key with leases
+type ConcurrencyLimiter = interfaces.ConcurrencyLimiter
+
+// Lease is a slot held in a ConcurrencyLimiter
+type Lease = interfaces.Lease
+
+// Algorithm selects the rate limiting algorithm of a Limiter
+type Algorithm = internal.AlgorithmType
+
+// Supported algorithms
+const (
+	// TokenBucket refills tokens at a constant rate into a bucket of Burst tokens
+	TokenBucket Algorithm = internal.AlgorithmTokenBucket
+	// SlidingWindow keeps a log of the requests made within the window
+	SlidingWindow Algorithm = internal.AlgorithmSlidingWindow
+	// FixedWindow counts requests per window
+	FixedWindow Algorithm = internal.AlgorithmFixedWindow
+	// SlidingWindowCounter approximates the sliding window log with two window counters
+	SlidingWindowCounter Algorithm = internal.AlgorithmSlidingWindowCounter
+	// GCRA tracks a single theoretical arrival time per key
+	GCRA Algorithm = internal.AlgorithmGCRA
+	// LeakyBucket queues requests draining at a constant rate, see Decision.Delay
+	LeakyBucket Algorithm = internal.AlgorithmLeakyBucket
+)
+
+// Clock is the time source of limiters and storages, see Config.Clock
+type Clock = clock.Clock
+
+// FakeClock is a Clock that only moves when told to, for tests and simulations
+type FakeClock = clock.Fake
+
+// NewFakeClock returns a fake clock stopped at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return clock.NewFake(now)
+}
+
+// Config configures a Limiter: the algorithm, its limit per window and the storage keeping its state
+type Config = internal.LimiterConfig
+
+// ConcurrencyConfig configures a ConcurrencyLimiter
+type ConcurrencyConfig = internal.ConcurrencyConfig
+
+// New creates a limiter running cfg.Algorithm on cfg.Storage
+func New(cfg Config) (Limiter, error) {
+	return internal.NewRateLimiter(cfg)
+}
+
+// NewConcurrencyLimiter creates a limiter holding up to cfg.Limit leases per key on cfg.Storage
+func NewConcurrencyLimiter(cfg ConcurrencyConfig) (ConcurrencyLimiter, error) {
+	return internal.NewConcurrencyLimiter(cfg)
+}
@@ -0,0 +1,63 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/ratelimit"
+)
+
+func TestNew_RejectsInvalidCost(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	algorithms := []ratelimit.Algorithm{
+		ratelimit.TokenBucket,
+		ratelimit.SlidingWindow,
+		ratelimit.FixedWindow,
+		ratelimit.SlidingWindowCounter,
+		ratelimit.GCRA,
+		ratelimit.LeakyBucket,
+	}
+
+	for _, algorithm := range algorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			store := ratelimit.NewMemoryStorage(nil, logger)
+			defer store.Close()
+			limiter, err := ratelimit.New(ratelimit.Config{
+				Algorithm: algorithm,
+				Limit:     5,
+				Window:    time.Minute,
+				Storage:   store,
+				Clock:     ratelimit.NewFakeClock(time.Now()),
+				Logger:    logger,
+			})
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			ctx := context.Background()
+
+			if _, err := limiter.Decide(ctx, "user:123", -10); !errors.Is(err, ratelimit.ErrInvalidCost) {
+				t.Errorf("Expected ErrInvalidCost from Decide, got %v", err)
+			}
+			if _, err := limiter.AllowN(ctx, "user:123", -10); !errors.Is(err, ratelimit.ErrInvalidCost) {
+				t.Errorf("Expected ErrInvalidCost from AllowN, got %v", err)
+			}
+
+			// The rejected checks did not add to the limit of 5
+			allowed := 0
+			for i := 0; i < 10; i++ {
+				if ok, err := limiter.Allow(ctx, "user:123"); err != nil {
+					t.Fatalf("Allow failed: %v", err)
+				} else if ok {
+					allowed++
+				}
+			}
+			if allowed != 5 {
+				t.Errorf("Expected 5 allowed requests, got %d", allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"log/slog"
+
+	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/storage"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
+)
+
+// Storage keeps limiter state. Custom backends implement it, with an atomic Update.
+type Storage = storage.Storage
+
+// UpdateFunc computes the new value of a key in Storage.Update
+type UpdateFunc = storage.UpdateFunc
+
+// ErrUpdateConflict is returned by Storage.Update when the value kept changing concurrently
+var ErrUpdateConflict = storage.ErrUpdateConflict
+
+// StorageConfig configures the storage backends, as the storage section of the service configuration
+type StorageConfig = config.StorageConfig
+
+// MemoryMetrics receives memory storage events, e.g. to export them to Prometheus
+type MemoryMetrics = storage.MemoryMetrics
+
+// MemoryStorage keeps state in process, for limiters of a single instance
+type MemoryStorage = storage.MemoryStorage
+
+// ShardedMemoryStorage keeps state in process with one lock per shard, for many concurrent keys
+type ShardedMemoryStorage = storage.ShardedMemoryStorage
+
+// ClusterStorage spreads state over the memory storages of several instances by consistent hashing
+type ClusterStorage = storage.ClusterStorage
+
+// RedisStorage keeps state in Redis, evaluating the algorithms atomically on the server
+type RedisStorage = storage.RedisStorage
+
+// NewMemoryStorage creates an unbounded in-memory storage expiring keys by clk.
+// A nil clock uses the system clock and a nil logger slog.Default.
+func NewMemoryStorage(clk Clock, logger *slog.Logger) *MemoryStorage {
+	return storage.NewMemoryStorage(clk, logger)
+}
+
+// NewMemoryStorageWithConfig creates an in-memory storage bounded and cleaned up as configured by cfg.
+// metrics and clk may be nil.
+func NewMemoryStorageWithConfig(cfg StorageConfig, metrics MemoryMetrics, clk Clock, logger *slog.Logger) (*MemoryStorage, error) {
+	return storage.NewMemoryStorageWithConfig(cfg, metrics, clk, logger)
+}
+
+// NewShardedMemoryStorage creates an unbounded in-memory storage split into shards,
+// rounded up to a power of two
+func NewShardedMemoryStorage(shards int, clk Clock, logger *slog.Logger) *ShardedMemoryStorage {
+	return storage.NewShardedMemoryStorage(shards, clk, logger)
+}
+
+// NewClusterStorage joins the memory cluster configured by cfg.
+// ClusterStorage.Handler must be served under ClusterPathPrefix for the other instances to reach it.
+func NewClusterStorage(cfg StorageConfig, metrics MemoryMetrics, clk Clock, logger *slog.Logger) (*ClusterStorage, error) {
+	return storage.NewClusterStorage(cfg, metrics, clk, logger)
+}
+
+// ClusterPathPrefix is the path of the internal endpoint of ClusterStorage
+const ClusterPathPrefix = storage.ClusterPathPrefix
+
+// NewRedisStorage connects to the Redis server, Sentinel or Cluster configured by cfg
+func NewRedisStorage(cfg StorageConfig, logger *slog.Logger) (*RedisStorage, error) {
+	return storage.NewRedisStorage(cfg, logger)
+}
+
+// StorageMetrics receives the latency, errors and payload sizes of storage operations
+type StorageMetrics = storage.StorageMetrics
+
+// NewInstrumentedStorage wraps next, reporting every operation to metrics under the backend label
+func NewInstrumentedStorage(next Storage, backend string, metrics StorageMetrics, logger *slog.Logger) Storage {
+	return storage.NewInstrumentedStorage(next, backend, metrics, logger)
+}
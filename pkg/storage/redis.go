@@ -8,7 +8,7 @@ import (
 
 	"github.com/go-redis/redis/v8"
 
-	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/config"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
 )
 
 // RedisStorage implements Redis storage for distributed rate limiting
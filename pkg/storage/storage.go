@@ -1,9 +1,12 @@
+// Package storage provides the context-free storages of pkg/limiter.
+//
+// Deprecated: use the Storage interface and backends of pkg/ratelimit.
 package storage
 
 import (
 	"fmt"
 
-	"github.com/tsvetkovpa93tech/rate-limiter-service/internal/config"
+	"github.com/tsvetkovpa93tech/rate-limiter-service/pkg/config"
 )
 
 // Storage defines the interface for rate limiter storage